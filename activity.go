@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ActivityEntry records a single change to a task.
+type ActivityEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"` // one of the task event types
+	TaskID string    `json:"task_id"`
+	// Changes holds the old and new values of the fields an update changed,
+	// by field name. Only updates made through PUT and PATCH record it.
+	Changes map[string]FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is the value of a task field before and after an update, as
+// the field is written in responses. A field left out of the task, such as
+// an unset due date, is null.
+type FieldChange struct {
+	Old json.RawMessage `json:"old"`
+	New json.RawMessage `json:"new"`
+}
+
+// untrackedFields are the task fields every update changes, which would only
+// clutter its recorded changes.
+var untrackedFields = map[string]bool{"updated_at": true, "version": true}
+
+// taskChanges returns the fields that differ between two versions of a task.
+func taskChanges(before, after Task) map[string]FieldChange {
+	oldFields, newFields := taskFields(before), taskFields(after)
+	changes := make(map[string]FieldChange)
+	for name := range taskFieldNames {
+		if untrackedFields[name] || bytes.Equal(emptyAsNull(oldFields[name]), emptyAsNull(newFields[name])) {
+			continue
+		}
+		changes[name] = FieldChange{Old: orNull(oldFields[name]), New: orNull(newFields[name])}
+	}
+	return changes
+}
+
+// orNull returns value, or JSON null for a field that was left out.
+func orNull(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
+
+// emptyAsNull is orNull that also turns an empty array into null, so that
+// a list going from unset to empty, which clients cannot tell apart, is not
+// reported as a change.
+func emptyAsNull(value json.RawMessage) json.RawMessage {
+	if string(value) == "[]" {
+		return json.RawMessage("null")
+	}
+	return orNull(value)
+}
+
+// activityLog keeps the most recent task changes in a fixed-size ring buffer.
+// A nil log records nothing.
+type activityLog struct {
+	mu      sync.Mutex
+	entries []ActivityEntry
+	next    int // index the next entry is written to
+	full    bool
+}
+
+// newActivityLog returns a log holding the last size changes, or nil if size
+// is zero.
+func newActivityLog(size int) *activityLog {
+	if size == 0 {
+		return nil
+	}
+	return &activityLog{entries: make([]ActivityEntry, size)}
+}
+
+// add records that action was applied to each of tasks at now.
+func (l *activityLog) add(now time.Time, action string, tasks ...Task) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, task := range tasks {
+		l.record(ActivityEntry{Time: now, Action: action, TaskID: task.ID})
+	}
+}
+
+// addUpdate records at now that a task was updated from before to after,
+// along with the fields that changed.
+func (l *activityLog) addUpdate(now time.Time, before, after Task) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.record(ActivityEntry{Time: now, Action: eventUpdated, TaskID: after.ID, Changes: taskChanges(before, after)})
+}
+
+// record writes entry over the oldest one once the log is full. The caller
+// must hold l.mu.
+func (l *activityLog) record(entry ActivityEntry) {
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent returns the recorded changes, newest first.
+func (l *activityLog) recent() []ActivityEntry {
+	if l == nil {
+		return []ActivityEntry{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	recent := make([]ActivityEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		recent = append(recent, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return recent
+}
+
+// size returns how many changes the log holds.
+func (l *activityLog) size() int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.full {
+		return len(l.entries)
+	}
+	return l.next
+}
+
+// compact drops the changes recorded before cutoff, returning how many it
+// dropped. The changes kept are moved to the start of the buffer, and the
+// slots they leave are cleared so the dropped changes can be freed.
+func (l *activityLog) compact(cutoff time.Time) int {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n, oldest := l.next, 0
+	if l.full {
+		n, oldest = len(l.entries), l.next
+	}
+	kept := make([]ActivityEntry, 0, n)
+	for i := 0; i < n; i++ {
+		if entry := l.entries[(oldest+i)%len(l.entries)]; !entry.Time.Before(cutoff) {
+			kept = append(kept, entry)
+		}
+	}
+	if len(kept) == n {
+		return 0
+	}
+	clear(l.entries)
+	copy(l.entries, kept)
+	l.next = len(kept)
+	l.full = false
+	return n - len(kept)
+}
+
+// expireOld drops changes older than retention, checking every interval
+// until ctx is done, so that a log that fills slowly does not keep changes
+// for longer than the deployment wants audit data around.
+func (l *activityLog) expireOld(ctx context.Context, interval, retention time.Duration) {
+	if l == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.compact(now.Add(-retention))
+		}
+	}
+}
+
+// taskHistory returns the recorded changes to the task with the given ID,
+// newest first.
+func (l *activityLog) taskHistory(id string) []ActivityEntry {
+	history := []ActivityEntry{}
+	for _, entry := range l.recent() {
+		if entry.TaskID == id {
+			history = append(history, entry)
+		}
+	}
+	return history
+}
+
+// publish records a change in the activity log and announces it to event
+// subscribers. Handlers call it after every successful mutation, so it is
+// also where the IDs of created tasks are reserved.
+func (h *Handlers) publish(eventType string, tasks ...Task) {
+	if eventType == eventCreated && h.ids != nil {
+		for _, task := range tasks {
+			h.ids.Reserve(task.ID)
+		}
+	}
+	h.activity.add(time.Now().UTC(), eventType, tasks...)
+	h.events.publish(eventType, tasks...)
+}
+
+// publishUpdate is publish for an update of a task from before to after,
+// which records the fields that changed.
+func (h *Handlers) publishUpdate(before, after Task) {
+	h.activity.addUpdate(time.Now().UTC(), before, after)
+	h.events.publish(eventUpdated, after)
+}
+
+// getActivityHandler lists the most recent task changes, newest first. Only
+// changes since the server started are known.
+func (h *Handlers) getActivityHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string][]ActivityEntry{"activity": h.activity.recent()})
+}
+
+// getTaskHistoryHandler lists the recorded changes to a task, newest first,
+// with the old and new values of the fields each update changed. Like the
+// activity log it draws on, it only knows recent changes since the server
+// started.
+func (h *Handlers) getTaskHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	includeDeleted, err := parseBoolParam(r.URL.Query().Get("include_deleted"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Include_deleted must be true or false")
+		return
+	}
+
+	task, err := h.store.Get(r.Context(), id)
+	if err == nil && task.DeletedAt != nil && !includeDeleted {
+		err = ErrNotFound
+	}
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string][]ActivityEntry{"history": h.activity.taskHistory(id)})
+}
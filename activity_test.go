@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestActivityLogWrapsAround(t *testing.T) {
+	log := newActivityLog(3)
+	now := time.Now()
+	for _, id := range []string{"1", "2", "3", "4"} {
+		log.add(now, eventCreated, Task{ID: id})
+	}
+
+	var got []string
+	for _, entry := range log.recent() {
+		got = append(got, entry.TaskID)
+	}
+	if strings.Join(got, ",") != "4,3,2" {
+		t.Errorf("recent returned wrong entries: got %v want [4 3 2]", got)
+	}
+}
+
+func TestActivityLogCompact(t *testing.T) {
+	log := newActivityLog(4)
+	start := time.Now()
+	for i, id := range []string{"1", "2", "3", "4", "5", "6"} {
+		log.add(start.Add(time.Duration(i)*time.Minute), eventCreated, Task{ID: id})
+	}
+	if size := log.size(); size != 4 {
+		t.Errorf("size returned %d for a full log, want 4", size)
+	}
+
+	if dropped := log.compact(start.Add(4 * time.Minute)); dropped != 2 {
+		t.Errorf("compact dropped %d entries, want 2", dropped)
+	}
+	if size := log.size(); size != 2 {
+		t.Errorf("size returned %d after compacting, want 2", size)
+	}
+	for _, id := range []string{"7", "8", "9"} {
+		log.add(start.Add(10*time.Minute), eventCreated, Task{ID: id})
+	}
+	var got []string
+	for _, entry := range log.recent() {
+		got = append(got, entry.TaskID)
+	}
+	if strings.Join(got, ",") != "9,8,7,6" {
+		t.Errorf("recent returned wrong entries after compacting: got %v want [9 8 7 6]", got)
+	}
+	if dropped := log.compact(start); dropped != 0 {
+		t.Errorf("compact dropped %d entries newer than the cutoff", dropped)
+	}
+
+	var off *activityLog
+	if off.compact(start) != 0 || off.size() != 0 {
+		t.Errorf("a nil log reported entries")
+	}
+}
+
+func TestGetTaskStatsHandlerActivity(t *testing.T) {
+	router, _ := setupRouter()
+	for _, name := range []string{"One", "Two"} {
+		req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "`+name+`"}`))
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req, _ := http.NewRequest("GET", "/tasks/stats", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var stats TaskStats
+	json.Unmarshal(rr.Body.Bytes(), &stats)
+	if stats.Total != 2 || stats.Activity != 2 {
+		t.Errorf("handler returned wrong stats: got %+v, want 2 tasks and 2 activity entries", stats)
+	}
+}
+
+func TestGetActivityHandler(t *testing.T) {
+	router, _ := setupRouter()
+
+	req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "Audited"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var task Task
+	json.Unmarshal(rr.Body.Bytes(), &task)
+
+	req, _ = http.NewRequest("DELETE", "/tasks/"+task.ID, nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/tasks/activity", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var body struct {
+		Activity []ActivityEntry `json:"activity"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if len(body.Activity) != 2 ||
+		body.Activity[0].Action != eventDeleted || body.Activity[1].Action != eventCreated ||
+		body.Activity[0].TaskID != task.ID || body.Activity[1].TaskID != task.ID {
+		t.Errorf("handler returned wrong activity: got %+v", body.Activity)
+	}
+}
+
+func TestTaskChanges(t *testing.T) {
+	due := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	before := Task{ID: "1", Name: "Old", Priority: 1, Version: 1}
+	after := Task{ID: "1", Name: "New", Priority: 1, DueDate: &due, Version: 2, UpdatedAt: due}
+
+	changes := taskChanges(before, after)
+	if len(changes) != 2 {
+		t.Fatalf("taskChanges returned wrong fields: got %v", changes)
+	}
+	if got := changes["name"]; string(got.Old) != `"Old"` || string(got.New) != `"New"` {
+		t.Errorf("taskChanges returned wrong name change: got %s, %s", got.Old, got.New)
+	}
+	if got := changes["due_date"]; string(got.Old) != "null" || string(got.New) != `"2026-01-02T00:00:00Z"` {
+		t.Errorf("taskChanges returned wrong due date change: got %s, %s", got.Old, got.New)
+	}
+}
+
+func TestGetTaskHistoryHandler(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Original", Version: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Other", Version: 1}
+
+	for _, req := range []struct{ method, path, body string }{
+		{"PATCH", "/tasks/1", `{"name": "Renamed"}`},
+		{"PATCH", "/tasks/2", `{"priority": 2}`},
+		{"PUT", "/tasks/1", `{"name": "Renamed", "status": 1, "version": 2}`},
+		{"PATCH", "/tasks", `{"set": {"priority": 1}}`},
+	} {
+		r, _ := http.NewRequest(req.method, req.path, strings.NewReader(req.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, r)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s %s returned %v: %s", req.method, req.path, rr.Code, rr.Body)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/tasks/1/history", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var body struct {
+		History []ActivityEntry `json:"history"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if len(body.History) != 3 {
+		t.Fatalf("handler returned wrong history: got %+v", body.History)
+	}
+	want := []map[string][2]string{
+		{"priority": {"0", "1"}},
+		{"status": {"0", "1"}},
+		{"name": {`"Original"`, `"Renamed"`}},
+	}
+	for i, entry := range body.History {
+		if entry.TaskID != "1" || entry.Action != eventUpdated || len(entry.Changes) != len(want[i]) {
+			t.Errorf("entry %d is wrong: got %+v", i, entry)
+			continue
+		}
+		for field, values := range want[i] {
+			if got := entry.Changes[field]; string(got.Old) != values[0] || string(got.New) != values[1] {
+				t.Errorf("entry %d recorded wrong %s change: got %s, %s", i, field, got.Old, got.New)
+			}
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/tasks/missing/history", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for a missing task: got %v want %v", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+// BatchDeleteResult reports what a batch delete did with each requested ID.
+type BatchDeleteResult struct {
+	Deleted  []string `json:"deleted"`
+	NotFound []string `json:"not_found"`
+	// Blocked lists tasks left alone because they have subtasks outside the
+	// trash that were not deleted with them.
+	Blocked []string `json:"blocked"`
+}
+
+// batchDeleteTasksHandler moves the tasks whose IDs make up the body, a JSON
+// array, to the trash in a single store update. IDs that do not exist or are
+// already in the trash are reported as not found rather than failing the
+// request. As with DELETE /tasks/{id}, a task whose subtasks would be left
+// behind is not deleted, unless those subtasks are in the batch too.
+func (h *Handlers) batchDeleteTasksHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var ids []string
+	if err := decodeJSON(r, &ids); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	if len(ids) == 0 || slices.Contains(ids, "") {
+		respondError(w, http.StatusBadRequest, "Body must be a non-empty array of task IDs")
+		return
+	}
+
+	all, err := h.store.GetAll(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	deleting := make(map[string]bool, len(ids))
+	for _, task := range all {
+		if task.DeletedAt == nil && slices.Contains(ids, task.ID) {
+			deleting[task.ID] = true
+		}
+	}
+	blocked := make(map[string]bool)
+	// Dropping a blocked task can block its parent in turn, so repeat until
+	// nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, task := range all {
+			if task.DeletedAt != nil || task.ParentID == nil || deleting[task.ID] || !deleting[*task.ParentID] {
+				continue
+			}
+			delete(deleting, *task.ParentID)
+			blocked[*task.ParentID] = true
+			changed = true
+		}
+	}
+
+	now := time.Now().UTC()
+	deleted, err := h.updateMatching(r.Context(), dryRun, func(task Task) bool {
+		return deleting[task.ID] && task.DeletedAt == nil
+	}, func(task *Task) error {
+		task.DeletedAt = &now
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if !dryRun {
+		h.publish(eventDeleted, deleted...)
+	}
+
+	result := BatchDeleteResult{Deleted: []string{}, NotFound: []string{}, Blocked: []string{}}
+	done := make(map[string]bool, len(deleted))
+	for _, task := range deleted {
+		done[task.ID] = true
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		switch {
+		case done[id]:
+			result.Deleted = append(result.Deleted, id)
+		case blocked[id]:
+			result.Blocked = append(result.Blocked, id)
+		default:
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+	respondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchDeleteTasksHandler(t *testing.T) {
+	router, store := setupRouter()
+	deletedAt := time.Now()
+	parent := "parent"
+	lonelyParent := "lonely"
+	store.tasks["a"] = Task{ID: "a", Name: "A"}
+	store.tasks["b"] = Task{ID: "b", Name: "B"}
+	store.tasks["trashed"] = Task{ID: "trashed", Name: "Trashed", DeletedAt: &deletedAt}
+	store.tasks["parent"] = Task{ID: "parent", Name: "Parent"}
+	store.tasks["child"] = Task{ID: "child", Name: "Child", ParentID: &parent}
+	store.tasks["lonely"] = Task{ID: "lonely", Name: "Lonely parent"}
+	store.tasks["kept"] = Task{ID: "kept", Name: "Kept child", ParentID: &lonelyParent}
+
+	body := `["a", "b", "a", "missing", "trashed", "parent", "child", "lonely"]`
+	req, _ := http.NewRequest("POST", "/tasks/batch-delete", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+	var result BatchDeleteResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if want := []string{"a", "b", "parent", "child"}; !slices.Equal(result.Deleted, want) {
+		t.Errorf("handler reported deleted %v, want %v", result.Deleted, want)
+	}
+	if want := []string{"missing", "trashed"}; !slices.Equal(result.NotFound, want) {
+		t.Errorf("handler reported not found %v, want %v", result.NotFound, want)
+	}
+	if want := []string{"lonely"}; !slices.Equal(result.Blocked, want) {
+		t.Errorf("handler reported blocked %v, want %v", result.Blocked, want)
+	}
+	for _, id := range []string{"a", "b", "parent", "child"} {
+		if store.tasks[id].DeletedAt == nil {
+			t.Errorf("task %s was not moved to the trash", id)
+		}
+	}
+	if store.tasks["lonely"].DeletedAt != nil {
+		t.Errorf("blocked task was moved to the trash")
+	}
+}
+
+func TestBatchDeleteTasksHandlerInvalidBody(t *testing.T) {
+	router, _ := setupRouter()
+	for _, body := range []string{`[]`, `{"ids": ["a"]}`, `[1, 2]`, `["a", ""]`} {
+		req, _ := http.NewRequest("POST", "/tasks/batch-delete", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned %v for %s, want %v", status, body, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxCommentLength bounds the body of a comment.
+const maxCommentLength = 2000
+
+// Comment is a note left on a task. Comments cannot be edited; they are
+// removed along with their task when it is purged.
+type Comment struct {
+	ID        string    `json:"id"`
+	TaskID    string    `json:"task_id"`
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommentInput is the body of a request adding a comment.
+type CommentInput struct {
+	Author string `json:"author"`
+	Body   string `json:"body"`
+}
+
+// CommentList is the response body listing a task's comments.
+type CommentList struct {
+	Comments []Comment `json:"comments"`
+	Total    int       `json:"total"`
+}
+
+// commentedTask returns the task a comment request is about. Tasks in the
+// trash are treated as missing, though their comments are kept until they
+// are purged so that restoring a task brings them back.
+func (h *Handlers) commentedTask(r *http.Request) (Task, error) {
+	task, err := h.store.Get(r.Context(), mux.Vars(r)["id"])
+	if err == nil && task.DeletedAt != nil {
+		err = ErrNotFound
+	}
+	return task, err
+}
+
+// getCommentsHandler lists the comments on a task, oldest first.
+func (h *Handlers) getCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	task, err := h.commentedTask(r)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	comments, err := h.store.Comments(r.Context(), task.ID)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	slices.SortFunc(comments, func(a, b Comment) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	respondJSON(w, http.StatusOK, CommentList{Comments: comments, Total: len(comments)})
+}
+
+// createCommentHandler adds a comment to a task.
+func (h *Handlers) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var input CommentInput
+	if err := decodeJSON(r, &input); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	comment := Comment{
+		ID:        uuid.New().String(),
+		Author:    strings.TrimSpace(input.Author),
+		Body:      strings.TrimSpace(input.Body),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := validateComment(comment); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	task, err := h.commentedTask(r)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	comment.TaskID = task.ID
+	if err := h.store.AddComment(r.Context(), comment); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, comment)
+}
+
+// validateComment checks the client-supplied fields of a comment.
+func validateComment(comment Comment) error {
+	if comment.Body == "" {
+		return errors.New("Body is required")
+	}
+	if err := validateLength("Body", comment.Body, maxCommentLength); err != nil {
+		return err
+	}
+	return validateLength("Author", comment.Author, maxAssigneeLength)
+}
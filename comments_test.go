@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommentHandlers(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Task"}
+	deletedAt := time.Now()
+	store.tasks["2"] = Task{ID: "2", Name: "Trashed", DeletedAt: &deletedAt}
+
+	for _, body := range []string{`{"author": " alice ", "body": " First "}`, `{"body": "Second"}`} {
+		req, _ := http.NewRequest("POST", "/tasks/1/comments", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusCreated, rr.Body)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/tasks/1/comments", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var list CommentList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if list.Total != 2 || list.Comments[0].Body != "First" || list.Comments[0].Author != "alice" || list.Comments[1].Body != "Second" {
+		t.Errorf("handler returned unexpected comments: %+v", list)
+	}
+	if c := list.Comments[0]; c.ID == "" || c.TaskID != "1" || c.CreatedAt.IsZero() {
+		t.Errorf("comment is missing server-managed fields: %+v", c)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"POST", "/tasks/1/comments", `{"body": "  "}`, http.StatusBadRequest},
+		{"POST", "/tasks/1/comments", `{"body": "` + strings.Repeat("x", maxCommentLength+1) + `"}`, http.StatusBadRequest},
+		{"POST", "/tasks/1/comments", `{"body": "Hi", "extra": true}`, http.StatusBadRequest},
+		{"POST", "/tasks/missing/comments", `{"body": "Hi"}`, http.StatusNotFound},
+		{"POST", "/tasks/2/comments", `{"body": "Hi"}`, http.StatusNotFound},
+		{"GET", "/tasks/missing/comments", "", http.StatusNotFound},
+		{"GET", "/tasks/2/comments", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != tt.want {
+			t.Errorf("%s %s with %.40s returned %v, want %v", tt.method, tt.path, tt.body, status, tt.want)
+		}
+	}
+}
+
+func TestPurgeTaskHandlerDeletesComments(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Task"}
+	store.comments["1"] = []Comment{{ID: "c1", TaskID: "1", Body: "Note"}}
+
+	req, _ := http.NewRequest("DELETE", "/tasks/1/purge", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+	if comments := store.comments["1"]; len(comments) != 0 {
+		t.Errorf("purge kept the task's comments: %+v", comments)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the server settings resolved from command-line flags and
+// environment variables.
+type Config struct {
+	Addr                  string
+	TLSCertFile           string // HTTPS is served when this and TLSKeyFile are set
+	TLSKeyFile            string
+	HTTPRedirectAddr      string // plain HTTP listener redirecting to HTTPS; off when empty
+	TasksFile             string
+	SQLitePath            string
+	DatabaseURL           string // PostgreSQL connection string
+	MultiTenant           bool   // scope tasks to the tenant named by each request's X-Tenant-ID header
+	SeedFile              string // JSON file of tasks an empty store is filled with on startup
+	CORSEnabled           bool
+	CORSAllowedOrigin     string
+	CORSMaxAge            time.Duration // how long browsers may cache a preflight response
+	SecurityHeaders       bool          // send X-Content-Type-Options, X-Frame-Options and Content-Security-Policy
+	SanitizeHTML          bool          // strip HTML from task names and descriptions before storing them
+	ContentSecurityPolicy string        // value of the Content-Security-Policy header
+	RateLimit             float64       // requests per second per client IP
+	RateLimitBurst        int
+	APIKey                string // bearer token clients must send; auth is off when empty
+	LogFormat             string // "json" or "text"
+	LogLevel              slog.Level
+	IdempotencyTTL        time.Duration // how long Idempotency-Key responses are remembered
+	MaxTasks              int           // 0 means unlimited
+	MaxTags               int           // most tags a task may have
+	MaxBodyBytes          int64         // largest request body accepted
+	RecurrenceInterval    time.Duration // how often completed recurring tasks are repeated
+	ReminderInterval      time.Duration // how often due reminders are checked for
+	ExpiryInterval        time.Duration // how often expired tasks are swept
+	WebhookURL            string        // task events are POSTed here; webhooks are off when empty
+	WebhookTimeout        time.Duration
+	ActivityLogSize       int           // number of recent changes kept for GET /tasks/activity
+	ActivityRetention     time.Duration // changes older than this are dropped from the log; 0 keeps them
+	IDScheme              string        // "uuid" or "sequential": how new task IDs are generated
+	StatusFormat          string        // "int" or "string": how task statuses are written in responses
+	ListFormat            string        // "object" or "array": the shape of GET /tasks responses
+	ProjectDelete         string        // "restrict" or "cascade": whether deleting a project deletes its tasks
+	PrettyJSON            bool          // indent JSON responses unless a request asks for ?pretty=false
+	ReadTimeout           time.Duration // longest time to read a request, body included
+	WriteTimeout          time.Duration // longest time to write a response; event streams are exempt
+	PollTimeout           time.Duration // longest a GET /tasks/poll waits for a change
+	RequestTimeout        time.Duration // longest a handler may spend on a request; events and polls are exempt
+	IdleTimeout           time.Duration // how long an idle keep-alive connection is kept open
+	DrainDelay            time.Duration // how long to keep serving, with /readyz failing, before shutting down
+	DefaultStatus         Status        // status of created tasks that do not give one
+	DefaultPriority       int           // priority of created tasks that do not give one
+
+	// Extra constraints on tasks, read from the file VALIDATION_RULES names.
+	ValidationRules ValidationRules
+
+	// With MultiTenant on, the tenants that may be served, any when empty,
+	// and how many of them are set up at most.
+	Tenants    []string
+	MaxTenants int
+}
+
+// loadConfig parses args (without the program name) and fills in anything not
+// set by a flag from the environment, then from defaults.
+func loadConfig(args []string) (Config, error) {
+	var cfg Config
+
+	fs := flag.NewFlagSet("ggtask-api", flag.ContinueOnError)
+	fs.StringVar(&cfg.Addr, "addr", "", "listen address (default $PORT or :8080)")
+	fs.StringVar(&cfg.SeedFile, "seed", os.Getenv("SEED_FILE"), "JSON file of tasks to fill an empty store with on startup (default $SEED_FILE)")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Addr == "" {
+		if port := os.Getenv("PORT"); port != "" {
+			cfg.Addr = ":" + port
+		} else {
+			cfg.Addr = ":8080"
+		}
+	}
+	cfg.TLSCertFile = os.Getenv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = os.Getenv("TLS_KEY_FILE")
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return Config{}, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	cfg.HTTPRedirectAddr = os.Getenv("HTTP_REDIRECT_ADDR")
+	if cfg.HTTPRedirectAddr != "" && cfg.TLSCertFile == "" {
+		return Config{}, fmt.Errorf("HTTP_REDIRECT_ADDR: requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	cfg.TasksFile = os.Getenv("TASKS_FILE")
+	cfg.SQLitePath = os.Getenv("SQLITE_PATH")
+	cfg.DatabaseURL = os.Getenv("DATABASE_URL")
+	cfg.CORSAllowedOrigin = envOr("CORS_ALLOWED_ORIGIN", "*")
+	cfg.ContentSecurityPolicy = envOr("CONTENT_SECURITY_POLICY", defaultContentSecurityPolicy)
+	cfg.APIKey = os.Getenv("API_KEY")
+
+	cfg.LogFormat = envOr("LOG_FORMAT", "json")
+	if cfg.LogFormat != "json" && cfg.LogFormat != "text" {
+		return Config{}, fmt.Errorf("LOG_FORMAT: must be json or text, got %q", cfg.LogFormat)
+	}
+	if err := cfg.LogLevel.UnmarshalText([]byte(envOr("LOG_LEVEL", "info"))); err != nil {
+		return Config{}, fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+
+	cfg.IDScheme = envOr("ID_SCHEME", "uuid")
+	if cfg.IDScheme != "uuid" && cfg.IDScheme != "sequential" {
+		return Config{}, fmt.Errorf("ID_SCHEME: must be uuid or sequential, got %q", cfg.IDScheme)
+	}
+
+	cfg.StatusFormat = envOr("STATUS_FORMAT", "int")
+	if cfg.StatusFormat != "int" && cfg.StatusFormat != "string" {
+		return Config{}, fmt.Errorf("STATUS_FORMAT: must be int or string, got %q", cfg.StatusFormat)
+	}
+
+	cfg.ListFormat = envOr("LIST_FORMAT", "object")
+	if cfg.ListFormat != "object" && cfg.ListFormat != "array" {
+		return Config{}, fmt.Errorf("LIST_FORMAT: must be object or array, got %q", cfg.ListFormat)
+	}
+
+	cfg.ProjectDelete = envOr("PROJECT_DELETE", "restrict")
+	if cfg.ProjectDelete != "restrict" && cfg.ProjectDelete != "cascade" {
+		return Config{}, fmt.Errorf("PROJECT_DELETE: must be restrict or cascade, got %q", cfg.ProjectDelete)
+	}
+
+	var err error
+	if cfg.CORSEnabled, err = envBool("CORS_ENABLED", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.SecurityHeaders, err = envBool("SECURITY_HEADERS", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.SanitizeHTML, err = envBool("SANITIZE_HTML", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.PrettyJSON, err = envBool("PRETTY_JSON", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.MultiTenant, err = envBool("MULTI_TENANT", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.MultiTenant && cfg.DatabaseURL != "" {
+		return Config{}, fmt.Errorf("MULTI_TENANT: not supported with DATABASE_URL")
+	}
+	if tenants := os.Getenv("TENANTS"); tenants != "" {
+		for _, id := range strings.Split(tenants, ",") {
+			id = strings.TrimSpace(id)
+			if !tenantIDPattern.MatchString(id) {
+				return Config{}, fmt.Errorf("TENANTS: %q is not a valid tenant ID", id)
+			}
+			cfg.Tenants = append(cfg.Tenants, id)
+		}
+	}
+	if cfg.MaxTenants, err = envInt("MAX_TENANTS", 100); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxTenants <= 0 {
+		return Config{}, fmt.Errorf("MAX_TENANTS: must be positive")
+	}
+	if cfg.DefaultStatus, err = parseStatus(envOr("DEFAULT_STATUS", "0")); err != nil {
+		return Config{}, fmt.Errorf("DEFAULT_STATUS: %w", err)
+	}
+	if cfg.DefaultPriority, err = envInt("DEFAULT_PRIORITY", 0); err != nil {
+		return Config{}, err
+	}
+	if !validPriority(cfg.DefaultPriority) {
+		return Config{}, fmt.Errorf("DEFAULT_PRIORITY: must be 0, 1 or 2")
+	}
+	if cfg.ValidationRules, err = loadValidationRules(os.Getenv("VALIDATION_RULES")); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.ValidationRules.checkStatus(cfg.DefaultStatus); err != nil {
+		return Config{}, fmt.Errorf("DEFAULT_STATUS: not allowed by VALIDATION_RULES")
+	}
+	if err := cfg.ValidationRules.checkPriority(cfg.DefaultPriority); err != nil {
+		return Config{}, fmt.Errorf("DEFAULT_PRIORITY: not allowed by VALIDATION_RULES")
+	}
+	if cfg.RateLimit, err = envFloat("RATE_LIMIT", 10); err != nil {
+		return Config{}, err
+	}
+	if cfg.RateLimitBurst, err = envInt("RATE_LIMIT_BURST", 20); err != nil {
+		return Config{}, err
+	}
+	if cfg.IdempotencyTTL, err = envDuration("IDEMPOTENCY_TTL", 24*time.Hour); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxTasks, err = envInt("MAX_TASKS", 10000); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxTasks < 0 {
+		return Config{}, fmt.Errorf("MAX_TASKS: must not be negative")
+	}
+	if cfg.MaxTags, err = envInt("MAX_TAGS", 20); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxTags < 1 {
+		return Config{}, fmt.Errorf("MAX_TAGS: must be positive")
+	}
+	maxBodyBytes, err := envInt("MAX_BODY_BYTES", 1<<20)
+	if err != nil {
+		return Config{}, err
+	}
+	if maxBodyBytes <= 0 {
+		return Config{}, fmt.Errorf("MAX_BODY_BYTES: must be positive")
+	}
+	cfg.MaxBodyBytes = int64(maxBodyBytes)
+	if cfg.RecurrenceInterval, err = envDuration("RECURRENCE_INTERVAL", time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.RecurrenceInterval <= 0 {
+		return Config{}, fmt.Errorf("RECURRENCE_INTERVAL: must be positive")
+	}
+	if cfg.ReminderInterval, err = envDuration("REMINDER_INTERVAL", time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReminderInterval <= 0 {
+		return Config{}, fmt.Errorf("REMINDER_INTERVAL: must be positive")
+	}
+	if cfg.ExpiryInterval, err = envDuration("EXPIRY_INTERVAL", time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.ExpiryInterval <= 0 {
+		return Config{}, fmt.Errorf("EXPIRY_INTERVAL: must be positive")
+	}
+	if cfg.ActivityLogSize, err = envInt("ACTIVITY_LOG_SIZE", 100); err != nil {
+		return Config{}, err
+	}
+	if cfg.ActivityLogSize < 0 {
+		return Config{}, fmt.Errorf("ACTIVITY_LOG_SIZE: must not be negative")
+	}
+	if cfg.ActivityRetention, err = envDuration("ACTIVITY_RETENTION", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.ActivityRetention < 0 {
+		return Config{}, fmt.Errorf("ACTIVITY_RETENTION: must not be negative")
+	}
+	for _, timeout := range []struct {
+		key string
+		dst *time.Duration
+		def time.Duration
+	}{
+		{"READ_TIMEOUT", &cfg.ReadTimeout, 15 * time.Second},
+		{"WRITE_TIMEOUT", &cfg.WriteTimeout, 15 * time.Second},
+		{"IDLE_TIMEOUT", &cfg.IdleTimeout, 60 * time.Second},
+		{"POLL_TIMEOUT", &cfg.PollTimeout, 30 * time.Second},
+		{"REQUEST_TIMEOUT", &cfg.RequestTimeout, 10 * time.Second},
+	} {
+		if *timeout.dst, err = envDuration(timeout.key, timeout.def); err != nil {
+			return Config{}, err
+		}
+		if *timeout.dst <= 0 {
+			return Config{}, fmt.Errorf("%s: must be positive", timeout.key)
+		}
+	}
+	if cfg.DrainDelay, err = envDuration("DRAIN_DELAY", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.DrainDelay < 0 {
+		return Config{}, fmt.Errorf("DRAIN_DELAY: must not be negative")
+	}
+	if cfg.CORSMaxAge, err = envDuration("CORS_MAX_AGE", 10*time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.CORSMaxAge < 0 {
+		return Config{}, fmt.Errorf("CORS_MAX_AGE: must not be negative")
+	}
+	cfg.WebhookURL = os.Getenv("WEBHOOK_URL")
+	if cfg.WebhookTimeout, err = envDuration("WEBHOOK_TIMEOUT", 5*time.Second); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// envOr returns the value of the environment variable key, or def if it is
+// unset or empty.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt parses the environment variable key as an integer, returning def if
+// it is unset or empty.
+func envInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return n, nil
+}
+
+// envBool parses the environment variable key as true or false, returning def
+// if it is unset or empty.
+func envBool(key string, def bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: must be true or false, got %q", key, v)
+	}
+	return b, nil
+}
+
+// envFloat parses the environment variable key as a float, returning def if
+// it is unset or empty.
+func envFloat(key string, def float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return f, nil
+}
+
+// envDuration parses the environment variable key as a duration such as "90s"
+// or "24h", returning def if it is unset or empty.
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	return d, nil
+}
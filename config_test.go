@@ -0,0 +1,325 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigAddr(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		port string
+		want string
+	}{
+		{"default", nil, "", ":8080"},
+		{"port env", nil, "9000", ":9000"},
+		{"flag overrides env", []string{"-addr", "127.0.0.1:7000"}, "9000", "127.0.0.1:7000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PORT", tt.port)
+			cfg, err := loadConfig(tt.args)
+			if err != nil {
+				t.Fatalf("loadConfig returned error: %v", err)
+			}
+			if cfg.Addr != tt.want {
+				t.Errorf("loadConfig resolved wrong address: got %q want %q", cfg.Addr, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigLogging(t *testing.T) {
+	t.Setenv("LOG_FORMAT", "text")
+	t.Setenv("LOG_LEVEL", "debug")
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.LogFormat != "text" || cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("loadConfig resolved wrong logging settings: got %q, %v", cfg.LogFormat, cfg.LogLevel)
+	}
+
+	t.Setenv("LOG_FORMAT", "xml")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted an invalid log format")
+	}
+}
+
+func TestLoadConfigStatusFormat(t *testing.T) {
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.StatusFormat != "int" {
+		t.Errorf("loadConfig resolved wrong default status format: got %q", cfg.StatusFormat)
+	}
+
+	t.Setenv("STATUS_FORMAT", "string")
+	if cfg, err := loadConfig(nil); err != nil || cfg.StatusFormat != "string" {
+		t.Errorf("loadConfig resolved wrong status format: got %q, %v", cfg.StatusFormat, err)
+	}
+
+	t.Setenv("STATUS_FORMAT", "bool")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted an invalid status format")
+	}
+}
+
+func TestLoadConfigMaxTags(t *testing.T) {
+	if cfg, err := loadConfig(nil); err != nil || cfg.MaxTags != 20 {
+		t.Errorf("loadConfig resolved wrong default max tags: got %d, %v", cfg.MaxTags, err)
+	}
+	t.Setenv("MAX_TAGS", "5")
+	if cfg, err := loadConfig(nil); err != nil || cfg.MaxTags != 5 {
+		t.Errorf("loadConfig resolved wrong max tags: got %d, %v", cfg.MaxTags, err)
+	}
+	t.Setenv("MAX_TAGS", "0")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted a max tags of 0")
+	}
+}
+
+func TestLoadConfigValidationRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(`{"require_description": true, "allowed_priorities": [1, 2]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VALIDATION_RULES", path)
+	t.Setenv("DEFAULT_PRIORITY", "1")
+	if cfg, err := loadConfig(nil); err != nil || !cfg.ValidationRules.RequireDescription {
+		t.Errorf("loadConfig resolved wrong validation rules: got %+v, %v", cfg.ValidationRules, err)
+	}
+
+	t.Setenv("DEFAULT_PRIORITY", "0")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted a default priority the rules do not allow")
+	}
+}
+
+func TestLoadConfigListFormat(t *testing.T) {
+	if cfg, err := loadConfig(nil); err != nil || cfg.ListFormat != "object" {
+		t.Errorf("loadConfig resolved wrong default list format: got %q, %v", cfg.ListFormat, err)
+	}
+	t.Setenv("LIST_FORMAT", "array")
+	if cfg, err := loadConfig(nil); err != nil || cfg.ListFormat != "array" {
+		t.Errorf("loadConfig resolved wrong list format: got %q, %v", cfg.ListFormat, err)
+	}
+	t.Setenv("LIST_FORMAT", "xml")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted an invalid list format")
+	}
+}
+
+func TestLoadConfigProjectDelete(t *testing.T) {
+	if cfg, err := loadConfig(nil); err != nil || cfg.ProjectDelete != "restrict" {
+		t.Errorf("loadConfig resolved wrong default project delete: got %q, %v", cfg.ProjectDelete, err)
+	}
+	t.Setenv("PROJECT_DELETE", "cascade")
+	if cfg, err := loadConfig(nil); err != nil || cfg.ProjectDelete != "cascade" {
+		t.Errorf("loadConfig resolved wrong project delete: got %q, %v", cfg.ProjectDelete, err)
+	}
+	t.Setenv("PROJECT_DELETE", "orphan")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted an invalid project delete")
+	}
+}
+
+func TestLoadConfigTimeouts(t *testing.T) {
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.ReadTimeout != 15*time.Second || cfg.WriteTimeout != 15*time.Second || cfg.IdleTimeout != time.Minute || cfg.PollTimeout != 30*time.Second {
+		t.Errorf("loadConfig resolved wrong default timeouts: got %v, %v, %v, %v", cfg.ReadTimeout, cfg.WriteTimeout, cfg.IdleTimeout, cfg.PollTimeout)
+	}
+
+	t.Setenv("WRITE_TIMEOUT", "30s")
+	if cfg, err := loadConfig(nil); err != nil || cfg.WriteTimeout != 30*time.Second {
+		t.Errorf("loadConfig resolved wrong write timeout: got %v, %v", cfg.WriteTimeout, err)
+	}
+
+	t.Setenv("IDLE_TIMEOUT", "0s")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted a zero idle timeout")
+	}
+}
+
+func TestLoadConfigActivityRetention(t *testing.T) {
+	if cfg, err := loadConfig(nil); err != nil || cfg.ActivityRetention != 0 {
+		t.Errorf("loadConfig resolved wrong default activity retention: got %v, %v", cfg.ActivityRetention, err)
+	}
+	t.Setenv("ACTIVITY_RETENTION", "24h")
+	if cfg, err := loadConfig(nil); err != nil || cfg.ActivityRetention != 24*time.Hour {
+		t.Errorf("loadConfig resolved wrong activity retention: got %v, %v", cfg.ActivityRetention, err)
+	}
+	t.Setenv("ACTIVITY_RETENTION", "-1h")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted a negative activity retention")
+	}
+}
+
+func TestLoadConfigDrainDelay(t *testing.T) {
+	if cfg, err := loadConfig(nil); err != nil || cfg.DrainDelay != 0 {
+		t.Errorf("loadConfig resolved wrong default drain delay: got %v, %v", cfg.DrainDelay, err)
+	}
+	t.Setenv("DRAIN_DELAY", "5s")
+	if cfg, err := loadConfig(nil); err != nil || cfg.DrainDelay != 5*time.Second {
+		t.Errorf("loadConfig resolved wrong drain delay: got %v, %v", cfg.DrainDelay, err)
+	}
+	t.Setenv("DRAIN_DELAY", "-1s")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted a negative drain delay")
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	t.Setenv("DEFAULT_STATUS", "completed")
+	t.Setenv("DEFAULT_PRIORITY", "2")
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.DefaultStatus != StatusCompleted || cfg.DefaultPriority != 2 {
+		t.Errorf("loadConfig resolved wrong task defaults: got %v, %v", cfg.DefaultStatus, cfg.DefaultPriority)
+	}
+
+	t.Setenv("DEFAULT_PRIORITY", "3")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted an invalid default priority")
+	}
+	t.Setenv("DEFAULT_PRIORITY", "")
+	t.Setenv("DEFAULT_STATUS", "done")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted an invalid default status")
+	}
+}
+
+func TestLoadConfigHeaders(t *testing.T) {
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if !cfg.CORSEnabled || cfg.CORSMaxAge != 10*time.Minute || !cfg.SecurityHeaders || cfg.ContentSecurityPolicy != defaultContentSecurityPolicy {
+		t.Errorf("loadConfig resolved wrong default header settings: %+v", cfg)
+	}
+
+	t.Setenv("CORS_ENABLED", "false")
+	t.Setenv("SECURITY_HEADERS", "false")
+	t.Setenv("CONTENT_SECURITY_POLICY", "default-src 'self'")
+	if cfg, err = loadConfig(nil); err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	if cfg.CORSEnabled || cfg.SecurityHeaders || cfg.ContentSecurityPolicy != "default-src 'self'" {
+		t.Errorf("loadConfig resolved wrong header settings: %+v", cfg)
+	}
+
+	t.Setenv("CORS_MAX_AGE", "-1s")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted a negative CORS_MAX_AGE")
+	}
+	t.Setenv("CORS_MAX_AGE", "")
+
+	t.Setenv("SECURITY_HEADERS", "maybe")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted an invalid SECURITY_HEADERS")
+	}
+}
+
+func TestLoadConfigIDScheme(t *testing.T) {
+	t.Setenv("ID_SCHEME", "sequential")
+	if cfg, err := loadConfig(nil); err != nil || cfg.IDScheme != "sequential" {
+		t.Errorf("loadConfig resolved wrong ID scheme: got %q, %v", cfg.IDScheme, err)
+	}
+	t.Setenv("ID_SCHEME", "snowflake")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted an invalid ID scheme")
+	}
+}
+
+func TestLoadConfigTLS(t *testing.T) {
+	t.Setenv("TLS_CERT_FILE", "cert.pem")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted a certificate without a key")
+	}
+	t.Setenv("TLS_KEY_FILE", "key.pem")
+	t.Setenv("HTTP_REDIRECT_ADDR", ":80")
+	if cfg, err := loadConfig(nil); err != nil || cfg.TLSCertFile != "cert.pem" || cfg.HTTPRedirectAddr != ":80" {
+		t.Errorf("loadConfig resolved wrong TLS settings: %+v, %v", cfg, err)
+	}
+	t.Setenv("TLS_CERT_FILE", "")
+	t.Setenv("TLS_KEY_FILE", "")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted HTTP_REDIRECT_ADDR without TLS")
+	}
+}
+
+func TestLoadConfigSanitizeHTML(t *testing.T) {
+	if cfg, err := loadConfig(nil); err != nil || cfg.SanitizeHTML {
+		t.Errorf("loadConfig turned on HTML sanitization by default: %v", err)
+	}
+	t.Setenv("SANITIZE_HTML", "true")
+	if cfg, err := loadConfig(nil); err != nil || !cfg.SanitizeHTML {
+		t.Errorf("loadConfig did not turn on HTML sanitization: %v", err)
+	}
+}
+
+func TestLoadConfigMultiTenant(t *testing.T) {
+	t.Setenv("MULTI_TENANT", "true")
+	if cfg, err := loadConfig(nil); err != nil || !cfg.MultiTenant {
+		t.Errorf("loadConfig did not turn on multi-tenancy: %v", err)
+	}
+	t.Setenv("DATABASE_URL", "postgres://localhost/tasks")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted MULTI_TENANT with DATABASE_URL")
+	}
+}
+
+func TestLoadConfigTenants(t *testing.T) {
+	cfg, err := loadConfig(nil)
+	if err != nil || cfg.Tenants != nil || cfg.MaxTenants != 100 {
+		t.Errorf("loadConfig resolved wrong tenant defaults: got %v, %d, %v", cfg.Tenants, cfg.MaxTenants, err)
+	}
+
+	t.Setenv("TENANTS", "acme, globex")
+	t.Setenv("MAX_TENANTS", "5")
+	cfg, err = loadConfig(nil)
+	if err != nil || !slices.Equal(cfg.Tenants, []string{"acme", "globex"}) || cfg.MaxTenants != 5 {
+		t.Errorf("loadConfig resolved wrong tenants: got %v, %d, %v", cfg.Tenants, cfg.MaxTenants, err)
+	}
+
+	t.Setenv("TENANTS", "acme,../etc")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted an invalid tenant ID")
+	}
+	t.Setenv("TENANTS", "")
+	t.Setenv("MAX_TENANTS", "0")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted MAX_TENANTS=0")
+	}
+}
+
+func TestLoadConfigSeedFile(t *testing.T) {
+	t.Setenv("SEED_FILE", "env.json")
+	if cfg, err := loadConfig(nil); err != nil || cfg.SeedFile != "env.json" {
+		t.Errorf("loadConfig resolved wrong seed file: got %q, %v", cfg.SeedFile, err)
+	}
+	if cfg, err := loadConfig([]string{"-seed", "flag.json"}); err != nil || cfg.SeedFile != "flag.json" {
+		t.Errorf("loadConfig resolved wrong seed file: got %q, %v", cfg.SeedFile, err)
+	}
+}
+
+func TestLoadConfigPrettyJSON(t *testing.T) {
+	if cfg, err := loadConfig(nil); err != nil || cfg.PrettyJSON {
+		t.Errorf("loadConfig turned on pretty JSON by default: %v", err)
+	}
+	t.Setenv("PRETTY_JSON", "yes")
+	if _, err := loadConfig(nil); err == nil {
+		t.Errorf("loadConfig accepted PRETTY_JSON=yes")
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImportResult summarizes a CSV import.
+type ImportResult struct {
+	Imported int           `json:"imported"`
+	Errors   []ImportError `json:"errors"`
+}
+
+// ImportError explains why a row of an imported CSV file was skipped. Row is
+// the line number in the file, counting the header as line 1.
+type ImportError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// taskCSVHeader names the columns of a task CSV file, in the order
+// taskCSVRecord writes them.
+var taskCSVHeader = []string{
+	"id", "name", "description", "status", "priority", "due_date", "tags", "parent_id",
+	"assignee", "recurrence", "archived", "position", "version", "created_at", "updated_at", "deleted_at",
+	"remind_at", "reminded_at", "expires_at", "depends_on", "project_id",
+}
+
+// taskCSVRecord formats a task as a CSV row. Tags and dependencies are joined
+// with commas and optional fields are left empty when unset.
+func taskCSVRecord(task Task) []string {
+	parentID := ""
+	if task.ParentID != nil {
+		parentID = *task.ParentID
+	}
+	return []string{
+		task.ID,
+		task.Name,
+		task.Description,
+		strconv.Itoa(int(task.Status)),
+		strconv.Itoa(task.Priority),
+		csvTime(task.DueDate),
+		strings.Join(task.Tags, ","),
+		parentID,
+		task.Assignee,
+		task.Recurrence,
+		strconv.FormatBool(task.Archived),
+		strconv.FormatFloat(task.Position, 'f', -1, 64),
+		strconv.Itoa(task.Version),
+		task.CreatedAt.Format(time.RFC3339),
+		task.UpdatedAt.Format(time.RFC3339),
+		csvTime(task.DeletedAt),
+		csvTime(task.RemindAt),
+		csvTime(task.RemindedAt),
+		csvTime(task.ExpiresAt),
+		strings.Join(task.DependsOn, ","),
+		task.ProjectID,
+	}
+}
+
+// taskCSVColumns maps the columns accepted on import to functions that parse
+// a cell into the task. Empty cells leave the field unset.
+var taskCSVColumns = map[string]func(task *Task, value string) error{
+	"id":          func(task *Task, v string) error { task.ID = v; return nil },
+	"name":        func(task *Task, v string) error { task.Name = v; return nil },
+	"description": func(task *Task, v string) error { task.Description = v; return nil },
+	"status": func(task *Task, v string) error {
+		if v == "" {
+			return nil
+		}
+		status, err := parseStatus(v)
+		if err != nil {
+			return err
+		}
+		task.Status = status
+		return nil
+	},
+	"priority": func(task *Task, v string) error {
+		if v == "" {
+			return nil
+		}
+		priority, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New("Priority must be 0, 1 or 2")
+		}
+		task.Priority = priority
+		return nil
+	},
+	"due_date": func(task *Task, v string) error {
+		if v == "" {
+			return nil
+		}
+		due, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return errors.New("Due date must be an RFC 3339 timestamp")
+		}
+		task.DueDate = &due
+		return nil
+	},
+	"remind_at": func(task *Task, v string) error {
+		if v == "" {
+			return nil
+		}
+		remindAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return errors.New("Remind at must be an RFC 3339 timestamp")
+		}
+		task.RemindAt = &remindAt
+		return nil
+	},
+	"expires_at": func(task *Task, v string) error {
+		if v == "" {
+			return nil
+		}
+		expiresAt, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return errors.New("Expires at must be an RFC 3339 timestamp")
+		}
+		task.ExpiresAt = &expiresAt
+		return nil
+	},
+	"tags": func(task *Task, v string) error {
+		if v != "" {
+			task.Tags = strings.Split(v, ",")
+		}
+		return nil
+	},
+	"assignee":   func(task *Task, v string) error { task.Assignee = v; return nil },
+	"recurrence": func(task *Task, v string) error { task.Recurrence = v; return nil },
+	"project_id": func(task *Task, v string) error { task.ProjectID = v; return nil },
+	"parent_id": func(task *Task, v string) error {
+		if v != "" {
+			task.ParentID = &v
+		}
+		return nil
+	},
+	"depends_on": func(task *Task, v string) error {
+		if v != "" {
+			task.DependsOn = strings.Split(v, ",")
+		}
+		return nil
+	},
+}
+
+// taskCSVIgnoredColumns are exported but managed by the server, so they are
+// skipped on import. This lets an export be imported as is.
+var taskCSVIgnoredColumns = map[string]bool{
+	"archived": true, "position": true, "version": true, "created_at": true, "updated_at": true, "deleted_at": true,
+	"reminded_at": true,
+}
+
+// csvTime formats an optional time for a CSV cell.
+func csvTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// exportTasksCSVHandler downloads the tasks as a CSV file, sorted by name. It
+// accepts the same filters as the task list.
+func (h *Handlers) exportTasksCSVHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r.URL.Query())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tasks, err := h.filteredTasks(r.Context(), filter)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	sortTasks(tasks, "name", false)
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="tasks.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write(taskCSVHeader)
+	for _, task := range tasks {
+		cw.Write(taskCSVRecord(task))
+	}
+	cw.Flush()
+}
+
+// importTasksCSVHandler creates tasks from a CSV file with a header row, sent
+// either as the raw request body or as the "file" field of a multipart form.
+// Each row is validated like a created task and stored on its own, so bad
+// rows are reported in the result without stopping the rest of the import.
+func (h *Handlers) importTasksCSVHandler(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if tooLarge(err) {
+			respondPayloadError(w, err)
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Upload the CSV file in a form field named file")
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	cr := csv.NewReader(body)
+	header, err := cr.Read()
+	if tooLarge(err) {
+		respondPayloadError(w, err)
+		return
+	}
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "CSV file must start with a header row")
+		return
+	}
+	parsers := make([]func(*Task, string) error, len(header))
+	hasName := false
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		if taskCSVIgnoredColumns[column] {
+			continue
+		}
+		parse, ok := taskCSVColumns[column]
+		if !ok {
+			respondError(w, http.StatusBadRequest, "Unknown column "+column)
+			return
+		}
+		parsers[i] = parse
+		hasName = hasName || column == "name"
+	}
+	if !hasName {
+		respondError(w, http.StatusBadRequest, "CSV file must have a name column")
+		return
+	}
+
+	remaining, err := h.remainingCapacity(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	position, err := h.nextPosition(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+
+	result := ImportResult{Errors: []ImportError{}}
+	now := time.Now().UTC()
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.Errors = append(result.Errors, ImportError{Row: parseErr.StartLine, Error: fmt.Sprintf("Malformed row: %v", parseErr.Err)})
+			continue
+		}
+		if tooLarge(err) {
+			// Rows before the limit have already been stored.
+			respondPayloadError(w, err)
+			return
+		}
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid CSV file")
+			return
+		}
+		row, _ := cr.FieldPos(0)
+
+		task, err := h.parseTaskRecord(parsers, record, now)
+		if err != nil {
+			result.Errors = append(result.Errors, ImportError{Row: row, Error: err.Error()})
+			continue
+		}
+		if remaining == 0 {
+			result.Errors = append(result.Errors, ImportError{Row: row, Error: h.capacityMessage()})
+			continue
+		}
+		if task.ParentID != nil {
+			err = h.validateParent(r.Context(), "", *task.ParentID)
+		}
+		if err == nil {
+			err = h.validateDependencies(r.Context(), "", task.DependsOn)
+		}
+		if err == nil {
+			err = h.validateProject(r.Context(), task.ProjectID)
+		}
+		if err == nil {
+			err = h.checkNewCompletion(r.Context(), task)
+		}
+		if err == nil {
+			task.Position = position
+			err = h.store.Create(r.Context(), task)
+		}
+		switch {
+		case err == nil:
+			h.publish(eventCreated, task)
+			result.Imported++
+			remaining--
+			position += positionGap
+		case errors.Is(err, ErrExists):
+			result.Errors = append(result.Errors, ImportError{Row: row, Error: "A task with this ID already exists"})
+		case errors.Is(err, ErrTaskLimit):
+			result.Errors = append(result.Errors, ImportError{Row: row, Error: h.capacityMessage()})
+		case errors.Is(err, ErrNoProject):
+			result.Errors = append(result.Errors, ImportError{Row: row, Error: errProjectNotFound.Error()})
+		case errors.Is(err, errParentNotFound), errors.Is(err, errSelfParent), errors.Is(err, errParentCycle),
+			errors.Is(err, errDependencyNotFound), errors.Is(err, errSelfDependency), errors.Is(err, errBlocked),
+			errors.Is(err, errProjectNotFound):
+			result.Errors = append(result.Errors, ImportError{Row: row, Error: err.Error()})
+		default:
+			h.storeError(r.Context(), w, err)
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, result)
+}
+
+// parseTaskRecord builds a new task from a CSV record, using parsers to read
+// each cell, and validates it like createTaskHandler does. The error message
+// is suitable for the import result.
+func (h *Handlers) parseTaskRecord(parsers []func(*Task, string) error, record []string, now time.Time) (Task, error) {
+	var task Task
+	for i, value := range record {
+		if parsers[i] == nil {
+			continue
+		}
+		if err := parsers[i](&task, value); err != nil {
+			return Task{}, err
+		}
+	}
+	h.sanitizeTask(&task)
+	normalizeTask(&task)
+	if err := validateTask(task); err != nil {
+		return Task{}, err
+	}
+	if err := h.prepareNewTask(&task, now); err != nil {
+		return Task{}, err
+	}
+	return task, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExportTasksCSVHandler(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Write report", Description: "Quarterly, with charts", Tags: []string{"work", "urgent"}}
+	store.tasks["2"] = Task{ID: "2", Name: "Buy milk", Status: 1, Tags: []string{"home"}}
+
+	req, _ := http.NewRequest("GET", "/tasks/export.csv?tag=work", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("handler returned wrong Content-Type: got %q", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="tasks.csv"` {
+		t.Errorf("handler returned wrong Content-Disposition: got %q", cd)
+	}
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("handler returned invalid CSV: %v", err)
+	}
+	if len(records) != 2 || !slices.Equal(records[0], taskCSVHeader) {
+		t.Fatalf("handler returned unexpected rows: got %v", records)
+	}
+	if row := records[1]; row[0] != "1" || row[2] != "Quarterly, with charts" || row[6] != "work,urgent" {
+		t.Errorf("handler returned unexpected row: got %v", row)
+	}
+}
+
+func TestImportTasksCSVHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	id := "9a1e1fa0-6a8e-4d3c-8d4b-0b5a3d1f2c7e"
+	body := "name,description,status,tags,id\n" +
+		"Write report,\"Quarterly, with charts\",0,\"work,urgent\",\n" +
+		",Missing name,0,,\n" +
+		"Buy milk,,1,home," + id + "\n" +
+		"Bad status,,7,,\n"
+	req, _ := http.NewRequest("POST", "/tasks/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var result ImportResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if result.Imported != 2 || len(result.Errors) != 2 || result.Errors[0].Row != 3 || result.Errors[1].Row != 5 {
+		t.Errorf("handler returned unexpected result: got %+v", result)
+	}
+	if task, ok := store.tasks[id]; !ok || task.Status != 1 || !slices.Equal(task.Tags, []string{"home"}) {
+		t.Errorf("handler did not import the row with an ID: got %+v", store.tasks)
+	}
+
+	// Importing the same file again reports the duplicate ID
+	req, _ = http.NewRequest("POST", "/tasks/import", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	if result.Imported != 1 || len(result.Errors) != 3 {
+		t.Errorf("handler returned unexpected result for re-import: got %+v", result)
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks/import", strings.NewReader("name,colour\nTask,red\n"))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for unknown column: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestImportTasksCSVHandlerProject(t *testing.T) {
+	router, store := setupRouter()
+	store.projects["p1"] = Project{ID: "p1", Name: "Release"}
+
+	req, _ := http.NewRequest("POST", "/tasks/import", strings.NewReader("name,project_id\nShip it,p1\nLost,missing\n"))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var result ImportResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if result.Imported != 1 || len(result.Errors) != 1 || result.Errors[0].Row != 3 || result.Errors[0].Error != "Project not found" {
+		t.Errorf("handler returned unexpected result: got %+v", result)
+	}
+	for _, task := range store.tasks {
+		if task.Name != "Ship it" || task.ProjectID != "p1" {
+			t.Errorf("handler imported %+v", task)
+		}
+	}
+}
+
+func TestImportTasksCSVHandlerMultipart(t *testing.T) {
+	router, store := setupRouter()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("file", "tasks.csv")
+	part.Write([]byte("name\nUploaded\n"))
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", "/tasks/import", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK || len(store.tasks) != 1 {
+		t.Errorf("handler did not import the uploaded file: got %v, %v", status, rr.Body.String())
+	}
+}
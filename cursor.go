@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+)
+
+// errInvalidCursor is returned for a ?cursor= that was not made by this
+// server for the requested sort.
+var errInvalidCursor = errors.New("Cursor is invalid or was made for another sort or order")
+
+// taskCursor is the decoded form of an opaque list cursor: the sort it was
+// made for and the sort key and ID of the last task on the page before. A
+// page that continues from it starts at the first task sorting after that
+// one, so tasks created or deleted meanwhile do not shift the pages.
+type taskCursor struct {
+	Sort string          `json:"sort"`
+	Desc bool            `json:"desc,omitempty"`
+	Last json.RawMessage `json:"last"` // the ID and sort field of the last task, as in selectFields
+}
+
+// encodeCursor returns a cursor continuing after last in the given sort.
+func encodeCursor(last Task, field string, desc bool) string {
+	// selectFields always returns an encodable object.
+	key, _ := json.Marshal(selectFields(last, map[string]bool{"id": true, field: true}))
+	data, _ := json.Marshal(taskCursor{Sort: field, Desc: desc, Last: key})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// parseCursor decodes a cursor, which must have been made for the given sort,
+// into the task it continues after. Only the ID and the sort field of the
+// returned task are set.
+func parseCursor(value, field string, desc bool) (Task, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return Task{}, errInvalidCursor
+	}
+	var cursor taskCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != field || cursor.Desc != desc {
+		return Task{}, errInvalidCursor
+	}
+	var last Task
+	if err := json.Unmarshal(cursor.Last, &last); err != nil || last.ID == "" {
+		return Task{}, errInvalidCursor
+	}
+	return last, nil
+}
+
+// pageAfter returns up to limit of the sorted tasks that come after last,
+// along with a cursor for the next page, or "" if there is none.
+func pageAfter(tasks []Task, last Task, field string, desc bool, limit int) ([]Task, string) {
+	compare := taskComparator(field, desc)
+	start := slices.IndexFunc(tasks, func(task Task) bool { return compare(task, last) > 0 })
+	if start < 0 {
+		return []Task{}, ""
+	}
+	return pageFrom(tasks, start, field, desc, limit)
+}
+
+// pageFrom returns up to limit of the sorted tasks starting at index start,
+// along with a cursor for the next page, or "" if there is none.
+func pageFrom(tasks []Task, start int, field string, desc bool, limit int) ([]Task, string) {
+	page := paginate(tasks, limit, start)
+	if len(page) == 0 || start+len(page) >= len(tasks) {
+		return page, ""
+	}
+	return page, encodeCursor(page[len(page)-1], field, desc)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestGetTasksHandlerCursor(t *testing.T) {
+	router, store := setupRouter()
+	for _, name := range []string{"b", "d", "f", "h", "j"} {
+		store.tasks[name] = Task{ID: name, Name: name}
+	}
+
+	get := func(query string) TaskList {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "/tasks?"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+		}
+		var list TaskList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		return list
+	}
+
+	var names []string
+	list := get("limit=2")
+	for {
+		for _, task := range list.Tasks {
+			names = append(names, task.Name)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		// A task created before the cursor does not shift the next page.
+		store.tasks["a"] = Task{ID: "a", Name: "a"}
+		list = get("limit=2&cursor=" + url.QueryEscape(list.NextCursor))
+	}
+	if want := []string{"b", "d", "f", "h", "j"}; !slices.Equal(names, want) {
+		t.Errorf("cursor pages returned %v, want %v", names, want)
+	}
+
+	list = get("limit=2&sort=created_at&order=desc")
+	if list.NextCursor == "" {
+		t.Fatalf("first page has no next_cursor")
+	}
+	for _, query := range []string{
+		"cursor=" + url.QueryEscape(list.NextCursor),
+		"sort=created_at&order=desc&offset=0&cursor=" + url.QueryEscape(list.NextCursor),
+		"cursor=not-a-cursor",
+	} {
+		req, _ := http.NewRequest("GET", "/tasks?"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("GET /tasks?%s returned wrong status code: got %v want %v", query, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Errors returned by validateDependencies.
+var (
+	errDependencyNotFound = errors.New("Dependency not found")
+	errSelfDependency     = errors.New("Task cannot depend on itself")
+	errDependencyCycle    = errors.New("Dependencies cannot form a cycle")
+)
+
+// errBlocked is returned when a task would be completed while tasks it
+// depends on are still incomplete.
+var errBlocked = errors.New("Task cannot be completed while its dependencies are incomplete")
+
+// normalizeDependsOn trims the task IDs of a dependency list.
+func normalizeDependsOn(ids []string) []string {
+	if ids == nil {
+		return nil
+	}
+	normalized := make([]string, len(ids))
+	for i, id := range ids {
+		normalized[i] = strings.TrimSpace(id)
+	}
+	return normalized
+}
+
+// validateDependsOn checks that a normalized dependency list has no empty or
+// repeated IDs. Whether the tasks exist is checked by validateDependencies.
+func validateDependsOn(ids []string) error {
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			return errors.New("Depends_on must not contain empty IDs")
+		}
+		if seen[id] {
+			return fmt.Errorf("Duplicate dependency %q", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// validateDependencies checks that the task with the given ID, empty for a
+// new task, can depend on the tasks in dependsOn: they must exist outside the
+// trash, and none may depend on the task itself, directly or not.
+func (h *Handlers) validateDependencies(ctx context.Context, id string, dependsOn []string) error {
+	if len(dependsOn) == 0 {
+		return nil
+	}
+	all, err := h.store.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	tasks := make(map[string]Task, len(all))
+	for _, task := range all {
+		tasks[task.ID] = task
+	}
+	for _, dep := range dependsOn {
+		if dep == id {
+			return errSelfDependency
+		}
+		if task, ok := tasks[dep]; !ok || task.DeletedAt != nil {
+			return fmt.Errorf("%w: %s", errDependencyNotFound, dep)
+		}
+	}
+	if id == "" {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	pending := slices.Clone(dependsOn)
+	for len(pending) > 0 {
+		dep := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if dep == id {
+			return errDependencyCycle
+		}
+		if !seen[dep] {
+			seen[dep] = true
+			pending = append(pending, tasks[dep].DependsOn...)
+		}
+	}
+	return nil
+}
+
+// dependencyError writes the response for an error returned by
+// validateDependencies.
+func (h *Handlers) dependencyError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errDependencyNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errSelfDependency), errors.Is(err, errDependencyCycle):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		h.storeError(ctx, w, err)
+	}
+}
+
+// incompleteTasks returns the IDs of the incomplete tasks outside the trash,
+// which are the ones that hold up tasks depending on them.
+func (h *Handlers) incompleteTasks(ctx context.Context) (map[string]bool, error) {
+	all, err := h.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	incomplete := make(map[string]bool)
+	for _, task := range all {
+		if task.Status == StatusIncomplete && task.DeletedAt == nil {
+			incomplete[task.ID] = true
+		}
+	}
+	return incomplete, nil
+}
+
+// completionBlocked returns errBlocked, naming the unmet dependencies, if
+// task is being completed, going from status was to its own, while any task
+// it depends on is in incomplete. Tasks that are already completed are left
+// alone, so they can still be edited after a dependency is reopened.
+func completionBlocked(was Status, task Task, incomplete map[string]bool) error {
+	if task.Status != StatusCompleted || was == StatusCompleted {
+		return nil
+	}
+	return blockedError(unmetDependencies(task, incomplete))
+}
+
+// unmetDependencies returns the IDs task depends on that are in incomplete.
+func unmetDependencies(task Task, incomplete map[string]bool) []string {
+	var unmet []string
+	for _, id := range task.DependsOn {
+		if incomplete[id] {
+			unmet = append(unmet, id)
+		}
+	}
+	return unmet
+}
+
+// blockedError returns errBlocked naming the unmet dependencies, or nil if
+// there are none.
+func blockedError(unmet []string) error {
+	if len(unmet) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errBlocked, strings.Join(unmet, ", "))
+}
+
+// blockingTasks returns the incomplete tasks for a completion of task to be
+// checked against, or nil when it cannot be blocked, sparing the lookup.
+func (h *Handlers) blockingTasks(ctx context.Context, task Task) (map[string]bool, error) {
+	if task.Status != StatusCompleted || len(task.DependsOn) == 0 {
+		return nil, nil
+	}
+	return h.incompleteTasks(ctx)
+}
+
+// patchBlockingTasks is blockingTasks for a patch, which can complete a task
+// without changing its dependencies.
+func (h *Handlers) patchBlockingTasks(ctx context.Context, patch TaskPatch) (map[string]bool, error) {
+	if patch.Status == nil || *patch.Status != StatusCompleted {
+		return nil, nil
+	}
+	return h.incompleteTasks(ctx)
+}
+
+// checkNewCompletion returns errBlocked if a new task is being created
+// completed while tasks it depends on are incomplete.
+func (h *Handlers) checkNewCompletion(ctx context.Context, task Task) error {
+	incomplete, err := h.blockingTasks(ctx, task)
+	if err != nil {
+		return err
+	}
+	return completionBlocked(StatusIncomplete, task, incomplete)
+}
+
+// getBlockersHandler lists the unmet dependencies of a task: the tasks it
+// depends on that are incomplete and outside the trash, sorted by name.
+func (h *Handlers) getBlockersHandler(w http.ResponseWriter, r *http.Request) {
+	task, err := h.store.Get(r.Context(), mux.Vars(r)["id"])
+	if err == nil && task.DeletedAt != nil {
+		err = ErrNotFound
+	}
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+
+	blockers := []Task{}
+	for _, id := range task.DependsOn {
+		dep, err := h.store.Get(r.Context(), id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			h.storeError(r.Context(), w, err)
+			return
+		}
+		if dep.Status == StatusIncomplete && dep.DeletedAt == nil {
+			blockers = append(blockers, dep)
+		}
+	}
+	sortTasks(blockers, "name", false)
+	respondJSON(w, http.StatusOK, TaskList{Tasks: blockers, Total: len(blockers)})
+}
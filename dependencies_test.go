@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSetDependencies(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["a"] = Task{ID: "a", Name: "A"}
+	store.tasks["b"] = Task{ID: "b", Name: "B", DependsOn: []string{"a"}}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/tasks", `{"name": "New", "depends_on": [" a ", "b"]}`, http.StatusCreated},
+		{"POST", "/tasks", `{"name": "New", "depends_on": ["missing"]}`, http.StatusNotFound},
+		{"POST", "/tasks", `{"name": "New", "depends_on": ["a", "a"]}`, http.StatusBadRequest},
+		{"PATCH", "/tasks/a", `{"depends_on": ["a"]}`, http.StatusBadRequest},
+		// b already depends on a.
+		{"PATCH", "/tasks/a", `{"depends_on": ["b"]}`, http.StatusBadRequest},
+		{"PATCH", "/tasks", `{"set": {"depends_on": ["b"]}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != tt.want {
+			t.Errorf("%s %s %s returned wrong status code: got %v want %v: %s", tt.method, tt.path, tt.body, status, tt.want, rr.Body)
+		}
+	}
+	if task := store.tasks["a"]; len(task.DependsOn) != 0 {
+		t.Errorf("rejected dependencies were stored: %+v", task)
+	}
+}
+
+func TestCompletionBlockedByDependencies(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["a"] = Task{ID: "a", Name: "A"}
+	store.tasks["b"] = Task{ID: "b", Name: "B", DependsOn: []string{"a"}}
+
+	req, _ := http.NewRequest("PATCH", "/tasks/b", strings.NewReader(`{"status": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusConflict {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+	if !strings.Contains(rr.Body.String(), "dependencies are incomplete: a") {
+		t.Errorf("handler returned unexpected body: %s", rr.Body)
+	}
+	if store.tasks["b"].Status != StatusIncomplete {
+		t.Errorf("blocked task was completed")
+	}
+
+	// Completing the dependency unblocks the task.
+	a := store.tasks["a"]
+	a.Status = StatusCompleted
+	store.tasks["a"] = a
+	req, _ = http.NewRequest("PATCH", "/tasks/b", strings.NewReader(`{"status": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+}
+
+func TestCompleteAllRespectsDependencies(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["a"] = Task{ID: "a", Name: "A"}
+	store.tasks["b"] = Task{ID: "b", Name: "B", DependsOn: []string{"a"}}
+	store.tasks["c"] = Task{ID: "c", Name: "C", DependsOn: []string{"b"}}
+
+	req, _ := http.NewRequest("POST", "/tasks/complete-all", strings.NewReader(`{"ids": ["b", "c"]}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusConflict)
+	}
+
+	// Without a list, a chain completed together counts as met.
+	req, _ = http.NewRequest("POST", "/tasks/complete-all", strings.NewReader(""))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if store.tasks[id].Status != StatusCompleted {
+			t.Errorf("task %s was not completed", id)
+		}
+	}
+}
+
+func TestGetBlockersHandler(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["a"] = Task{ID: "a", Name: "Write"}
+	store.tasks["b"] = Task{ID: "b", Name: "Done", Status: StatusCompleted}
+	store.tasks["c"] = Task{ID: "c", Name: "Review"}
+	store.tasks["d"] = Task{ID: "d", Name: "Publish", DependsOn: []string{"a", "b", "c", "purged"}}
+
+	req, _ := http.NewRequest("GET", "/tasks/d/blockers", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	var ids []string
+	for _, task := range list.Tasks {
+		ids = append(ids, task.ID)
+	}
+	if want := []string{"c", "a"}; !slices.Equal(ids, want) || list.Total != 2 {
+		t.Errorf("handler returned blockers %v, want %v", ids, want)
+	}
+
+	req, _ = http.NewRequest("GET", "/tasks/missing/blockers", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// errDryRun is returned from a store update callback to abandon the changes
+// it has made once a dry run has seen them. Stores discard the changes of a
+// callback that fails, so nothing computed under their lock is written.
+var errDryRun = errors.New("dry run")
+
+// parseDryRun reads the dry_run query parameter of a mutating request. A dry
+// run validates the request and computes its result, which is returned with
+// 200 OK, but stores nothing and publishes no events.
+func parseDryRun(r *http.Request) (bool, error) {
+	dryRun, err := parseBoolParam(r.URL.Query().Get("dry_run"))
+	if err != nil {
+		return false, errors.New("Dry_run must be true or false")
+	}
+	return dryRun, nil
+}
+
+// update is h.store.Update, except that in a dry run it returns the task as
+// fn leaves it without storing it.
+func (h *Handlers) update(ctx context.Context, id string, dryRun bool, fn func(*Task) error) (Task, error) {
+	if !dryRun {
+		return h.store.Update(ctx, id, fn)
+	}
+	var preview Task
+	_, err := h.store.Update(ctx, id, func(task *Task) error {
+		if err := fn(task); err != nil {
+			return err
+		}
+		preview = *task
+		return errDryRun
+	})
+	if !errors.Is(err, errDryRun) {
+		return Task{}, err
+	}
+	return preview, nil
+}
+
+// updateMatching is h.store.UpdateMatching, except that in a dry run it
+// returns the tasks as fn leaves them without storing them. The preview is
+// computed on copies of the tasks, so the store is only read.
+func (h *Handlers) updateMatching(ctx context.Context, dryRun bool, match func(Task) bool, fn func(*Task) error) ([]Task, error) {
+	if !dryRun {
+		return h.store.UpdateMatching(ctx, match, fn)
+	}
+	tasks, err := h.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	preview := []Task{}
+	for _, task := range tasks {
+		if !match(task) {
+			continue
+		}
+		if err := fn(&task); err != nil {
+			return nil, err
+		}
+		preview = append(preview, task)
+	}
+	return preview, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Existing", Version: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Another", Version: 1}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"POST", "/tasks?dry_run=true", `{"name": "New"}`},
+		{"POST", "/tasks/bulk?dry_run=true", `[{"name": "New"}, {"name": "Newer"}]`},
+		{"PUT", "/tasks/1?dry_run=true", `{"name": "Replaced", "version": 1}`},
+		{"PUT", "/tasks/0b6f4a7e-2b0c-4c57-9a53-1f8d2f5d0c11?dry_run=true", `{"name": "Created"}`},
+		{"PATCH", "/tasks/1?dry_run=true", `{"name": "Patched"}`},
+		{"PATCH", "/tasks?dry_run=true", `{"set": {"priority": 2}}`},
+		{"POST", "/tasks/complete-all?dry_run=true", ``},
+		{"DELETE", "/tasks/1?dry_run=true", ``},
+		{"DELETE", "/tasks/1/purge?dry_run=true", ``},
+		{"DELETE", "/tasks?dry_run=true", ``},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("%s %s returned wrong status code: got %v want %v: %s", tt.method, tt.path, status, http.StatusOK, rr.Body)
+		}
+		if len(store.tasks) != 2 || store.tasks["1"].Name != "Existing" || store.tasks["1"].Version != 1 ||
+			store.tasks["1"].Status != 0 || store.tasks["1"].DeletedAt != nil || store.tasks["2"].Priority != 0 {
+			t.Fatalf("%s %s changed the store: got %+v", tt.method, tt.path, store.tasks)
+		}
+	}
+}
+
+func TestDryRunPreview(t *testing.T) {
+	router, store := setupRouter()
+	past := time.Now().Add(-time.Hour)
+	store.tasks["1"] = Task{ID: "1", Name: "Overdue", DueDate: &past, Version: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Not due", Version: 1}
+
+	req, _ := http.NewRequest("PATCH", "/tasks?dry_run=true", strings.NewReader(`{"filter": {"overdue": true}, "set": {"priority": 2}}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var preview struct {
+		Updated int    `json:"updated"`
+		Tasks   []Task `json:"tasks"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &preview); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if preview.Updated != 1 || len(preview.Tasks) != 1 || preview.Tasks[0].ID != "1" ||
+		preview.Tasks[0].Priority != 2 || preview.Tasks[0].Version != 2 {
+		t.Errorf("dry run returned wrong preview: got %+v", preview)
+	}
+
+	// Invalid requests are still rejected
+	req, _ = http.NewRequest("PATCH", "/tasks/1?dry_run=true", strings.NewReader(`{"name": ""}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for an invalid dry run: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/tasks/1?dry_run=maybe", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for an invalid dry_run: got %v want %v", status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// duplicateNamePrefix is put before the source task's name when a duplicate
+// request does not name the copy.
+const duplicateNamePrefix = "Copy of "
+
+// TaskDuplicate is the optional body of a duplicate request.
+type TaskDuplicate struct {
+	Name string `json:"name"`
+}
+
+// duplicateTaskHandler creates a new task from the fields of an existing one.
+// The copy starts out incomplete, unarchived and last in the manual order,
+// with fresh timestamps; comments are not copied.
+func (h *Handlers) duplicateTaskHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var input TaskDuplicate
+	if hasBody(r) {
+		if err := decodeJSON(r, &input); err != nil {
+			respondPayloadError(w, err)
+			return
+		}
+	}
+
+	source, err := h.store.Get(r.Context(), mux.Vars(r)["id"])
+	if err == nil && source.DeletedAt != nil {
+		err = ErrNotFound
+	}
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+
+	task := Task{
+		Name:        duplicateNamePrefix + source.Name,
+		Description: source.Description,
+		Status:      StatusIncomplete,
+		Priority:    source.Priority,
+		DueDate:     source.DueDate,
+		RemindAt:    source.RemindAt,
+		ExpiresAt:   source.ExpiresAt,
+		Tags:        slices.Clone(source.Tags),
+		ParentID:    source.ParentID,
+		DependsOn:   slices.Clone(source.DependsOn),
+		Assignee:    source.Assignee,
+		Recurrence:  source.Recurrence,
+		ProjectID:   source.ProjectID,
+	}
+	if name := strings.TrimSpace(h.sanitize(input.Name)); name != "" {
+		task.Name = name
+	}
+	if err := validateTask(task); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if task.ParentID != nil {
+		if err := h.validateParent(r.Context(), "", *task.ParentID); err != nil {
+			h.parentError(r.Context(), w, err)
+			return
+		}
+	}
+
+	if err := h.prepareNewTask(&task, time.Now().UTC()); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.checkCapacity(r.Context(), w, 1) {
+		return
+	}
+	if task.Position, err = h.nextPosition(r.Context()); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, task)
+		return
+	}
+	if err := h.store.Create(r.Context(), task); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventCreated, task)
+	w.Header().Set("Location", "/tasks/"+task.ID)
+	respondJSON(w, http.StatusCreated, task)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDuplicateTaskHandler(t *testing.T) {
+	router, store := setupRouter()
+	due := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	store.tasks["1"] = Task{ID: "1", Name: "Report", Description: "Quarterly", Status: StatusCompleted, Priority: 2, DueDate: &due,
+		Tags: []string{"work"}, Assignee: "alice", Archived: true, Position: 1024, Version: 4}
+
+	req, _ := http.NewRequest("POST", "/tasks/1/duplicate", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusCreated, rr.Body)
+	}
+	var task Task
+	if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if task.ID == "1" || task.Name != "Copy of Report" || task.Description != "Quarterly" || task.Priority != 2 ||
+		task.DueDate == nil || !task.DueDate.Equal(due) || len(task.Tags) != 1 || task.Assignee != "alice" {
+		t.Errorf("duplicate did not copy the source's fields: %+v", task)
+	}
+	if task.Status != StatusIncomplete || task.Archived || task.Version != 1 || task.Position <= 1024 || task.CreatedAt.IsZero() {
+		t.Errorf("duplicate did not reset its state: %+v", task)
+	}
+	if location := rr.Header().Get("Location"); location != "/tasks/"+task.ID {
+		t.Errorf("handler set wrong Location: got %q", location)
+	}
+	if _, ok := store.tasks[task.ID]; !ok {
+		t.Errorf("duplicate was not stored")
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks/1/duplicate", strings.NewReader(`{"name": " Report v2 "}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil || task.Name != "Report v2" {
+		t.Errorf("duplicate ignored the given name: %+v, %v", task, err)
+	}
+}
+
+func TestDuplicateTaskHandlerErrors(t *testing.T) {
+	router, store := setupRouter()
+	deletedAt := time.Now()
+	store.tasks["trashed"] = Task{ID: "trashed", Name: "Trashed", DeletedAt: &deletedAt}
+	store.tasks["long"] = Task{ID: "long", Name: strings.Repeat("x", maxNameLength)}
+
+	tests := []struct {
+		id   string
+		want int
+	}{
+		{"missing", http.StatusNotFound},
+		{"trashed", http.StatusNotFound},
+		{"long", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/tasks/"+tt.id+"/duplicate", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != tt.want {
+			t.Errorf("duplicating %s returned %v, want %v", tt.id, status, tt.want)
+		}
+	}
+	if len(store.tasks) != 2 {
+		t.Errorf("failed duplicates stored tasks: %d tasks", len(store.tasks))
+	}
+}
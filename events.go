@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Task event types.
+const (
+	eventCreated = "created"
+	eventUpdated = "updated"
+	eventDeleted = "deleted"
+	// eventReminder announces that a task's reminder time has come.
+	eventReminder = "reminder"
+)
+
+// TaskEvent describes a change made to a task.
+type TaskEvent struct {
+	Type string
+	Task Task
+}
+
+// eventBroker fans task events out to subscribers. A nil broker discards
+// everything published to it.
+type eventBroker struct {
+	mu          sync.Mutex
+	subscribers map[chan TaskEvent]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{subscribers: make(map[chan TaskEvent]struct{})}
+}
+
+// subscribe registers a new subscriber that buffers up to size events.
+// Callers must unsubscribe when done.
+func (b *eventBroker) subscribe(size int) chan TaskEvent {
+	ch := make(chan TaskEvent, size)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *eventBroker) unsubscribe(ch chan TaskEvent) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+// publish delivers an event to every subscriber without blocking. A
+// subscriber whose buffer is full misses the event rather than stalling the
+// request that caused it.
+func (b *eventBroker) publish(eventType string, tasks ...Task) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, task := range tasks {
+		event := TaskEvent{Type: eventType, Task: task}
+		for ch := range b.subscribers {
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
+
+// taskEventsHandler streams task changes to the client as Server-Sent Events
+// until it disconnects. Each event is named after its type and carries the
+// task as JSON data. The stream is exempt from the server's write timeout,
+// which would otherwise cut it off.
+func (h *Handlers) taskEventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	ch := h.events.subscribe(16)
+	defer h.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-ch:
+			data, err := json.Marshal(event.Task)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTaskEventsHandler(t *testing.T) {
+	router, _ := setupRouter()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/tasks/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not subscribe to events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("handler returned wrong Content-Type: got %q", ct)
+	}
+
+	taskPayload := []byte(`{"name": "Streamed Task", "status": 0}`)
+	if _, err := http.Post(server.URL+"/tasks", "application/json", bytes.NewBuffer(taskPayload)); err != nil {
+		t.Fatalf("Could not create task: %v", err)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	eventLine, _ := reader.ReadString('\n')
+	dataLine, _ := reader.ReadString('\n')
+	if eventLine != "event: created\n" {
+		t.Errorf("handler sent wrong event line: got %q", eventLine)
+	}
+	if !strings.HasPrefix(dataLine, "data: ") || !strings.Contains(dataLine, "Streamed Task") {
+		t.Errorf("handler sent wrong data line: got %q", dataLine)
+	}
+}
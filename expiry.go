@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runExpiry removes expired tasks every interval until ctx is done.
+func (h *Handlers) runExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := h.sweepExpired(ctx, now.UTC()); err != nil {
+				h.logger.Error("Failed to remove expired tasks", "error", err)
+			}
+		}
+	}
+}
+
+// sweepExpired permanently removes every task, in the trash or not, whose
+// expiry time has passed. As with a purge, a task is kept while it has
+// subtasks that are not being removed with it; it goes in a later sweep once
+// they have.
+func (h *Handlers) sweepExpired(ctx context.Context, now time.Time) error {
+	all, err := h.store.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	expiring := make(map[string]bool)
+	for _, task := range all {
+		if task.expired(now) {
+			expiring[task.ID] = true
+		}
+	}
+	// Keeping a parent can keep its own parent in turn, so repeat until
+	// nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, task := range all {
+			if task.ParentID != nil && !expiring[task.ID] && expiring[*task.ParentID] {
+				delete(expiring, *task.ParentID)
+				changed = true
+			}
+		}
+	}
+	if len(expiring) == 0 {
+		return nil
+	}
+
+	removed, err := h.store.DeleteMatching(ctx, func(task Task) bool {
+		return expiring[task.ID] && task.expired(now)
+	})
+	if err != nil {
+		return err
+	}
+	for _, task := range removed {
+		h.logger.Info("Task expired", "task_id", task.ID, "name", task.Name, "expires_at", *task.ExpiresAt)
+	}
+	h.publish(eventDeleted, removed...)
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSweepExpired(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, events: newEventBroker(), logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ch := h.events.subscribe(16)
+	defer h.events.unsubscribe(ch)
+
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	parentID, keptParentID := "parent", "kept-parent"
+	store.tasks["expired"] = Task{ID: "expired", Name: "Expired", ExpiresAt: &past}
+	store.tasks["trashed"] = Task{ID: "trashed", Name: "Trashed", ExpiresAt: &past, DeletedAt: &past}
+	store.tasks["future"] = Task{ID: "future", Name: "Future", ExpiresAt: &future}
+	store.tasks["none"] = Task{ID: "none", Name: "No expiry"}
+	// An expired parent goes along with its expired subtask...
+	store.tasks["parent"] = Task{ID: "parent", Name: "Parent", ExpiresAt: &past}
+	store.tasks["child"] = Task{ID: "child", Name: "Child", ParentID: &parentID, ExpiresAt: &past}
+	// ...but not while a subtask stays behind.
+	store.tasks["kept-parent"] = Task{ID: "kept-parent", Name: "Kept parent", ExpiresAt: &past}
+	store.tasks["kept-child"] = Task{ID: "kept-child", Name: "Kept child", ParentID: &keptParentID}
+	store.comments["expired"] = []Comment{{ID: "c1", TaskID: "expired", Body: "Gone too"}}
+
+	if err := h.sweepExpired(context.Background(), now); err != nil {
+		t.Fatalf("sweepExpired returned error: %v", err)
+	}
+	for _, id := range []string{"expired", "trashed", "parent", "child"} {
+		if _, ok := store.tasks[id]; ok {
+			t.Errorf("expired task %s was not removed", id)
+		}
+	}
+	for _, id := range []string{"future", "none", "kept-parent", "kept-child"} {
+		if _, ok := store.tasks[id]; !ok {
+			t.Errorf("task %s was removed", id)
+		}
+	}
+	if len(store.comments["expired"]) != 0 {
+		t.Errorf("sweepExpired kept the comments of a removed task")
+	}
+	if len(ch) != 4 {
+		t.Errorf("sweepExpired published %d events, want 4", len(ch))
+	}
+	for len(ch) > 0 {
+		if event := <-ch; event.Type != eventDeleted {
+			t.Errorf("sweepExpired published a %s event", event.Type)
+		}
+	}
+}
+
+func TestListLeavesOutExpiredTasks(t *testing.T) {
+	router, store := setupRouter()
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	store.tasks["1"] = Task{ID: "1", Name: "Expired", ExpiresAt: &past}
+	store.tasks["2"] = Task{ID: "2", Name: "Expiring later", ExpiresAt: &future}
+
+	req, _ := http.NewRequest("GET", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var list TaskList
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("could not decode response: %v", err)
+	}
+	if list.Total != 1 || list.Tasks[0].ID != "2" {
+		t.Errorf("list returned %+v, want only the unexpired task", list.Tasks)
+	}
+}
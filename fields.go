@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// taskFieldNames is the set of JSON field names of a Task, which are the
+// names ?fields= accepts.
+var taskFieldNames = jsonFieldNames(reflect.TypeOf(Task{}))
+
+// jsonFieldNames returns the names the fields of struct type t have in JSON.
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// parseFields reads the comma-separated ?fields= parameter of a task GET. It
+// returns nil, meaning every field, when the parameter is empty. The ID is
+// always selected so clients can tell the tasks apart.
+func parseFields(value string) (map[string]bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	fields := map[string]bool{"id": true}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if !taskFieldNames[name] {
+			return nil, fmt.Errorf("Unknown field %q", name)
+		}
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// sparseTaskList is a TaskList whose tasks have been through selectFields.
+type sparseTaskList struct {
+	Tasks      []any  `json:"tasks"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// selectListFields applies selectFields to every task of a list.
+func selectListFields(list TaskList, fields map[string]bool) any {
+	if fields == nil {
+		return list
+	}
+	sparse := sparseTaskList{Tasks: make([]any, 0, len(list.Tasks)), Total: list.Total, NextCursor: list.NextCursor}
+	for _, task := range list.Tasks {
+		sparse.Tasks = append(sparse.Tasks, selectFields(task, fields))
+	}
+	return sparse
+}
+
+// taskFields returns the fields of task as written in responses, by name.
+func taskFields(task Task) map[string]json.RawMessage {
+	// A Task always encodes to an object, so neither call can fail.
+	data, _ := json.Marshal(task)
+	var fields map[string]json.RawMessage
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+// selectFields returns task as a JSON object holding only the given fields,
+// or the whole task if fields is nil.
+func selectFields(task Task, fields map[string]bool) any {
+	if fields == nil {
+		return task
+	}
+	object := taskFields(task)
+	for name := range object {
+		if !fields[name] {
+			delete(object, name)
+		}
+	}
+	return object
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestParseFields(t *testing.T) {
+	if fields, err := parseFields(""); err != nil || fields != nil {
+		t.Errorf("parseFields of nothing returned %v, %v, want every field", fields, err)
+	}
+	fields, err := parseFields("name, status")
+	if err != nil || len(fields) != 3 || !fields["id"] || !fields["name"] || !fields["status"] {
+		t.Errorf("parseFields returned %v, %v", fields, err)
+	}
+	for _, value := range []string{"nmae", "name,", "Name"} {
+		if _, err := parseFields(value); err == nil {
+			t.Errorf("parseFields accepted %q", value)
+		}
+	}
+}
+
+func TestGetTasksHandlerFields(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Task", Description: "Long text", Priority: 2}
+
+	req, _ := http.NewRequest("GET", "/tasks?fields=name,priority", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+	var list struct {
+		Tasks []map[string]any `json:"tasks"`
+		Total int              `json:"total"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if list.Total != 1 || len(list.Tasks) != 1 {
+		t.Fatalf("handler returned unexpected list: %+v", list)
+	}
+	var keys []string
+	for key := range list.Tasks[0] {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if want := []string{"id", "name", "priority"}; !slices.Equal(keys, want) {
+		t.Errorf("handler returned fields %v, want %v", keys, want)
+	}
+
+	req, _ = http.NewRequest("GET", "/tasks/1?fields=description", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var task map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if len(task) != 2 || task["id"] != "1" || task["description"] != "Long text" {
+		t.Errorf("handler returned unexpected task: %v", task)
+	}
+
+	for _, path := range []string{"/tasks?fields=nmae", "/tasks/1?fields=nmae"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("GET %s returned %v, want %v", path, status, http.StatusBadRequest)
+		}
+	}
+}
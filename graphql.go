@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// graphQLRequest is the body of a POST /graphql.
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+// graphQLHandler returns the handler for POST /graphql, which offers the tasks
+// through a GraphQL schema as an alternative to the REST endpoints. It
+// resolves against the same store, validates like the REST endpoints and
+// publishes the same events. As is usual for GraphQL, errors in a query that
+// could be parsed are reported in the body of a 200 response.
+func (h *Handlers) graphQLHandler() http.HandlerFunc {
+	schema := h.graphQLSchema()
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphQLRequest
+		if err := decodeJSON(r, &req); err != nil {
+			respondPayloadError(w, err)
+			return
+		}
+		if strings.TrimSpace(req.Query) == "" {
+			respondError(w, http.StatusBadRequest, "Query is required")
+			return
+		}
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        r.Context(),
+		})
+		respondJSON(w, http.StatusOK, result)
+	}
+}
+
+// graphQLStatus is the GraphQL form of a task status.
+var graphQLStatus = graphql.NewEnum(graphql.EnumConfig{
+	Name: "TaskStatus",
+	Values: graphql.EnumValueConfigMap{
+		"INCOMPLETE": &graphql.EnumValueConfig{Value: StatusIncomplete},
+		"COMPLETED":  &graphql.EnumValueConfig{Value: StatusCompleted},
+	},
+})
+
+// graphQLTaskField is a field of the GraphQL Task type.
+type graphQLTaskField struct {
+	name   string
+	json   string // name of the field in the REST representation
+	output graphql.Output
+	input  graphql.Input // type the field takes in inputs; nil if it cannot be set
+	get    func(Task) any
+}
+
+// graphQLTaskFields are the fields of the GraphQL Task type. Inputs are
+// rewritten with their REST names and checked against the same JSON schemas
+// as REST payloads, so both surfaces accept exactly the same tasks.
+var graphQLTaskFields = []graphQLTaskField{
+	{"id", "id", graphql.NewNonNull(graphql.ID), nil, func(t Task) any { return t.ID }},
+	{"name", "name", graphql.NewNonNull(graphql.String), graphql.String, func(t Task) any { return t.Name }},
+	{"description", "description", graphql.NewNonNull(graphql.String), graphql.String, func(t Task) any { return t.Description }},
+	{"status", "status", graphql.NewNonNull(graphQLStatus), graphQLStatus, func(t Task) any { return t.Status }},
+	{"priority", "priority", graphql.NewNonNull(graphql.Int), graphql.Int, func(t Task) any { return t.Priority }},
+	{"dueDate", "due_date", graphql.DateTime, graphql.DateTime, func(t Task) any { return t.DueDate }},
+	{"remindAt", "remind_at", graphql.DateTime, graphql.DateTime, func(t Task) any { return t.RemindAt }},
+	{"expiresAt", "expires_at", graphql.DateTime, graphql.DateTime, func(t Task) any { return t.ExpiresAt }},
+	{"tags", "tags", graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))), graphql.NewList(graphql.NewNonNull(graphql.String)), func(t Task) any { return emptyIfNil(t.Tags) }},
+	{"parentId", "parent_id", graphql.ID, graphql.ID, func(t Task) any { return t.ParentID }},
+	{"dependsOn", "depends_on", graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.ID))), graphql.NewList(graphql.NewNonNull(graphql.ID)), func(t Task) any { return emptyIfNil(t.DependsOn) }},
+	{"assignee", "assignee", graphql.NewNonNull(graphql.String), graphql.String, func(t Task) any { return t.Assignee }},
+	{"recurrence", "recurrence", graphql.NewNonNull(graphql.String), graphql.String, func(t Task) any { return t.Recurrence }},
+	{"projectId", "project_id", graphql.NewNonNull(graphql.String), graphql.String, func(t Task) any { return t.ProjectID }},
+	{"archived", "archived", graphql.NewNonNull(graphql.Boolean), nil, func(t Task) any { return t.Archived }},
+	{"position", "position", graphql.NewNonNull(graphql.Float), nil, func(t Task) any { return t.Position }},
+	{"createdAt", "created_at", graphql.NewNonNull(graphql.DateTime), nil, func(t Task) any { return t.CreatedAt }},
+	{"updatedAt", "updated_at", graphql.NewNonNull(graphql.DateTime), nil, func(t Task) any { return t.UpdatedAt }},
+	{"deletedAt", "deleted_at", graphql.DateTime, nil, func(t Task) any { return t.DeletedAt }},
+	{"version", "version", graphql.NewNonNull(graphql.Int), nil, func(t Task) any { return t.Version }},
+}
+
+// emptyIfNil returns s, or an empty list if s is nil, for non-null list
+// fields.
+func emptyIfNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// graphQLSchema builds the GraphQL schema, whose resolvers work on h.
+func (h *Handlers) graphQLSchema() graphql.Schema {
+	taskFields := graphql.Fields{}
+	createFields := graphql.InputObjectConfigFieldMap{
+		"id": &graphql.InputObjectFieldConfig{Type: graphql.ID, Description: "Supplied to keep an ID from another system; generated otherwise."},
+	}
+	patchFields := graphql.InputObjectConfigFieldMap{}
+	for _, field := range graphQLTaskFields {
+		get := field.get
+		taskFields[field.name] = &graphql.Field{
+			Type: field.output,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return get(p.Source.(Task)), nil
+			},
+		}
+		if field.input != nil {
+			createFields[field.name] = &graphql.InputObjectFieldConfig{Type: field.input}
+			patchFields[field.name] = &graphql.InputObjectFieldConfig{Type: field.input}
+		}
+	}
+	createFields["name"] = &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)}
+	taskType := graphql.NewObject(graphql.ObjectConfig{Name: "Task", Fields: taskFields})
+	taskListType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "TaskList",
+		Fields: graphql.Fields{
+			"tasks": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(taskType)))},
+			"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+	taskInput := graphql.NewInputObject(graphql.InputObjectConfig{Name: "TaskInput", Fields: createFields})
+	taskPatchInput := graphql.NewInputObject(graphql.InputObjectConfig{Name: "TaskPatchInput", Fields: patchFields})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"tasks": &graphql.Field{
+				Type:        graphql.NewNonNull(taskListType),
+				Description: "A page of the tasks outside the trash, sorted by name, with the number matching.",
+				Args: graphql.FieldConfigArgument{
+					"status":          &graphql.ArgumentConfig{Type: graphQLStatus},
+					"q":               &graphql.ArgumentConfig{Type: graphql.String},
+					"tag":             &graphql.ArgumentConfig{Type: graphql.String},
+					"assignee":        &graphql.ArgumentConfig{Type: graphql.String},
+					"includeArchived": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+					"limit":           &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageLimit},
+					"offset":          &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: h.resolveTasks,
+			},
+			"task": &graphql.Field{
+				Type:        taskType,
+				Description: "The task with the given ID, or null if there is none outside the trash.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: h.resolveTask,
+			},
+		},
+	})
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createTask": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Creates a task, as POST /tasks does.",
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(taskInput)},
+				},
+				Resolve: h.resolveCreateTask,
+			},
+			"updateTask": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Changes the given fields of a task, as PATCH /tasks/{id} does.",
+				Args: graphql.FieldConfigArgument{
+					"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(taskPatchInput)},
+				},
+				Resolve: h.resolveUpdateTask,
+			},
+			"deleteTask": &graphql.Field{
+				Type:        graphql.NewNonNull(taskType),
+				Description: "Moves a task to the trash, as DELETE /tasks/{id} does, and returns it.",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: h.resolveDeleteTask,
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+func (h *Handlers) resolveTasks(p graphql.ResolveParams) (any, error) {
+	limit, offset := p.Args["limit"].(int), p.Args["offset"].(int)
+	if limit < 0 || offset < 0 {
+		return nil, errors.New("Limit and offset must not be negative")
+	}
+	filter := taskFilter{
+		includeArchived: p.Args["includeArchived"].(bool),
+		expiredAt:       time.Now(),
+	}
+	if status, ok := p.Args["status"].(Status); ok {
+		filter.status = &status
+	}
+	if q, ok := p.Args["q"].(string); ok {
+		filter.query = strings.ToLower(strings.TrimSpace(q))
+	}
+	if tag, ok := p.Args["tag"].(string); ok {
+		filter.tag = normalizeTag(tag)
+	}
+	if assignee, ok := p.Args["assignee"].(string); ok {
+		filter.assignee = strings.TrimSpace(assignee)
+	}
+
+	tasks, err := h.filteredTasks(p.Context, filter)
+	if err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	sortTasks(tasks, "name", false)
+	return map[string]any{"tasks": paginate(tasks, min(limit, maxPageLimit), offset), "total": len(tasks)}, nil
+}
+
+func (h *Handlers) resolveTask(p graphql.ResolveParams) (any, error) {
+	task, err := h.store.Get(p.Context, p.Args["id"].(string))
+	if errors.Is(err, ErrNotFound) || (err == nil && task.DeletedAt != nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	return task, nil
+}
+
+func (h *Handlers) resolveCreateTask(p graphql.ResolveParams) (any, error) {
+	task := h.newTask()
+	if err := decodeGraphQLInput(p.Args["input"], taskSchema, &task); err != nil {
+		return nil, err
+	}
+	h.sanitizeTask(&task)
+	normalizeTask(&task)
+	if err := validateTask(task); err != nil {
+		return nil, err
+	}
+	if task.ParentID != nil {
+		if err := h.validateParent(p.Context, "", *task.ParentID); err != nil {
+			return nil, h.graphQLStoreError(p.Context, err)
+		}
+	}
+	if err := h.validateDependencies(p.Context, "", task.DependsOn); err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	if err := h.validateProject(p.Context, task.ProjectID); err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	if err := h.checkNewCompletion(p.Context, task); err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	if err := h.prepareNewTask(&task, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	remaining, err := h.remainingCapacity(p.Context)
+	if err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	if remaining < 1 {
+		return nil, errors.New(h.capacityMessage())
+	}
+	if task.Position, err = h.nextPosition(p.Context); err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	if err := h.store.Create(p.Context, task); err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	h.publish(eventCreated, task)
+	return task, nil
+}
+
+func (h *Handlers) resolveUpdateTask(p graphql.ResolveParams) (any, error) {
+	id := p.Args["id"].(string)
+	var patch TaskPatch
+	if err := decodeGraphQLInput(p.Args["input"], taskPatchSchema, &patch); err != nil {
+		return nil, err
+	}
+	h.sanitizePatch(&patch)
+	if err := normalizePatch(&patch); err != nil {
+		return nil, err
+	}
+	if patch.ParentID != nil && *patch.ParentID != "" {
+		if err := h.validateParent(p.Context, id, *patch.ParentID); err != nil {
+			return nil, h.graphQLStoreError(p.Context, err)
+		}
+	}
+	if patch.DependsOn != nil {
+		if err := h.validateDependencies(p.Context, id, *patch.DependsOn); err != nil {
+			return nil, h.graphQLStoreError(p.Context, err)
+		}
+	}
+	if patch.ProjectID != nil {
+		if err := h.validateProject(p.Context, *patch.ProjectID); err != nil {
+			return nil, h.graphQLStoreError(p.Context, err)
+		}
+	}
+	incomplete, err := h.patchBlockingTasks(p.Context, patch)
+	if err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+
+	var before Task
+	task, err := h.store.Update(p.Context, id, func(task *Task) error {
+		if task.DeletedAt != nil {
+			return ErrNotFound
+		}
+		before = *task
+		was := task.Status
+		applyPatch(task, patch)
+		if err := completionBlocked(was, *task, incomplete); err != nil {
+			return err
+		}
+		task.UpdatedAt = time.Now().UTC()
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	h.publishUpdate(before, task)
+	return task, nil
+}
+
+func (h *Handlers) resolveDeleteTask(p graphql.ResolveParams) (any, error) {
+	id := p.Args["id"].(string)
+	children, err := h.subtasks(p.Context, id, false)
+	if err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	if len(children) > 0 {
+		return nil, errors.New("Task has subtasks; delete or move them first")
+	}
+	task, err := h.store.Update(p.Context, id, func(task *Task) error {
+		if task.DeletedAt != nil {
+			return ErrNotFound
+		}
+		now := time.Now().UTC()
+		task.DeletedAt = &now
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		return nil, h.graphQLStoreError(p.Context, err)
+	}
+	h.publish(eventDeleted, task)
+	return task, nil
+}
+
+// decodeGraphQLInput decodes a TaskInput or TaskPatchInput argument into v,
+// checking it against the JSON schema of the matching REST payload.
+func decodeGraphQLInput(input any, schema *jsonschema.Schema, v any) error {
+	fields := make(map[string]any)
+	for name, value := range input.(map[string]any) {
+		jsonName := name
+		for _, field := range graphQLTaskFields {
+			if field.name == name {
+				jsonName = field.json
+			}
+		}
+		fields[jsonName] = value
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := decodeValidated(data, schema, v); err != nil {
+		var schemaErr *schemaError
+		if errors.As(err, &schemaErr) {
+			return fmt.Errorf("Input does not match the schema: %s", strings.Join(schemaErr.violations, "; "))
+		}
+		return errors.New(payloadError(err))
+	}
+	return nil
+}
+
+// graphQLStoreError converts an error from the store, or from a check that
+// consults it, into one safe to report to the client, logging any that is
+// not the client's doing.
+func (h *Handlers) graphQLStoreError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return errors.New("Task not found")
+	case errors.Is(err, ErrExists):
+		return errors.New("A task with this ID already exists")
+	case errors.Is(err, ErrTaskLimit):
+		return errors.New(h.capacityMessage())
+	case errors.Is(err, ErrNoProject):
+		return errProjectNotFound
+	case errors.Is(err, errBlocked),
+		errors.Is(err, errParentNotFound), errors.Is(err, errSelfParent), errors.Is(err, errParentCycle),
+		errors.Is(err, errDependencyNotFound), errors.Is(err, errSelfDependency), errors.Is(err, errDependencyCycle),
+		errors.Is(err, errProjectNotFound):
+		return err
+	case errors.Is(err, context.DeadlineExceeded):
+		h.logger.WarnContext(ctx, "Request timed out", "error", err)
+		return errors.New("Request timed out")
+	default:
+		h.logger.ErrorContext(ctx, "Store error", "error", err)
+		return errors.New("Internal server error")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// graphQL posts a GraphQL query to router and decodes the response.
+func graphQL(t *testing.T, router *mux.Router, query string, variables map[string]any) (data map[string]any, errs []string) {
+	t.Helper()
+	body, _ := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	req, _ := http.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusOK, rr.Body)
+	}
+	var resp struct {
+		Data   map[string]any `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	for _, err := range resp.Errors {
+		errs = append(errs, err.Message)
+	}
+	return resp.Data, errs
+}
+
+func TestGraphQLHandler(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Existing", Tags: []string{"home"}, Version: 1}
+
+	data, errs := graphQL(t, router, `mutation($input: TaskInput!) {
+		createTask(input: $input) { id name status priority tags dueDate }
+	}`, map[string]any{"input": map[string]any{"name": " Write docs ", "priority": 2, "tags": []string{"Work"}, "dueDate": "2026-01-02T00:00:00Z"}})
+	if len(errs) > 0 {
+		t.Fatalf("createTask returned errors: %v", errs)
+	}
+	created := data["createTask"].(map[string]any)
+	if created["name"] != "Write docs" || created["status"] != "INCOMPLETE" || created["priority"] != 2.0 || created["dueDate"] != "2026-01-02T00:00:00Z" {
+		t.Errorf("createTask returned wrong task: %v", created)
+	}
+	id := created["id"].(string)
+	if stored, ok := store.tasks[id]; !ok || stored.Tags[0] != "work" {
+		t.Errorf("createTask stored wrong task: %+v", stored)
+	}
+
+	data, errs = graphQL(t, router, `{ tasks(tag: "home") { total tasks { id name } } }`, nil)
+	if len(errs) > 0 {
+		t.Fatalf("tasks returned errors: %v", errs)
+	}
+	if list := data["tasks"].(map[string]any); list["total"] != 1.0 || list["tasks"].([]any)[0].(map[string]any)["name"] != "Existing" {
+		t.Errorf("tasks returned wrong list: %v", list)
+	}
+
+	data, errs = graphQL(t, router, `mutation { updateTask(id: "1", input: {status: COMPLETED, dependsOn: ["`+id+`"]}) { status version } }`, nil)
+	if len(errs) == 0 || !strings.Contains(errs[0], "dependencies are incomplete") {
+		t.Errorf("updateTask completed a blocked task: %v, %v", data, errs)
+	}
+	data, errs = graphQL(t, router, `mutation { updateTask(id: "1", input: {name: "Renamed"}) { name version } }`, nil)
+	if len(errs) > 0 || data["updateTask"].(map[string]any)["name"] != "Renamed" || store.tasks["1"].Version != 2 {
+		t.Errorf("updateTask returned %v, %v", data, errs)
+	}
+
+	if _, errs = graphQL(t, router, `mutation { deleteTask(id: "1") { deletedAt } }`, nil); len(errs) > 0 {
+		t.Errorf("deleteTask returned errors: %v", errs)
+	}
+	if store.tasks["1"].DeletedAt == nil {
+		t.Errorf("deleteTask did not move the task to the trash")
+	}
+	data, errs = graphQL(t, router, `{ task(id: "1") { id } }`, nil)
+	if len(errs) > 0 || data["task"] != nil {
+		t.Errorf("task returned a task in the trash: %v, %v", data, errs)
+	}
+}
+
+func TestGraphQLHandlerErrors(t *testing.T) {
+	router, store := setupRouter()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`mutation { createTask(input: {name: "  "}) { id } }`, "Name is required"},
+		{`mutation { createTask(input: {name: "A", priority: 5}) { id } }`, "does not match the schema"},
+		{`mutation { createTask(input: {name: "A", parentId: "missing"}) { id } }`, "Parent task not found"},
+		{`mutation { updateTask(id: "missing", input: {name: "A"}) { id } }`, "Task not found"},
+		{`{ tasks { unknown } }`, "Cannot query field"},
+	}
+	for _, tt := range tests {
+		_, errs := graphQL(t, router, tt.query, nil)
+		if len(errs) == 0 || !strings.Contains(errs[0], tt.want) {
+			t.Errorf("%s returned errors %v, want one containing %q", tt.query, errs, tt.want)
+		}
+	}
+	if len(store.tasks) != 0 {
+		t.Errorf("failed mutations stored tasks: %+v", store.tasks)
+	}
+
+	req, _ := http.NewRequest("POST", "/graphql", strings.NewReader(`{"query": " "}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for an empty query: got %v want %v", status, http.StatusBadRequest)
+	}
+}
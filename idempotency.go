@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxIdempotencyKeyLength bounds the Idempotency-Key header so clients cannot
+// fill the cache with huge keys.
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotencyEntries bounds how many responses the cache holds at once.
+// Once it is full the entry closest to expiry makes way for a new one.
+const maxIdempotencyEntries = 10000
+
+// idempotencyCache remembers the responses to requests carrying an
+// Idempotency-Key header so that retries of the same request are answered
+// with the original response instead of being applied twice. Entries are
+// keyed by method, path and Idempotency-Key, so the same key sent to two
+// endpoints names two requests.
+type idempotencyCache struct {
+	mu         sync.Mutex
+	entries    map[string]*idempotentResponse
+	ttl        time.Duration
+	maxEntries int
+}
+
+// idempotentResponse is a recorded response, with the hash of the request
+// body that produced it. While the original request is still being handled
+// it is pending and has no status yet.
+type idempotentResponse struct {
+	pending bool
+	hash    [sha256.Size]byte
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// newIdempotencyCache returns a cache that remembers responses for ttl.
+func newIdempotencyCache(ttl time.Duration) *idempotencyCache {
+	return &idempotencyCache{
+		entries:    make(map[string]*idempotentResponse),
+		ttl:        ttl,
+		maxEntries: maxIdempotencyEntries,
+	}
+}
+
+// reserve claims key for a new request whose body hashes to hash. If the key
+// is already known it returns the recorded (possibly pending) response and
+// false instead.
+func (c *idempotencyCache) reserve(key string, hash [sha256.Size]byte) (*idempotentResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := c.entries[key]; ok && now.Before(entry.expires) {
+		return entry, false
+	}
+	if len(c.entries) >= c.maxEntries {
+		c.evictOne(now)
+	}
+	c.entries[key] = &idempotentResponse{pending: true, hash: hash, expires: now.Add(c.ttl)}
+	return nil, true
+}
+
+// evictOne makes room for a new entry by dropping the expired ones or, if
+// none has expired, the one closest to expiry. The caller holds c.mu.
+func (c *idempotencyCache) evictOne(now time.Time) {
+	var oldest string
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+			continue
+		}
+		if oldest == "" || entry.expires.Before(c.entries[oldest].expires) {
+			oldest = key
+		}
+	}
+	if len(c.entries) >= c.maxEntries && oldest != "" {
+		delete(c.entries, oldest)
+	}
+}
+
+// complete records the response to the request that reserved key. If the
+// reservation was evicted in the meantime the response is not recorded.
+func (c *idempotencyCache) complete(key string, status int, header http.Header, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reserved, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	c.entries[key] = &idempotentResponse{
+		hash:    reserved.hash,
+		status:  status,
+		header:  header,
+		body:    body,
+		expires: time.Now().Add(c.ttl),
+	}
+}
+
+// release forgets key so that the request can be retried.
+func (c *idempotencyCache) release(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// evictExpired removes expired responses, checking every interval until ctx
+// is done.
+func (c *idempotencyCache) evictExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for key, entry := range c.entries {
+				if !now.Before(entry.expires) {
+					delete(c.entries, key)
+				}
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// recordingWriter passes a response through while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// idempotent wraps a handler so that a request repeating an earlier
+// Idempotency-Key gets the earlier response, marked with an
+// Idempotent-Replayed header, without next running again. Reusing a key
+// with a different body is refused with 422, since replaying the response
+// to another request would be wrong. Server errors are not recorded, so a
+// request that failed that way can be retried with the same key. Requests
+// without the header, and dry runs, which change nothing worth replaying,
+// are handled as usual.
+func (h *Handlers) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		dryRun, _ := parseBoolParam(r.URL.Query().Get("dry_run"))
+		if key == "" || h.idempotency == nil || dryRun {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			respondError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondPayloadError(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		hash := sha256.Sum256(body)
+		key = r.Method + " " + r.URL.Path + " " + key
+
+		if recorded, ok := h.idempotency.reserve(key, hash); !ok {
+			if recorded.hash != hash {
+				respondError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+				return
+			}
+			if recorded.pending {
+				respondError(w, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+				return
+			}
+			for name, values := range recorded.header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(recorded.status)
+			w.Write(recorded.body)
+			return
+		}
+
+		rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rw, r)
+		if rw.status >= http.StatusInternalServerError {
+			h.idempotency.release(key)
+			return
+		}
+		h.idempotency.complete(key, rw.status, w.Header().Clone(), rw.body.Bytes())
+	}
+}
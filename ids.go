@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// errIDsExhausted is returned by NewID once a generator has no IDs left.
+var errIDsExhausted = errors.New("No task IDs are left")
+
+// IDGenerator assigns IDs to new tasks. Implementations must be safe for
+// concurrent use.
+type IDGenerator interface {
+	// NewID returns an ID for a new task.
+	NewID() (string, error)
+	// ParseID validates a client-supplied ID and returns it in canonical
+	// form.
+	ParseID(id string) (string, error)
+	// Reserve records that a task has been stored with the given ID, so
+	// NewID never returns it. It is called once the task is committed, so
+	// IDs of tasks that are rejected or rolled back stay free.
+	Reserve(id string)
+}
+
+// newIDGenerator returns the generator for the given ID scheme, "uuid" or
+// "sequential". A sequential generator starts after the IDs already in store.
+func newIDGenerator(ctx context.Context, scheme string, store Store) (IDGenerator, error) {
+	if scheme != "sequential" {
+		return uuidGenerator{}, nil
+	}
+	tasks, err := store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newSequentialGenerator(tasks), nil
+}
+
+// uuidGenerator gives tasks random UUIDs.
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() (string, error) {
+	return uuid.New().String(), nil
+}
+
+func (uuidGenerator) ParseID(id string) (string, error) {
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return "", errors.New("ID must be a UUID")
+	}
+	return parsed.String(), nil
+}
+
+func (uuidGenerator) Reserve(string) {}
+
+// sequentialGenerator gives tasks the IDs 1, 2, 3, ... in order of creation.
+// It only knows about the IDs handed out by this process, so it suits
+// single-instance deployments. IDs are kept within the int64 range, and
+// NewID fails rather than go past it.
+type sequentialGenerator struct {
+	mu   sync.Mutex
+	next uint64
+}
+
+// newSequentialGenerator returns a generator that continues after the
+// highest numeric ID among tasks, so IDs keep counting up across restarts of
+// a persistent store.
+func newSequentialGenerator(tasks []Task) *sequentialGenerator {
+	g := &sequentialGenerator{next: 1}
+	for _, task := range tasks {
+		g.Reserve(task.ID)
+	}
+	return g
+}
+
+func (g *sequentialGenerator) NewID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.next > math.MaxInt64 {
+		return "", errIDsExhausted
+	}
+	id := g.next
+	g.next++
+	return strconv.FormatUint(id, 10), nil
+}
+
+// ParseID accepts positive integers up to math.MaxInt64.
+func (g *sequentialGenerator) ParseID(id string) (string, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || n == 0 {
+		return "", errors.New("ID must be a positive integer")
+	}
+	if n > math.MaxInt64 {
+		return "", errors.New("ID must be at most 9223372036854775807")
+	}
+	return strconv.FormatUint(n, 10), nil
+}
+
+// Reserve moves the counter past id, so a task stored with an explicit ID is
+// never given a duplicate later. IDs that are not in range are ignored.
+func (g *sequentialGenerator) Reserve(id string) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || n > math.MaxInt64 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if n >= g.next {
+		g.next = n + 1
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSequentialGenerator(t *testing.T) {
+	g := newSequentialGenerator([]Task{{ID: "7"}, {ID: "3"}, {ID: "0b9f6a3e-5c1d-4e8a-9f3b-2d7c6e1a4b58"}})
+	if id, err := g.NewID(); err != nil || id != "8" {
+		t.Errorf("NewID after stored IDs returned %q, %v, want 8", id, err)
+	}
+	if id, err := g.ParseID("012"); err != nil || id != "12" {
+		t.Errorf("ParseID(012) returned %q, %v", id, err)
+	}
+	if id, _ := g.NewID(); id != "9" {
+		t.Errorf("NewID after a parsed but unstored ID returned %q, want 9", id)
+	}
+	g.Reserve("12")
+	if id, _ := g.NewID(); id != "13" {
+		t.Errorf("NewID after a reserved ID returned %q, want 13", id)
+	}
+	for _, id := range []string{"0", "-1", "abc", "0b9f6a3e-5c1d-4e8a-9f3b-2d7c6e1a4b58", "9223372036854775808", "18446744073709551615"} {
+		if _, err := g.ParseID(id); err == nil {
+			t.Errorf("ParseID accepted %q", id)
+		}
+		g.Reserve(id)
+	}
+	if id, _ := g.NewID(); id != "14" {
+		t.Errorf("NewID after rejected IDs returned %q, want 14", id)
+	}
+
+	g = newSequentialGenerator([]Task{{ID: "5"}, {ID: "18446744073709551615"}})
+	if id, _ := g.NewID(); id != "6" {
+		t.Errorf("NewID after an out-of-range stored ID returned %q, want 6", id)
+	}
+
+	g = newSequentialGenerator([]Task{{ID: "9223372036854775807"}})
+	if id, err := g.NewID(); !errors.Is(err, errIDsExhausted) {
+		t.Errorf("NewID after the largest ID returned %q, %v, want errIDsExhausted", id, err)
+	}
+}
+
+func TestUUIDGenerator(t *testing.T) {
+	var g uuidGenerator
+	a, _ := g.NewID()
+	b, _ := g.NewID()
+	if a == b {
+		t.Errorf("NewID returned %q twice", a)
+	}
+	if id, err := g.ParseID("0B9F6A3E-5C1D-4E8A-9F3B-2D7C6E1A4B58"); err != nil || id != "0b9f6a3e-5c1d-4e8a-9f3b-2d7c6e1a4b58" {
+		t.Errorf("ParseID returned %q, %v", id, err)
+	}
+	if _, err := g.ParseID("12"); err == nil {
+		t.Errorf("ParseID accepted a non-UUID")
+	}
+}
+
+func TestCreateTaskHandlerSequentialIDs(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	store.tasks["41"] = Task{ID: "41", Name: "Existing"}
+	ids, err := newIDGenerator(context.Background(), "sequential", store)
+	if err != nil {
+		t.Fatalf("newIDGenerator returned error: %v", err)
+	}
+	h := &Handlers{store: store, ids: ids}
+
+	req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "Next"}`))
+	rr := httptest.NewRecorder()
+	h.createTaskHandler(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusCreated, rr.Body)
+	}
+	if _, ok := store.tasks["42"]; !ok {
+		t.Errorf("task was not created with the next sequential ID: %+v", store.tasks)
+	}
+
+	// A dry run with an explicit ID stores nothing, so it must not move
+	// the counter
+	req, _ = http.NewRequest("POST", "/tasks?dry_run=true", strings.NewReader(`{"id": "9223372036854775807", "name": "Last"}`))
+	rr = httptest.NewRecorder()
+	h.createTaskHandler(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("dry run returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+	req, _ = http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "After the dry run"}`))
+	rr = httptest.NewRecorder()
+	h.createTaskHandler(rr, req)
+	if _, ok := store.tasks["43"]; !ok {
+		t.Errorf("dry run moved the sequential counter: %+v", store.tasks)
+	}
+
+	// An explicit ID that is stored is never handed out again
+	req, _ = http.NewRequest("POST", "/tasks", strings.NewReader(`{"id": "50", "name": "Imported"}`))
+	rr = httptest.NewRecorder()
+	h.createTaskHandler(rr, req)
+	req, _ = http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "After the import"}`))
+	rr = httptest.NewRecorder()
+	h.createTaskHandler(rr, req)
+	if _, ok := store.tasks["51"]; !ok {
+		t.Errorf("a stored explicit ID did not move the sequential counter: %+v", store.tasks)
+	}
+}
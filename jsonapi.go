@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// jsonAPIMediaType is the media type of JSON:API documents.
+const jsonAPIMediaType = "application/vnd.api+json"
+
+// jsonAPIMiddleware serves JSON:API documents (https://jsonapi.org) to clients
+// that ask for them in their Accept header, by rewriting the plain JSON
+// responses of the handlers: a task becomes a resource object of type
+// "tasks", a list of tasks the primary data with the rest of the list, such as
+// its total, as meta, and an error an errors array. Other responses, like
+// statistics and comments, are not task resources and are sent unchanged.
+func jsonAPIMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if r.Method == http.MethodHead || !acceptsJSONAPI(r.Header.Get("Accept")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		jw := &jsonAPIResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(jw, r)
+		jw.close()
+	})
+}
+
+// acceptsJSONAPI reports whether an Accept header lists the JSON:API media
+// type. As the specification requires, instances of it carrying parameters
+// are ignored.
+func acceptsJSONAPI(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == jsonAPIMediaType && len(params) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonAPIResponseWriter buffers a JSON response so it can be rewritten as a
+// JSON:API document once complete. Responses of any other type, such as
+// event streams and CSV files, are passed straight through.
+type jsonAPIResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+func (jw *jsonAPIResponseWriter) WriteHeader(code int) {
+	if jw.wroteHeader {
+		return
+	}
+	jw.wroteHeader = true
+	jw.status = code
+	mediaType, _, _ := mime.ParseMediaType(jw.Header().Get("Content-Type"))
+	if mediaType != "application/json" {
+		jw.passthrough = true
+		jw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (jw *jsonAPIResponseWriter) Write(p []byte) (int, error) {
+	if !jw.wroteHeader {
+		jw.WriteHeader(http.StatusOK)
+	}
+	if jw.passthrough {
+		return jw.ResponseWriter.Write(p)
+	}
+	return jw.buf.Write(p)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (jw *jsonAPIResponseWriter) Unwrap() http.ResponseWriter {
+	return jw.ResponseWriter
+}
+
+// close sends the buffered response, as a JSON:API document if it has a
+// JSON:API form.
+func (jw *jsonAPIResponseWriter) close() {
+	if !jw.wroteHeader || jw.passthrough {
+		return
+	}
+	body := jw.buf.Bytes()
+	if document, ok := jsonAPIDocument(jw.status, body); ok {
+		body = document
+		jw.Header().Set("Content-Type", jsonAPIMediaType)
+	}
+	jw.Header().Del("Content-Length")
+	jw.ResponseWriter.WriteHeader(jw.status)
+	_, _ = jw.ResponseWriter.Write(body)
+}
+
+// jsonAPIResource is a task as a JSON:API resource object.
+type jsonAPIResource struct {
+	Type       string                     `json:"type"`
+	ID         string                     `json:"id"`
+	Attributes map[string]json.RawMessage `json:"attributes"`
+	Links      map[string]string          `json:"links"`
+}
+
+// jsonAPIError is an entry of a JSON:API errors array.
+type jsonAPIError struct {
+	Status string `json:"status"`
+	Title  string `json:"title"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// jsonAPIDocument rewrites a plain JSON response body as a JSON:API
+// document. It reports false for bodies that hold no task or error.
+func jsonAPIDocument(status int, body []byte) ([]byte, bool) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(body, &object); err != nil {
+		// Bulk creation returns a bare array of tasks.
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil || len(items) == 0 {
+			return nil, false
+		}
+		data, ok := jsonAPIResources(items)
+		if !ok {
+			return nil, false
+		}
+		return marshalDocument(map[string]any{"data": data})
+	}
+
+	if message, ok := object["error"]; ok && status >= 400 {
+		return marshalDocument(map[string]any{"errors": jsonAPIErrors(status, message, object["violations"])})
+	}
+	if tasks, ok := object["tasks"]; ok {
+		var items []json.RawMessage
+		if err := json.Unmarshal(tasks, &items); err != nil {
+			return nil, false
+		}
+		data, ok := jsonAPIResources(items)
+		if !ok {
+			return nil, false
+		}
+		delete(object, "tasks")
+		document := map[string]any{"data": data}
+		if len(object) > 0 {
+			document["meta"] = object
+		}
+		return marshalDocument(document)
+	}
+	if resource, ok := jsonAPITask(object); ok {
+		return marshalDocument(map[string]any{"data": resource})
+	}
+	return nil, false
+}
+
+// jsonAPIResources converts a list of tasks, reporting false if any item is
+// not a task.
+func jsonAPIResources(items []json.RawMessage) ([]jsonAPIResource, bool) {
+	data := make([]jsonAPIResource, 0, len(items))
+	for _, item := range items {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(item, &object); err != nil {
+			return nil, false
+		}
+		resource, ok := jsonAPITask(object)
+		if !ok {
+			return nil, false
+		}
+		data = append(data, resource)
+	}
+	return data, true
+}
+
+// jsonAPITask converts a task, possibly with only some of its fields, into a
+// resource object. It reports false for objects that are not tasks: those
+// without a string id or with fields a task does not have.
+func jsonAPITask(object map[string]json.RawMessage) (jsonAPIResource, bool) {
+	var id string
+	if err := json.Unmarshal(object["id"], &id); err != nil || id == "" {
+		return jsonAPIResource{}, false
+	}
+	attributes := make(map[string]json.RawMessage, len(object)-1)
+	for name, value := range object {
+		if !taskFieldNames[name] {
+			return jsonAPIResource{}, false
+		}
+		if name != "id" {
+			attributes[name] = value
+		}
+	}
+	return jsonAPIResource{Type: "tasks", ID: id, Attributes: attributes, Links: map[string]string{"self": "/tasks/" + id}}, true
+}
+
+// jsonAPIErrors converts the message and any schema violations of an error
+// response into error objects, one per violation.
+func jsonAPIErrors(status int, message, violations json.RawMessage) []jsonAPIError {
+	var title string
+	_ = json.Unmarshal(message, &title)
+	var details []string
+	_ = json.Unmarshal(violations, &details)
+	if len(details) == 0 {
+		return []jsonAPIError{{Status: strconv.Itoa(status), Title: title}}
+	}
+	errs := make([]jsonAPIError, len(details))
+	for i, detail := range details {
+		errs[i] = jsonAPIError{Status: strconv.Itoa(status), Title: title, Detail: detail}
+	}
+	return errs
+}
+
+func marshalDocument(document map[string]any) ([]byte, bool) {
+	data, err := json.Marshal(document)
+	if err != nil {
+		return nil, false
+	}
+	return append(data, '\n'), true
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONAPIMiddleware(t *testing.T) {
+	router, store := setupRouter()
+	router.Use(jsonAPIMiddleware)
+	store.tasks["1"] = Task{ID: "1", Name: "First", Tags: []string{"work"}}
+	store.tasks["2"] = Task{ID: "2", Name: "Second"}
+
+	serve := func(path, accept string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve("/tasks/1", "application/vnd.api+json")
+	if contentType := rr.Header().Get("Content-Type"); contentType != jsonAPIMediaType {
+		t.Errorf("handler returned wrong content type: got %q want %q", contentType, jsonAPIMediaType)
+	}
+	var single struct {
+		Data jsonAPIResource `json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &single); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if single.Data.Type != "tasks" || single.Data.ID != "1" || string(single.Data.Attributes["name"]) != `"First"` || single.Data.Attributes["id"] != nil {
+		t.Errorf("handler returned wrong resource: %s", rr.Body)
+	}
+
+	rr = serve("/tasks?limit=1", "text/html, application/vnd.api+json")
+	var list struct {
+		Data []jsonAPIResource `json:"data"`
+		Meta map[string]any    `json:"meta"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if len(list.Data) != 1 || list.Meta["total"] != 2.0 || list.Meta["next_cursor"] == nil {
+		t.Errorf("handler returned wrong list document: %s", rr.Body)
+	}
+
+	rr = serve("/tasks/missing", "application/vnd.api+json")
+	if expected := `{"errors":[{"status":"404","title":"Task not found"}]}`; strings.TrimSpace(rr.Body.String()) != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+
+	// Responses without tasks, and clients that do not ask, get plain JSON.
+	for _, tt := range []struct{ path, accept string }{
+		{"/tasks/tags", "application/vnd.api+json"},
+		{"/tasks/1", "application/json"},
+		{"/tasks/1", `application/vnd.api+json; ext="bulk"`},
+	} {
+		rr = serve(tt.path, tt.accept)
+		if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("GET %s with Accept %s returned content type %q, want application/json", tt.path, tt.accept, contentType)
+		}
+	}
+}
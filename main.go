@@ -1,126 +1,2158 @@
 package main
 
 import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unicode/utf8"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Task represents a to-do item.
 type Task struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Status      int    `json:"status"` // 0: incomplete, 1: completed
+	ID          string     `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Status      Status     `json:"status"`
+	Priority    int        `json:"priority"` // 0: low, 1: medium, 2: high
+	DueDate     *time.Time `json:"due_date,omitempty"`
+	RemindAt    *time.Time `json:"remind_at,omitempty"`   // when a reminder is sent for the task
+	RemindedAt  *time.Time `json:"reminded_at,omitempty"` // set once the reminder has been sent
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`  // when the task is removed for good
+	Tags        []string   `json:"tags"`                  // lowercase, no duplicates
+	ParentID    *string    `json:"parent_id,omitempty"`
+	DependsOn   []string   `json:"depends_on,omitempty"` // IDs of tasks that must be completed first
+	Assignee    string     `json:"assignee,omitempty"`   // unassigned when empty
+	ProjectID   string     `json:"project_id,omitempty"` // in no project when empty
+	Archived    bool       `json:"archived"`             // set by the archive endpoints, independent of status
+	Recurrence  string     `json:"recurrence,omitempty"` // "daily", "weekly" or "monthly"; empty when the task does not repeat
+	Position    float64    `json:"position"`             // manual sort order, set by the move endpoint
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"` // set while the task is in the trash
+	Version     int        `json:"version"`              // incremented on every update
 }
 
-// TaskStore is an in-memory store for tasks.
-type TaskStore struct {
-	mu    sync.RWMutex
-	tasks map[string]Task
+// expired reports whether the task has an expiry time at or before now.
+func (t Task) expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !t.ExpiresAt.After(now)
 }
 
-func NewTaskStore() *TaskStore {
-	return &TaskStore{
-		tasks: make(map[string]Task),
+// overdue reports whether the task is incomplete and was due before now. Tasks
+// without a due date are never overdue.
+func (t Task) overdue(now time.Time) bool {
+	return t.Status == 0 && t.DueDate != nil && t.DueDate.Before(now)
+}
+
+// TaskPatch holds the fields of a partial update. Nil fields are left unchanged.
+type TaskPatch struct {
+	Name        *string    `json:"name"`
+	Description *string    `json:"description"`
+	Status      *Status    `json:"status"`
+	Priority    *int       `json:"priority"`
+	DueDate     *time.Time `json:"due_date"`
+	RemindAt    *time.Time `json:"remind_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Tags        *[]string  `json:"tags"`
+	ParentID    *string    `json:"parent_id"` // "" detaches the task from its parent
+	DependsOn   *[]string  `json:"depends_on"`
+	Assignee    *string    `json:"assignee"` // "" unassigns the task
+	Recurrence  *string    `json:"recurrence"`
+	ProjectID   *string    `json:"project_id"` // "" takes the task out of its project
+}
+
+// TaskList is a page of tasks along with the total number of tasks available.
+type TaskList struct {
+	Tasks []Task `json:"tasks"`
+	Total int    `json:"total"`
+	// NextCursor, when set, fetches the page after this one in the same
+	// sort.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// TaskStats summarizes the tasks by status.
+type TaskStats struct {
+	Total      int `json:"total"`
+	Completed  int `json:"completed"`
+	Incomplete int `json:"incomplete"`
+	// Activity is how many changes the activity log holds.
+	Activity int `json:"activity_entries"`
+}
+
+// taskFilter selects which tasks a list request returns. Nil fields match
+// every task.
+type taskFilter struct {
+	status *Status
+	query  string // lowercase substring to search name and description for
+	tag    string // normalized tag the task must carry
+
+	nameContains string   // lowercase substring to search the name for
+	tags         []string // normalized tags the task must all carry
+
+	// dueBefore and dueAfter, when non-zero, select tasks with a due date in
+	// that range.
+	dueBefore, dueAfter time.Time
+
+	assignee string // matched case-insensitively
+	project  string // ID of the project the task must be in
+
+	// overdueAt, when non-zero, selects incomplete tasks due before it.
+	overdueAt time.Time
+
+	// expiredAt, when non-zero, leaves out tasks that expired by then but
+	// have not been swept yet.
+	expiredAt time.Time
+
+	includeDeleted  bool
+	includeArchived bool
+}
+
+// matches reports whether task satisfies every criterion of the filter.
+func (f taskFilter) matches(task Task) bool {
+	if task.DeletedAt != nil && !f.includeDeleted {
+		return false
+	}
+	if task.Archived && !f.includeArchived {
+		return false
+	}
+	if f.status != nil && task.Status != *f.status {
+		return false
+	}
+	if f.query != "" &&
+		!strings.Contains(strings.ToLower(task.Name), f.query) &&
+		!strings.Contains(strings.ToLower(task.Description), f.query) {
+		return false
+	}
+	if f.tag != "" && !slices.Contains(task.Tags, f.tag) {
+		return false
+	}
+	if f.nameContains != "" && !strings.Contains(strings.ToLower(task.Name), f.nameContains) {
+		return false
+	}
+	for _, tag := range f.tags {
+		if !slices.Contains(task.Tags, tag) {
+			return false
+		}
+	}
+	if !f.dueBefore.IsZero() && (task.DueDate == nil || !task.DueDate.Before(f.dueBefore)) {
+		return false
+	}
+	if !f.dueAfter.IsZero() && (task.DueDate == nil || !task.DueDate.After(f.dueAfter)) {
+		return false
+	}
+	if f.assignee != "" && !strings.EqualFold(task.Assignee, f.assignee) {
+		return false
+	}
+	if f.project != "" && task.ProjectID != f.project {
+		return false
+	}
+	if !f.overdueAt.IsZero() && !task.overdue(f.overdueAt) {
+		return false
+	}
+	if !f.expiredAt.IsZero() && task.expired(f.expiredAt) {
+		return false
+	}
+	return true
+}
+
+// parseTaskFilter reads the filter parameters shared by the endpoints that
+// list tasks, returning an error whose message is suitable for the response
+// body.
+func parseTaskFilter(query url.Values) (taskFilter, error) {
+	filter := taskFilter{expiredAt: time.Now()}
+	if v := query.Get("status"); v != "" {
+		status, err := parseStatus(v)
+		if err != nil {
+			return taskFilter{}, err
+		}
+		filter.status = &status
+	}
+	filter.query = strings.ToLower(query.Get("q"))
+	filter.tag = normalizeTag(query.Get("tag"))
+	filter.assignee = strings.TrimSpace(query.Get("assignee"))
+	filter.project = query.Get("project")
+	overdue, err := parseBoolParam(query.Get("overdue"))
+	if err != nil {
+		return taskFilter{}, errors.New("Overdue must be true or false")
 	}
+	if overdue {
+		filter.overdueAt = time.Now()
+	}
+	if filter.includeDeleted, err = parseBoolParam(query.Get("include_deleted")); err != nil {
+		return taskFilter{}, errors.New("Include_deleted must be true or false")
+	}
+	if filter.includeArchived, err = parseBoolParam(query.Get("include_archived")); err != nil {
+		return taskFilter{}, errors.New("Include_archived must be true or false")
+	}
+	return filter, nil
+}
+
+// taskSorters maps the accepted ?sort= values to comparison functions.
+var taskSorters = map[string]func(a, b Task) int{
+	"name":       func(a, b Task) int { return strings.Compare(a.Name, b.Name) },
+	"status":     func(a, b Task) int { return cmp.Compare(a.Status, b.Status) },
+	"priority":   func(a, b Task) int { return cmp.Compare(a.Priority, b.Priority) },
+	"created_at": func(a, b Task) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated_at": func(a, b Task) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+	"position":   func(a, b Task) int { return cmp.Compare(a.Position, b.Position) },
+}
+
+// parseSort validates the sort field and order of a list request, defaulting
+// to ascending by name.
+func parseSort(field, order string) (string, bool, error) {
+	if field == "" {
+		field = "name"
+	}
+	if _, ok := taskSorters[field]; !ok {
+		return "", false, errors.New("Sort must be one of name, status, priority, created_at, updated_at or position")
+	}
+	if order != "" && order != "asc" && order != "desc" {
+		return "", false, errors.New("Order must be asc or desc")
+	}
+	return field, order == "desc", nil
+}
+
+// sortTasks orders tasks by the named field, breaking ties by ID so the
+// result is deterministic.
+func sortTasks(tasks []Task, field string, desc bool) {
+	slices.SortFunc(tasks, taskComparator(field, desc))
 }
 
+// taskComparator returns the total order sortTasks sorts by.
+func taskComparator(field string, desc bool) func(a, b Task) int {
+	compare := taskSorters[field]
+	return func(a, b Task) int {
+		c := compare(a, b)
+		if c == 0 {
+			c = strings.Compare(a.ID, b.ID)
+		}
+		if desc {
+			return -c
+		}
+		return c
+	}
+}
+
+// Pagination defaults for listing tasks.
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+// errVersionConflict is returned from an update when the client's version of
+// the task is not the stored one.
+var errVersionConflict = errors.New("version conflict")
+
+// errTrashed is returned from an update of a task in the trash. It is an
+// ErrNotFound, since trashed tasks are hidden from clients.
+var errTrashed = fmt.Errorf("%w: task is in the trash", ErrNotFound)
+
+// errPreconditionFailed is returned from an update when the task no longer
+// matches the client's If-Match header.
+var errPreconditionFailed = errors.New("precondition failed")
+
+// Errors returned by validateParent.
+var (
+	errParentNotFound = errors.New("Parent task not found")
+	errSelfParent     = errors.New("Task cannot be its own parent")
+	errParentCycle    = errors.New("Parent cannot be a subtask of the task")
+)
+
+// Maximum lengths, in characters, of a task's text fields.
+const (
+	maxNameLength        = 200
+	maxDescriptionLength = 2000
+	maxAssigneeLength    = 100
+	maxTagLength         = 50
+)
+
+// maxTags bounds how many tags a task may have. It is set once at startup
+// from Config.MaxTags.
+var maxTags = 20
+
+// tagPattern matches the characters a normalized tag may consist of.
+var tagPattern = regexp.MustCompile(`^[\p{L}\p{M}\p{N}_.:/-]+$`)
+
+// shutdownTimeout bounds how long in-flight requests may take to drain once a
+// termination signal is received.
+const shutdownTimeout = 10 * time.Second
+
 type Handlers struct {
-	store *TaskStore
+	store       Store
+	events      *eventBroker
+	activity    *activityLog
+	logger      *slog.Logger
+	idempotency *idempotencyCache
+	ids         IDGenerator
+	maxTasks    int                // 0 means unlimited
+	pollTimeout time.Duration      // longest a GET /tasks/poll waits for a change
+	sanitizer   *bluemonday.Policy // strips HTML from names and descriptions; nil when off
+	bareLists   bool               // GET /tasks answers with a bare array, as it used to
+	tenant      string             // whose tasks these are, with MULTI_TENANT on
+	draining    *atomic.Bool       // set once shutdown begins, failing /readyz; nil in tests
+
+	// Applied to created tasks whose payload omits the field.
+	defaultStatus   Status
+	defaultPriority int
+
+	// Whether deleting a project with tasks deletes them too, unless the
+	// request says otherwise.
+	cascadeProjects bool
 }
 
 func main() {
-	store := NewTaskStore()
-	h := &Handlers{store: store}
+	cfg, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	logger := newLogger(os.Stderr, cfg)
+	slog.SetDefault(logger)
+	statusAsString = cfg.StatusFormat == "string"
+	maxTags = cfg.MaxTags
+	validationRules = cfg.ValidationRules
+
+	store, err := openStore(cfg, logger)
+	if err != nil {
+		logger.Error("Failed to open store", "error", err)
+		os.Exit(1)
+	}
+	ids, err := newIDGenerator(context.Background(), cfg.IDScheme, store)
+	if err != nil {
+		logger.Error("Failed to load task IDs", "error", err)
+		os.Exit(1)
+	}
+	h := newHandlers(cfg, store, ids, logger)
+	if cfg.SeedFile != "" {
+		if err := h.seedStore(cfg.SeedFile); err != nil {
+			logger.Error("Failed to seed store", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	limiter := newIPRateLimiter(cfg.RateLimit, cfg.RateLimitBurst)
+	go limiter.evictIdle(ctx, time.Minute, 3*time.Minute)
+	// Background jobs that write to a store are waited for before it is
+	// closed.
+	var jobs sync.WaitGroup
+	h.start(ctx, cfg, &jobs)
+
+	var handler http.Handler = newRouter(h, cfg, limiter, logger)
+	stores := func() []Store { return []Store{store} }
+	var tenants *tenantRouter
+	if cfg.MultiTenant {
+		// Tenant requests are rate limited and authenticated before their
+		// tenant is set up.
+		guard := func(next http.Handler) http.Handler {
+			return rateLimitMiddleware(limiter)(authMiddleware(cfg.APIKey)(next))
+		}
+		tenants = newTenantRouter(handler, func(tenant string) (*Handlers, http.Handler, error) {
+			store, err := openTenantStore(cfg, tenant)
+			if err != nil {
+				return nil, nil, err
+			}
+			ids, err := newIDGenerator(ctx, cfg.IDScheme, store)
+			if err != nil {
+				store.Close()
+				return nil, nil, err
+			}
+			h := newHandlers(cfg, store, ids, logger.With("tenant", tenant))
+			h.tenant = tenant
+			if cfg.SeedFile != "" {
+				if err := h.seedStore(cfg.SeedFile); err != nil {
+					store.Close()
+					return nil, nil, err
+				}
+			}
+			h.start(ctx, cfg, &jobs)
+			// Requests reach the tenant's router through guard below,
+			// which has already rate limited them.
+			return h, newRouter(h, cfg, nil, logger), nil
+		}, guard, cfg.Tenants, cfg.MaxTenants, logger)
+		handler = tenants
+		stores = tenants.stores
+	}
+	prometheus.MustRegister(newTaskCountGauge(stores))
+
+	srv := &http.Server{
+		Addr:         cfg.Addr,
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	// Serving TLS also enables HTTP/2, which net/http negotiates by itself.
+	mode := "http"
+	if cfg.TLSCertFile != "" {
+		mode = "https"
+	}
+	go func() {
+		logger.Info("Starting API server", "addr", cfg.Addr, "mode", mode, "version", version, "commit", commit, "build_time", buildTime,
+			"read_timeout", cfg.ReadTimeout, "write_timeout", cfg.WriteTimeout, "idle_timeout", cfg.IdleTimeout)
+		var err error
+		if mode == "https" {
+			err = srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	var redirect *http.Server
+	if cfg.HTTPRedirectAddr != "" {
+		redirect = &http.Server{
+			Addr:         cfg.HTTPRedirectAddr,
+			Handler:      httpsRedirectHandler(cfg.Addr),
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
+		}
+		go func() {
+			logger.Info("Redirecting plain HTTP to HTTPS", "addr", cfg.HTTPRedirectAddr)
+			if err := redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Redirect server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	stop()
+	if cfg.DrainDelay > 0 {
+		// Keep serving while load balancers notice /readyz failing and stop
+		// routing here, so requests already on their way are not dropped.
+		h.draining.Store(true)
+		logger.Info("Draining before shutdown", "delay", cfg.DrainDelay)
+		time.Sleep(cfg.DrainDelay)
+	}
+	logger.Info("Shutting down server")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Server shutdown did not complete cleanly", "error", err)
+	}
+	if redirect != nil {
+		redirect.Shutdown(shutdownCtx)
+	}
+	jobs.Wait()
+	if tenants != nil {
+		tenants.close()
+	}
+	if err := store.Close(); err != nil {
+		logger.Error("Failed to close store", "error", err)
+	}
+	logger.Info("Server stopped")
+}
+
+// newHandlers returns the handlers serving the tasks in store, which is made
+// to enforce the configured task limit.
+func newHandlers(cfg Config, store Store, ids IDGenerator, logger *slog.Logger) *Handlers {
+	store.SetMaxTasks(cfg.MaxTasks)
+	return &Handlers{
+		store:       store,
+		events:      newEventBroker(),
+		activity:    newActivityLog(cfg.ActivityLogSize),
+		logger:      logger,
+		idempotency: newIdempotencyCache(cfg.IdempotencyTTL),
+		ids:         ids,
+		draining:    new(atomic.Bool),
+		maxTasks:    cfg.MaxTasks,
+		pollTimeout: cfg.PollTimeout,
+		sanitizer:   newSanitizer(cfg.SanitizeHTML),
+		bareLists:   cfg.ListFormat == "array",
+
+		defaultStatus:   cfg.DefaultStatus,
+		defaultPriority: cfg.DefaultPriority,
+
+		cascadeProjects: cfg.ProjectDelete == "cascade",
+	}
+}
+
+// start runs the background work of h until ctx is done. The jobs that write
+// to the store are added to jobs, so they can be waited for before it is
+// closed.
+func (h *Handlers) start(ctx context.Context, cfg Config, jobs *sync.WaitGroup) {
+	go h.idempotency.evictExpired(ctx, time.Minute)
+	if cfg.ActivityRetention > 0 {
+		go h.activity.expireOld(ctx, min(cfg.ActivityRetention, time.Minute), cfg.ActivityRetention)
+	}
+	for _, job := range []func(){
+		func() { h.runRecurrence(ctx, cfg.RecurrenceInterval) },
+		func() { h.runReminders(ctx, cfg.ReminderInterval) },
+		func() { h.runExpiry(ctx, cfg.ExpiryInterval) },
+	} {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job()
+		}()
+	}
+	if cfg.WebhookURL != "" {
+		n := newWebhookNotifier(cfg.WebhookURL, cfg.WebhookTimeout, h.logger)
+		n.tenant = h.tenant
+		go n.run(ctx, h.events)
+	}
+}
 
+// newRouter routes every endpoint to h, behind the middleware the
+// configuration calls for.
+func newRouter(h *Handlers, cfg Config, limiter *ipRateLimiter, logger *slog.Logger) *mux.Router {
 	r := mux.NewRouter()
-	r.HandleFunc("/tasks", h.getTasksHandler).Methods("GET")
-	r.HandleFunc("/tasks", h.createTaskHandler).Methods("POST")
+	r.HandleFunc("/healthz", healthHandler).Methods("GET")
+	r.HandleFunc("/readyz", h.readyHandler).Methods("GET")
+	r.HandleFunc("/version", versionHandler).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
+	r.HandleFunc("/graphql", h.graphQLHandler()).Methods("POST")
+	r.HandleFunc("/tasks", allowHead(h.getTasksHandler)).Methods("GET", "HEAD")
+	r.HandleFunc("/tasks", h.idempotent(h.createTaskHandler)).Methods("POST")
+	r.HandleFunc("/tasks", h.patchTasksHandler).Methods("PATCH")
+	r.HandleFunc("/tasks", h.deleteAllTasksHandler).Methods("DELETE")
+	r.HandleFunc("/tasks/batch-delete", h.batchDeleteTasksHandler).Methods("POST")
+	r.HandleFunc("/tasks/bulk", h.createTasksBulkHandler).Methods("POST")
+	r.HandleFunc("/tasks/complete-all", h.completeAllTasksHandler).Methods("POST")
+	r.HandleFunc("/tasks/activity", h.getActivityHandler).Methods("GET")
+	r.HandleFunc("/tasks/events", h.taskEventsHandler).Methods("GET")
+	r.HandleFunc("/tasks/poll", h.pollTasksHandler).Methods("GET")
+	r.HandleFunc("/tasks/export.csv", h.exportTasksCSVHandler).Methods("GET")
+	r.HandleFunc("/tasks/import", h.importTasksCSVHandler).Methods("POST")
+	r.HandleFunc("/tasks/restore", h.restoreSnapshotHandler).Methods("POST")
+	r.HandleFunc("/tasks/search", h.searchTasksHandler).Methods("POST")
+	r.HandleFunc("/tasks/snapshot", h.getSnapshotHandler).Methods("GET")
+	r.HandleFunc("/tasks/stats", h.getTaskStatsHandler).Methods("GET")
+	r.HandleFunc("/tasks/tags", h.getTagsHandler).Methods("GET")
+	r.HandleFunc("/tasks/transaction", h.idempotent(h.transactionHandler)).Methods("POST")
+	r.HandleFunc("/tasks/{id}", allowHead(h.getTaskHandler)).Methods("GET", "HEAD")
 	r.HandleFunc("/tasks/{id}", h.updateTaskHandler).Methods("PUT")
+	r.HandleFunc("/tasks/{id}", h.patchTaskHandler).Methods("PATCH")
 	r.HandleFunc("/tasks/{id}", h.deleteTaskHandler).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}/restore", h.restoreTaskHandler).Methods("POST")
+	r.HandleFunc("/tasks/{id}/duplicate", h.idempotent(h.duplicateTaskHandler)).Methods("POST")
+	r.HandleFunc("/tasks/{id}/archive", h.archiveTaskHandler).Methods("POST")
+	r.HandleFunc("/tasks/{id}/unarchive", h.unarchiveTaskHandler).Methods("POST")
+	r.HandleFunc("/tasks/{id}/complete", h.completeTaskHandler).Methods("POST")
+	r.HandleFunc("/tasks/{id}/reopen", h.reopenTaskHandler).Methods("POST")
+	r.HandleFunc("/tasks/{id}/move-to/{projectID}", h.moveTaskToProjectHandler).Methods("POST")
+	r.HandleFunc("/tasks/{id}/comments", h.getCommentsHandler).Methods("GET")
+	r.HandleFunc("/tasks/{id}/comments", h.createCommentHandler).Methods("POST")
+	r.HandleFunc("/tasks/{id}/move", h.moveTaskHandler).Methods("PUT")
+	r.HandleFunc("/tasks/{id}/purge", h.purgeTaskHandler).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}/subtasks", h.getSubtasksHandler).Methods("GET")
+	r.HandleFunc("/tasks/{id}/blockers", h.getBlockersHandler).Methods("GET")
+	r.HandleFunc("/tasks/{id}/history", h.getTaskHistoryHandler).Methods("GET")
+	r.HandleFunc("/templates", h.getTemplatesHandler).Methods("GET")
+	r.HandleFunc("/templates", h.createTemplateHandler).Methods("POST")
+	r.HandleFunc("/templates/{id}", h.getTemplateHandler).Methods("GET")
+	r.HandleFunc("/templates/{id}/apply", h.idempotent(h.applyTemplateHandler)).Methods("POST")
+	r.HandleFunc("/projects", h.getProjectsHandler).Methods("GET")
+	r.HandleFunc("/projects", h.createProjectHandler).Methods("POST")
+	r.HandleFunc("/projects/{id}", h.getProjectHandler).Methods("GET")
+	r.HandleFunc("/projects/{id}", h.updateProjectHandler).Methods("PUT")
+	r.HandleFunc("/projects/{id}", h.deleteProjectHandler).Methods("DELETE")
+	// Preflight requests must match a route for r.Use middleware to see them.
+	r.Methods(http.MethodOptions).HandlerFunc(preflightHandler)
+	r.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	r.MethodNotAllowedHandler = methodNotAllowedHandler(r)
+	r.Use(requestIDMiddleware)
+	r.Use(loggingMiddleware(logger))
+	r.Use(metricsMiddleware)
+	r.Use(gzipMiddleware)
+	r.Use(prettyJSONMiddleware(cfg.PrettyJSON))
+	r.Use(jsonAPIMiddleware)
+	if cfg.SecurityHeaders {
+		r.Use(securityHeadersMiddleware(cfg.ContentSecurityPolicy))
+	}
+	if cfg.CORSEnabled {
+		r.Use(corsMiddleware(cfg.CORSAllowedOrigin, cfg.CORSMaxAge))
+	}
+	r.Use(rateLimitMiddleware(limiter))
+	r.Use(authMiddleware(cfg.APIKey))
+	r.Use(jsonContentTypeMiddleware("/tasks/import"))
+	r.Use(bodyLimitMiddleware(cfg.MaxBodyBytes))
+	r.Use(requestTimeoutMiddleware(cfg.RequestTimeout, "/tasks/events", "/tasks/poll"))
+
+	return r
+}
+
+// openStore creates the Store selected by the configuration: PostgreSQL when
+// a database URL is set, then SQLite when a database path is set, otherwise
+// memory.
+func openStore(cfg Config, logger *slog.Logger) (Store, error) {
+	if cfg.DatabaseURL != "" {
+		logger.Info("Using PostgreSQL store")
+		return NewPostgresStore(cfg.DatabaseURL)
+	}
+	if cfg.SQLitePath != "" {
+		logger.Info("Using SQLite store", "path", cfg.SQLitePath)
+		return NewSQLiteStore(cfg.SQLitePath)
+	}
+	return NewMemoryStore(cfg.TasksFile)
+}
 
-	log.Println("Starting API server on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+// newLogger creates a logger writing to w in the configured format and at the
+// configured level.
+func newLogger(w io.Writer, cfg Config) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: cfg.LogLevel}
+	var handler slog.Handler = slog.NewJSONHandler(w, opts)
+	if cfg.LogFormat == "text" {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(requestIDLogHandler{handler})
 }
 
 // Handler methods
 
+// healthHandler reports that the process is up. It deliberately does not touch
+// the store so a busy store cannot block liveness probes.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyHandler reports whether the server can serve requests, which unlike
+// liveness depends on the store being reachable, so that traffic is only
+// routed here while it is. It also fails while the server drains before
+// shutting down.
+func (h *Handlers) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if h.draining != nil && h.draining.Load() {
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		return
+	}
+	if err := h.store.Ping(r.Context()); err != nil {
+		h.logger.WarnContext(r.Context(), "Store is not ready", "error", err)
+		respondJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable"})
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
 func (h *Handlers) getTasksHandler(w http.ResponseWriter, r *http.Request) {
-	h.store.mu.RLock()
-	defer h.store.mu.RUnlock()
+	query := r.URL.Query()
+	limit, err := parseNonNegativeInt(query.Get("limit"), defaultPageLimit)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Limit must be a non-negative integer")
+		return
+	}
+	offset, err := parseNonNegativeInt(query.Get("offset"), 0)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Offset must be a non-negative integer")
+		return
+	}
+	// Streamed lists are not built up as one response, so need no page cap.
+	stream := acceptsNDJSON(r.Header.Get("Accept"))
+	if limit > maxPageLimit && !stream {
+		limit = maxPageLimit
+	}
+	cursor := query.Get("cursor")
+	if cursor != "" && query.Has("offset") {
+		respondError(w, http.StatusBadRequest, "Cursor and offset cannot be used together")
+		return
+	}
+
+	sortField, desc, err := parseSort(query.Get("sort"), query.Get("order"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter, err := parseTaskFilter(query)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFields(query.Get("fields"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tasks, err := h.filteredTasks(r.Context(), filter)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	sortTasks(tasks, sortField, desc)
+	if stream && !query.Has("limit") {
+		limit = len(tasks)
+	}
+	list := TaskList{Total: len(tasks)}
+	if cursor != "" {
+		last, err := parseCursor(cursor, sortField, desc)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		list.Tasks, list.NextCursor = pageAfter(tasks, last, sortField, desc, limit)
+	} else {
+		list.Tasks, list.NextCursor = pageFrom(tasks, offset, sortField, desc, limit)
+	}
+	if stream {
+		respondTaskStream(w, r, list, fields)
+		return
+	}
+	if h.bareLists {
+		respondTaskArray(w, r, list, fields)
+		return
+	}
+	respondJSON(w, http.StatusOK, selectListFields(list, fields))
+}
 
-	tasks := make([]Task, 0, len(h.store.tasks))
-	for _, task := range h.store.tasks {
-		tasks = append(tasks, task)
+// respondTaskArray writes a page of tasks the way GET /tasks used to, as a
+// bare array, for clients that predate the {"tasks", "total"} object. The
+// total goes in the X-Total-Count header and the next page, if any, in a Link
+// header.
+func respondTaskArray(w http.ResponseWriter, r *http.Request, list TaskList, fields map[string]bool) {
+	setListHeaders(w, r, list)
+	tasks := make([]any, 0, len(list.Tasks))
+	for _, task := range list.Tasks {
+		tasks = append(tasks, selectFields(task, fields))
 	}
 	respondJSON(w, http.StatusOK, tasks)
 }
 
+// getTaskStatsHandler counts the tasks by status in a single pass, so
+// dashboards don't need to download every task. Tasks in the trash are not
+// counted.
+func (h *Handlers) getTaskStatsHandler(w http.ResponseWriter, r *http.Request) {
+	tasks, err := h.store.GetAll(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	var stats TaskStats
+	for _, task := range tasks {
+		if task.DeletedAt != nil {
+			continue
+		}
+		stats.Total++
+		if task.Status == 1 {
+			stats.Completed++
+		} else {
+			stats.Incomplete++
+		}
+	}
+	stats.Activity = h.activity.size()
+	respondJSON(w, http.StatusOK, stats)
+}
+
+func (h *Handlers) getTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	includeDeleted, err := parseBoolParam(r.URL.Query().Get("include_deleted"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Include_deleted must be true or false")
+		return
+	}
+	fields, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	task, err := h.store.Get(r.Context(), id)
+	if err == nil && task.DeletedAt != nil && !includeDeleted {
+		err = ErrNotFound
+	}
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	etag := taskETag(task)
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	respondJSON(w, http.StatusOK, selectFields(task, fields))
+}
+
 func (h *Handlers) createTaskHandler(w http.ResponseWriter, r *http.Request) {
-	var task Task
-	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	dedupe, err := parseBoolParam(r.URL.Query().Get("dedupe"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Dedupe must be true or false")
 		return
 	}
-	if task.Name == "" || (task.Status != 0 && task.Status != 1) {
-		respondError(w, http.StatusBadRequest, "Name is required and status must be 0 or 1")
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	h.store.mu.Lock()
-	defer h.store.mu.Unlock()
+	task := h.newTask()
+	if err := decodeValidatedBody(r, taskSchema, &task); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	h.sanitizeTask(&task)
+	normalizeTask(&task)
+	if err := validateTask(task); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if dedupe {
+		existing, found, err := h.findByName(r.Context(), task.Name)
+		if err != nil {
+			h.storeError(r.Context(), w, err)
+			return
+		}
+		if found {
+			w.Header().Set("Location", "/tasks/"+existing.ID)
+			respondJSON(w, http.StatusOK, existing)
+			return
+		}
+	}
+	if task.ParentID != nil {
+		if err := h.validateParent(r.Context(), "", *task.ParentID); err != nil {
+			h.parentError(r.Context(), w, err)
+			return
+		}
+	}
+	if err := h.validateDependencies(r.Context(), "", task.DependsOn); err != nil {
+		h.dependencyError(r.Context(), w, err)
+		return
+	}
+	if err := h.validateProject(r.Context(), task.ProjectID); err != nil {
+		h.projectError(r.Context(), w, err)
+		return
+	}
+	if err := h.checkNewCompletion(r.Context(), task); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
 
-	task.ID = uuid.New().String()
-	h.store.tasks[task.ID] = task
+	if err := h.prepareNewTask(&task, time.Now().UTC()); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.checkCapacity(r.Context(), w, 1) {
+		return
+	}
+	if task.Position, err = h.nextPosition(r.Context()); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, task)
+		return
+	}
+	if err := h.store.Create(r.Context(), task); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventCreated, task)
+	w.Header().Set("Location", "/tasks/"+task.ID)
 	respondJSON(w, http.StatusCreated, task)
 }
 
-func (h *Handlers) updateTaskHandler(w http.ResponseWriter, r *http.Request) {
-	id := mux.Vars(r)["id"]
+func (h *Handlers) createTasksBulkHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	h.store.mu.Lock()
-	defer h.store.mu.Unlock()
+	var items []json.RawMessage
+	if err := decodeJSON(r, &items); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	tasks := make([]Task, len(items))
+	for i, item := range items {
+		tasks[i] = h.newTask()
+		if err := decodeValidated(item, taskSchema, &tasks[i]); err != nil {
+			var schemaErr *schemaError
+			if errors.As(err, &schemaErr) {
+				schemaErr.subject = fmt.Sprintf("Task at index %d", i)
+				respondSchemaError(w, schemaErr)
+				return
+			}
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Task at index %d: %s", i, payloadError(err)))
+			return
+		}
+		h.sanitizeTask(&tasks[i])
+		normalizeTask(&tasks[i])
+		if err := validateTask(tasks[i]); err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Task at index %d: %v", i, err))
+			return
+		}
+		if tasks[i].ParentID != nil {
+			if err := h.validateParent(r.Context(), "", *tasks[i].ParentID); err != nil {
+				h.parentError(r.Context(), w, fmt.Errorf("Task at index %d: %w", i, err))
+				return
+			}
+		}
+		if err := h.validateDependencies(r.Context(), "", tasks[i].DependsOn); err != nil {
+			h.dependencyError(r.Context(), w, fmt.Errorf("Task at index %d: %w", i, err))
+			return
+		}
+		if err := h.validateProject(r.Context(), tasks[i].ProjectID); err != nil {
+			h.projectError(r.Context(), w, fmt.Errorf("Task at index %d: %w", i, err))
+			return
+		}
+		if err := h.checkNewCompletion(r.Context(), tasks[i]); err != nil {
+			h.storeError(r.Context(), w, fmt.Errorf("Task at index %d: %w", i, err))
+			return
+		}
+	}
 
-	task, exists := h.store.tasks[id]
-	if !exists {
-		respondError(w, http.StatusNotFound, "Task not found")
+	now := time.Now().UTC()
+	for i := range tasks {
+		if err := h.prepareNewTask(&tasks[i], now); err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Task at index %d: %v", i, err))
+			return
+		}
+	}
+	if !h.checkCapacity(r.Context(), w, len(tasks)) {
+		return
+	}
+	position, err := h.nextPosition(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	for i := range tasks {
+		tasks[i].Position = position + float64(i)*positionGap
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, tasks)
 		return
 	}
+	if err := h.store.Create(r.Context(), tasks...); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventCreated, tasks...)
+	respondJSON(w, http.StatusCreated, tasks)
+}
 
-	var updated Task
-	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+// completeAllTasksHandler marks every incomplete task as completed in one
+// atomic update. The body is optional; if it has an "ids" list, only those
+// tasks are completed, and naming one whose dependencies stay incomplete
+// fails the request. Otherwise such tasks are left incomplete. Dependencies
+// completed by the same request count as met.
+func (h *Handlers) completeAllTasksHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+		respondPayloadError(w, err)
+		return
+	}
+	if err := validationRules.checkStatus(StatusCompleted); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var ids map[string]bool
+	if req.IDs != nil {
+		ids = make(map[string]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			if task, err := h.store.Get(r.Context(), id); err != nil || task.DeletedAt != nil {
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					h.storeError(r.Context(), w, err)
+					return
+				}
+				respondError(w, http.StatusNotFound, fmt.Sprintf("Task %s not found", id))
+				return
+			}
+			ids[id] = true
+		}
+	}
+
+	all, err := h.store.GetAll(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	completing := make(map[string]bool)
+	for _, task := range all {
+		if task.Status == 0 && task.DeletedAt == nil && (ids == nil || ids[task.ID]) {
+			completing[task.ID] = true
+		}
+	}
+	incomplete := make(map[string]bool)
+	for _, task := range all {
+		if task.Status == 0 && task.DeletedAt == nil && !completing[task.ID] {
+			incomplete[task.ID] = true
+		}
+	}
+	// A task left incomplete holds up the tasks depending on it in turn, so
+	// repeat until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, task := range all {
+			if !completing[task.ID] {
+				continue
+			}
+			if err := blockedError(unmetDependencies(task, incomplete)); err != nil {
+				if ids != nil {
+					h.storeError(r.Context(), w, fmt.Errorf("Task %s: %w", task.ID, err))
+					return
+				}
+				delete(completing, task.ID)
+				incomplete[task.ID] = true
+				changed = true
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	updated, err := h.updateMatching(r.Context(), dryRun, func(task Task) bool {
+		return completing[task.ID] && task.Status == 0 && task.DeletedAt == nil
+	}, func(task *Task) error {
+		task.Status = 1
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
 		return
 	}
-	if updated.Name == "" || (updated.Status != 0 && updated.Status != 1) {
-		respondError(w, http.StatusBadRequest, "Name is required and status must be 0 or 1")
+	if dryRun {
+		respondJSON(w, http.StatusOK, map[string]any{"updated": len(updated), "tasks": updated})
 		return
 	}
-	updated.ID = task.ID
-	h.store.tasks[id] = updated
-	respondJSON(w, http.StatusOK, updated)
+	h.publish(eventUpdated, updated...)
+	respondJSON(w, http.StatusOK, map[string]int{"updated": len(updated)})
 }
 
-func (h *Handlers) deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) updateTaskHandler(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	h.store.mu.Lock()
-	defer h.store.mu.Unlock()
+	var updated Task
+	if err := decodeValidatedBody(r, taskSchema, &updated); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	h.sanitizeTask(&updated)
+	normalizeTask(&updated)
+	if err := validateTask(updated); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if updated.ParentID != nil {
+		if err := h.validateParent(r.Context(), id, *updated.ParentID); err != nil {
+			h.parentError(r.Context(), w, err)
+			return
+		}
+	}
+	if err := h.validateDependencies(r.Context(), id, updated.DependsOn); err != nil {
+		h.dependencyError(r.Context(), w, err)
+		return
+	}
+	if err := h.validateProject(r.Context(), updated.ProjectID); err != nil {
+		h.projectError(r.Context(), w, err)
+		return
+	}
+	incomplete, err := h.blockingTasks(r.Context(), updated)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
 
-	if _, exists := h.store.tasks[id]; !exists {
-		respondError(w, http.StatusNotFound, "Task not found")
+	ifMatch := r.Header.Get("If-Match")
+	var before Task
+	task, err := h.update(r.Context(), id, dryRun, func(task *Task) error {
+		if task.DeletedAt != nil {
+			return errTrashed
+		}
+		if ifMatch != "" && !etagMatches(ifMatch, taskETag(*task)) {
+			return errPreconditionFailed
+		}
+		if updated.Version != task.Version {
+			return errVersionConflict
+		}
+		if err := completionBlocked(task.Status, updated, incomplete); err != nil {
+			return err
+		}
+		before = *task
+		updated.ID = task.ID
+		updated.CreatedAt = task.CreatedAt
+		updated.UpdatedAt = time.Now().UTC()
+		updated.DeletedAt = nil
+		updated.Archived = task.Archived
+		updated.Position = task.Position
+		if sameTime(updated.RemindAt, task.RemindAt) {
+			updated.RemindedAt = task.RemindedAt
+		}
+		updated.Version = task.Version + 1
+		*task = updated
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) && !errors.Is(err, errTrashed) {
+		// PUT creates the task when there is nothing to replace, unless the
+		// client expected to replace a particular version of it.
+		if ifMatch != "" {
+			h.storeError(r.Context(), w, errPreconditionFailed)
+			return
+		}
+		updated.ID = id
+		if err := completionBlocked(StatusIncomplete, updated, incomplete); err != nil {
+			h.storeError(r.Context(), w, err)
+			return
+		}
+		if err := h.prepareNewTask(&updated, time.Now().UTC()); err != nil {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !h.checkCapacity(r.Context(), w, 1) {
+			return
+		}
+		if updated.Position, err = h.nextPosition(r.Context()); err != nil {
+			h.storeError(r.Context(), w, err)
+			return
+		}
+		if dryRun {
+			respondJSON(w, http.StatusOK, updated)
+			return
+		}
+		if err := h.store.Create(r.Context(), updated); err != nil {
+			h.storeError(r.Context(), w, err)
+			return
+		}
+		h.publish(eventCreated, updated)
+		w.Header().Set("Location", "/tasks/"+updated.ID)
+		w.Header().Set("ETag", taskETag(updated))
+		respondJSON(w, http.StatusCreated, updated)
 		return
 	}
-	delete(h.store.tasks, id)
-	w.WriteHeader(http.StatusNoContent)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, task)
+		return
+	}
+	h.publishUpdate(before, task)
+	w.Header().Set("ETag", taskETag(task))
+	respondJSON(w, http.StatusOK, task)
 }
 
-// Helper functions
+// TaskBulkPatch is the body of a bulk update: the fields in Set are applied to
+// every task matching Filter.
+type TaskBulkPatch struct {
+	Filter struct {
+		Status   *Status `json:"status"`
+		Tag      string  `json:"tag"`
+		Assignee string  `json:"assignee"`
+		Overdue  bool    `json:"overdue"`
+	} `json:"filter"`
+	Set json.RawMessage `json:"set"`
+}
+
+// patchTasksHandler applies the same partial update to every task matching a
+// filter, atomically, and reports how many changed. Tasks in the trash or
+// archived are left alone. Moving tasks to another parent one at a time keeps
+// cycle checks simple, so neither the parent nor the dependencies can be set
+// in bulk. Completing a task whose dependencies are incomplete fails the
+// whole update.
+func (h *Handlers) patchTasksHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req TaskBulkPatch
+	if err := decodeJSON(r, &req); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	if req.Filter.Status != nil && !req.Filter.Status.valid() {
+		respondError(w, http.StatusBadRequest, errInvalidStatus.Error())
+		return
+	}
+	if req.Set == nil {
+		respondError(w, http.StatusBadRequest, "Set is required")
+		return
+	}
+	var patch TaskPatch
+	if err := decodeValidated(req.Set, taskPatchSchema, &patch); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	if patch == (TaskPatch{}) {
+		respondError(w, http.StatusBadRequest, "Set must change at least one field")
+		return
+	}
+	if patch.ParentID != nil {
+		respondError(w, http.StatusBadRequest, "Parent_id cannot be set in a bulk update")
+		return
+	}
+	if patch.DependsOn != nil {
+		respondError(w, http.StatusBadRequest, "Depends_on cannot be set in a bulk update")
+		return
+	}
+	h.sanitizePatch(&patch)
+	if err := normalizePatch(&patch); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if patch.ProjectID != nil {
+		if err := h.validateProject(r.Context(), *patch.ProjectID); err != nil {
+			h.projectError(r.Context(), w, err)
+			return
+		}
+	}
+
+	filter := taskFilter{
+		status:   req.Filter.Status,
+		tag:      normalizeTag(req.Filter.Tag),
+		assignee: strings.TrimSpace(req.Filter.Assignee),
+	}
+	now := time.Now().UTC()
+	if req.Filter.Overdue {
+		filter.overdueAt = now
+	}
+	incomplete, err := h.patchBlockingTasks(r.Context(), patch)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	before := make(map[string]Task)
+	updated, err := h.updateMatching(r.Context(), dryRun, filter.matches, func(task *Task) error {
+		before[task.ID] = *task
+		was := task.Status
+		applyPatch(task, patch)
+		if err := completionBlocked(was, *task, incomplete); err != nil {
+			return fmt.Errorf("Task %s: %w", task.ID, err)
+		}
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, map[string]any{"updated": len(updated), "tasks": updated})
+		return
+	}
+	for _, task := range updated {
+		h.publishUpdate(before[task.ID], task)
+	}
+	respondJSON(w, http.StatusOK, map[string]int{"updated": len(updated)})
+}
+
+func (h *Handlers) patchTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var patch TaskPatch
+	if err := decodeValidatedBody(r, taskPatchSchema, &patch); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	h.sanitizePatch(&patch)
+	if err := normalizePatch(&patch); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if patch.ParentID != nil && *patch.ParentID != "" {
+		if err := h.validateParent(r.Context(), id, *patch.ParentID); err != nil {
+			h.parentError(r.Context(), w, err)
+			return
+		}
+	}
+	if patch.DependsOn != nil {
+		if err := h.validateDependencies(r.Context(), id, *patch.DependsOn); err != nil {
+			h.dependencyError(r.Context(), w, err)
+			return
+		}
+	}
+	if patch.ProjectID != nil {
+		if err := h.validateProject(r.Context(), *patch.ProjectID); err != nil {
+			h.projectError(r.Context(), w, err)
+			return
+		}
+	}
+	incomplete, err := h.patchBlockingTasks(r.Context(), patch)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	var before Task
+	task, err := h.update(r.Context(), id, dryRun, func(task *Task) error {
+		if task.DeletedAt != nil {
+			return ErrNotFound
+		}
+		if ifMatch != "" && !etagMatches(ifMatch, taskETag(*task)) {
+			return errPreconditionFailed
+		}
+		before = *task
+		was := task.Status
+		applyPatch(task, patch)
+		if err := completionBlocked(was, *task, incomplete); err != nil {
+			return err
+		}
+		task.UpdatedAt = time.Now().UTC()
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, task)
+		return
+	}
+	h.publishUpdate(before, task)
+	w.Header().Set("ETag", taskETag(task))
+	respondJSON(w, http.StatusOK, task)
+}
+
+// deleteTaskHandler moves a task to the trash. It stays in the store, hidden
+// from reads, until it is restored or purged, and the response is empty. With
+// ?idempotent=true the handler answers with the task instead, and a task
+// already in the trash is returned as is rather than reported missing, so a
+// client can retry a delete whose response it lost.
+func (h *Handlers) deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	idempotent, err := parseBoolParam(r.URL.Query().Get("idempotent"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Idempotent must be true or false")
+		return
+	}
+
+	if h.blockedBySubtasks(r.Context(), w, id, false) {
+		return
+	}
+	alreadyDeleted := false
+	task, err := h.update(r.Context(), id, dryRun, func(task *Task) error {
+		if task.DeletedAt != nil {
+			if idempotent {
+				alreadyDeleted = true
+				return nil
+			}
+			return ErrNotFound
+		}
+		now := time.Now().UTC()
+		task.DeletedAt = &now
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, task)
+		return
+	}
+	if !alreadyDeleted {
+		h.publish(eventDeleted, task)
+	}
+	if idempotent {
+		respondJSON(w, http.StatusOK, task)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handlers) restoreTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	task, err := h.store.Update(r.Context(), id, func(task *Task) error {
+		if task.DeletedAt != nil {
+			task.DeletedAt = nil
+			task.UpdatedAt = time.Now().UTC()
+			task.Version++
+		}
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventUpdated, task)
+	respondJSON(w, http.StatusOK, task)
+}
+
+// archiveTaskHandler hides a task from the default list without changing its
+// status, so completed and abandoned tasks can be told apart.
+func (h *Handlers) archiveTaskHandler(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, true)
+}
+
+// unarchiveTaskHandler returns an archived task to the default list.
+func (h *Handlers) unarchiveTaskHandler(w http.ResponseWriter, r *http.Request) {
+	h.setArchived(w, r, false)
+}
+
+// setArchived archives or unarchives the task named in the request. Tasks in
+// the trash cannot be changed.
+func (h *Handlers) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	id := mux.Vars(r)["id"]
+
+	task, err := h.store.Update(r.Context(), id, func(task *Task) error {
+		if task.DeletedAt != nil {
+			return errTrashed
+		}
+		if task.Archived != archived {
+			task.Archived = archived
+			task.UpdatedAt = time.Now().UTC()
+			task.Version++
+		}
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventUpdated, task)
+	respondJSON(w, http.StatusOK, task)
+}
+
+// completeTaskHandler marks a task as completed. As with any update, a task
+// cannot be completed while its dependencies are incomplete.
+func (h *Handlers) completeTaskHandler(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, StatusCompleted)
+}
+
+// reopenTaskHandler marks a completed task as incomplete again.
+func (h *Handlers) reopenTaskHandler(w http.ResponseWriter, r *http.Request) {
+	h.setStatus(w, r, StatusIncomplete)
+}
+
+// setStatus sets the status of the task named in the request. A task that
+// already has the status is returned unchanged. Tasks in the trash cannot be
+// changed.
+func (h *Handlers) setStatus(w http.ResponseWriter, r *http.Request, status Status) {
+	id := mux.Vars(r)["id"]
+	if err := validationRules.checkStatus(status); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var incomplete map[string]bool
+	if status == StatusCompleted {
+		var err error
+		if incomplete, err = h.incompleteTasks(r.Context()); err != nil {
+			h.storeError(r.Context(), w, err)
+			return
+		}
+	}
+	var before Task
+	task, err := h.store.Update(r.Context(), id, func(task *Task) error {
+		if task.DeletedAt != nil {
+			return errTrashed
+		}
+		before = *task
+		if task.Status == status {
+			return nil
+		}
+		task.Status = status
+		if err := completionBlocked(before.Status, *task, incomplete); err != nil {
+			return err
+		}
+		task.UpdatedAt = time.Now().UTC()
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if task.Status != before.Status {
+		h.publishUpdate(before, task)
+	}
+	respondJSON(w, http.StatusOK, task)
+}
+
+// purgeTaskHandler permanently removes a task, whether or not it is in the
+// trash.
+func (h *Handlers) purgeTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if h.blockedBySubtasks(r.Context(), w, id, true) {
+		return
+	}
+	if dryRun {
+		task, err := h.store.Get(r.Context(), id)
+		if err != nil {
+			h.storeError(r.Context(), w, err)
+			return
+		}
+		respondJSON(w, http.StatusOK, task)
+		return
+	}
+	if err := h.store.Delete(r.Context(), id); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventDeleted, Task{ID: id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getSubtasksHandler lists the direct children of a task, sorted by name.
+// Subtasks in the trash are left out.
+func (h *Handlers) getSubtasksHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	parent, err := h.store.Get(r.Context(), id)
+	if err == nil && parent.DeletedAt != nil {
+		err = ErrNotFound
+	}
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	subtasks, err := h.subtasks(r.Context(), id, false)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	sortTasks(subtasks, "name", false)
+	respondJSON(w, http.StatusOK, TaskList{Tasks: subtasks, Total: len(subtasks)})
+}
+
+func (h *Handlers) deleteAllTasksHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("confirm") != "true" && !dryRun {
+		respondError(w, http.StatusBadRequest, "Deleting all tasks requires confirm=true")
+		return
+	}
+
+	tasks, err := h.store.GetAll(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, map[string]any{"deleted": len(tasks), "tasks": tasks})
+		return
+	}
+	if err := h.store.DeleteAll(r.Context()); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventDeleted, tasks...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Helper functions
+
+// validateTask checks the client-supplied fields of a task, returning an error
+// whose message is suitable for the response body.
+func validateTask(task Task) error {
+	if task.Name == "" || !task.Status.valid() {
+		return errors.New("Name is required and status must be incomplete, completed, 0 or 1")
+	}
+	if err := validateLength("Name", task.Name, maxNameLength); err != nil {
+		return err
+	}
+	if err := validateLength("Description", task.Description, maxDescriptionLength); err != nil {
+		return err
+	}
+	if !validPriority(task.Priority) {
+		return errors.New("Priority must be 0, 1 or 2")
+	}
+	if err := validateAssignee(task.Assignee); err != nil {
+		return err
+	}
+	if err := validateRecurrence(task.Recurrence); err != nil {
+		return err
+	}
+	if err := validateDependsOn(task.DependsOn); err != nil {
+		return err
+	}
+	if err := validateTags(task.Tags); err != nil {
+		return err
+	}
+	return validationRules.checkTask(task)
+}
+
+// normalizeTask canonicalizes client-supplied fields before validation and
+// storage.
+func normalizeTask(task *Task) {
+	if task.ParentID != nil && *task.ParentID == "" {
+		task.ParentID = nil
+	}
+	task.Name = strings.TrimSpace(task.Name)
+	task.Description = strings.TrimSpace(task.Description)
+	task.Assignee = normalizeAssignee(task.Assignee)
+	task.Recurrence = normalizeRecurrence(task.Recurrence)
+	task.Tags = normalizeTags(task.Tags)
+	task.DependsOn = normalizeDependsOn(task.DependsOn)
+}
+
+// normalizePatch canonicalizes and validates the fields a patch sets, except
+// where the parent and dependencies exist, which needs the store to check.
+func normalizePatch(patch *TaskPatch) error {
+	if patch.Name != nil {
+		name := strings.TrimSpace(*patch.Name)
+		if name == "" {
+			return errors.New("Name cannot be empty")
+		}
+		if err := validateLength("Name", name, maxNameLength); err != nil {
+			return err
+		}
+		patch.Name = &name
+	}
+	if patch.Description != nil {
+		description := strings.TrimSpace(*patch.Description)
+		if err := validateLength("Description", description, maxDescriptionLength); err != nil {
+			return err
+		}
+		patch.Description = &description
+	}
+	if patch.Status != nil && !patch.Status.valid() {
+		return errInvalidStatus
+	}
+	if patch.Priority != nil && !validPriority(*patch.Priority) {
+		return errors.New("Priority must be 0, 1 or 2")
+	}
+	if patch.Tags != nil {
+		tags := normalizeTags(*patch.Tags)
+		if err := validateTags(tags); err != nil {
+			return err
+		}
+		patch.Tags = &tags
+	}
+	if patch.Assignee != nil {
+		assignee := normalizeAssignee(*patch.Assignee)
+		if err := validateAssignee(assignee); err != nil {
+			return err
+		}
+		patch.Assignee = &assignee
+	}
+	if patch.Recurrence != nil {
+		recurrence := normalizeRecurrence(*patch.Recurrence)
+		if err := validateRecurrence(recurrence); err != nil {
+			return err
+		}
+		patch.Recurrence = &recurrence
+	}
+	if patch.DependsOn != nil {
+		dependsOn := normalizeDependsOn(*patch.DependsOn)
+		if err := validateDependsOn(dependsOn); err != nil {
+			return err
+		}
+		patch.DependsOn = &dependsOn
+	}
+	return validationRules.checkPatch(*patch)
+}
+
+// applyPatch copies the fields a normalized patch sets onto task.
+func applyPatch(task *Task, patch TaskPatch) {
+	if patch.Name != nil {
+		task.Name = *patch.Name
+	}
+	if patch.Description != nil {
+		task.Description = *patch.Description
+	}
+	if patch.Status != nil {
+		task.Status = *patch.Status
+	}
+	if patch.Priority != nil {
+		task.Priority = *patch.Priority
+	}
+	if patch.DueDate != nil {
+		task.DueDate = patch.DueDate
+	}
+	if patch.RemindAt != nil {
+		task.RemindAt = patch.RemindAt
+		task.RemindedAt = nil
+	}
+	if patch.ExpiresAt != nil {
+		task.ExpiresAt = patch.ExpiresAt
+	}
+	if patch.Tags != nil {
+		task.Tags = *patch.Tags
+	}
+	if patch.DependsOn != nil {
+		task.DependsOn = *patch.DependsOn
+	}
+	if patch.Assignee != nil {
+		task.Assignee = *patch.Assignee
+	}
+	if patch.Recurrence != nil {
+		task.Recurrence = *patch.Recurrence
+	}
+	if patch.ProjectID != nil {
+		task.ProjectID = *patch.ProjectID
+	}
+	if patch.ParentID != nil {
+		task.ParentID = patch.ParentID
+		if *patch.ParentID == "" {
+			task.ParentID = nil
+		}
+	}
+}
+
+// normalizeAssignee trims surrounding whitespace from an assignee. An assignee
+// made only of whitespace is left as is for validateAssignee to reject, rather
+// than silently becoming unassigned.
+func normalizeAssignee(assignee string) string {
+	if trimmed := strings.TrimSpace(assignee); trimmed != "" {
+		return trimmed
+	}
+	return assignee
+}
+
+// validateAssignee checks a normalized assignee. Empty means unassigned.
+func validateAssignee(assignee string) error {
+	if assignee != "" && strings.TrimSpace(assignee) == "" {
+		return errors.New("Assignee cannot be blank")
+	}
+	return validateLength("Assignee", assignee, maxAssigneeLength)
+}
+
+// validateLength checks that value is at most max characters long. field names
+// the value in the error message.
+func validateLength(field, value string, max int) error {
+	if utf8.RuneCountInString(value) > max {
+		return fmt.Errorf("%s must be at most %d characters", field, max)
+	}
+	return nil
+}
+
+// normalizeTag canonicalizes a tag so that matching is case-insensitive.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags normalizes every tag, returning an empty (not nil) slice so
+// tasks always serialize with a tags array.
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, len(tags))
+	for i, tag := range tags {
+		normalized[i] = normalizeTag(tag)
+	}
+	return normalized
+}
+
+// validateTags checks that there are at most maxTags normalized tags, and that
+// they are unique, non-empty, at most maxTagLength characters and made only
+// of letters, digits and the punctuation tagPattern allows.
+func validateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("At most %d tags are allowed", maxTags)
+	}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if tag == "" {
+			return errors.New("Tags must not be empty")
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return fmt.Errorf("Tag %q must be at most %d characters", tag, maxTagLength)
+		}
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("Tag %q may only contain letters, digits, hyphens, underscores, dots, colons and slashes", tag)
+		}
+		if seen[tag] {
+			return fmt.Errorf("Duplicate tag %q", tag)
+		}
+		seen[tag] = true
+	}
+	return nil
+}
+
+// decodeJSON decodes the request body into v, rejecting fields v does not
+// define so client typos surface as errors instead of being ignored.
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// respondPayloadError reports a request body decoding error: 413 if the body
+// was over the size limit, otherwise 400, listing any schema violations.
+func respondPayloadError(w http.ResponseWriter, err error) {
+	if tooLarge(err) {
+		respondError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+		return
+	}
+	var schemaErr *schemaError
+	if errors.As(err, &schemaErr) {
+		respondSchemaError(w, schemaErr)
+		return
+	}
+	respondError(w, http.StatusBadRequest, payloadError(err))
+}
+
+// tooLarge reports whether err came from reading past the request body limit.
+func tooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
+// payloadError converts a request body decoding error into a message suitable
+// for the response body.
+func payloadError(err error) string {
+	var parseErr *time.ParseError
+	if errors.As(err, &parseErr) {
+		return "Due date must be an RFC 3339 timestamp"
+	}
+	if errors.Is(err, errInvalidStatus) {
+		return err.Error()
+	}
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return "Unknown field " + field
+	}
+	return "Invalid request payload"
+}
+
+// validPriority reports whether p is one of the known priority levels.
+func validPriority(p int) bool {
+	return p >= 0 && p <= 2
+}
+
+// parseBoolParam parses an optional boolean query parameter value, treating
+// an empty value as false.
+func parseBoolParam(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// parseNonNegativeInt parses a query parameter value, returning def when the
+// value is empty.
+func parseNonNegativeInt(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.New("value must not be negative")
+	}
+	return n, nil
+}
+
+// paginate returns the window of tasks selected by limit and offset.
+func paginate(tasks []Task, limit, offset int) []Task {
+	if offset >= len(tasks) {
+		return []Task{}
+	}
+	end := offset + limit
+	if end > len(tasks) {
+		end = len(tasks)
+	}
+	return tasks[offset:end]
+}
+
+// prepareNewTask sets the server-managed fields of a task about to be created
+// at now. A client-supplied ID, used to keep IDs from another system on
+// import, must suit the configured ID scheme and is stored in canonical form;
+// otherwise a fresh one is generated.
+func (h *Handlers) prepareNewTask(task *Task, now time.Time) error {
+	if task.ID == "" {
+		id, err := h.ids.NewID()
+		if err != nil {
+			return err
+		}
+		task.ID = id
+	} else {
+		id, err := h.ids.ParseID(task.ID)
+		if err != nil {
+			return err
+		}
+		task.ID = id
+	}
+	task.CreatedAt = now
+	task.UpdatedAt = now
+	task.DeletedAt = nil
+	task.RemindedAt = nil
+	task.Archived = false
+	task.Version = 1
+	return nil
+}
+
+// sameTime reports whether two optional times are both unset or equal.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// newTask returns the task a create payload is decoded into, so that fields
+// the payload omits keep their configured defaults.
+func (h *Handlers) newTask() Task {
+	return Task{Status: h.defaultStatus, Priority: h.defaultPriority}
+}
+
+// filteredTasks returns the stored tasks that match filter, in no particular
+// order.
+func (h *Handlers) filteredTasks(ctx context.Context, filter taskFilter) ([]Task, error) {
+	all, err := h.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks := make([]Task, 0, len(all))
+	for _, task := range all {
+		if filter.matches(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks, nil
+}
+
+// findByName returns a task outside the trash whose name matches name
+// case-insensitively, which is what dedupe=true treats as the same task.
+func (h *Handlers) findByName(ctx context.Context, name string) (Task, bool, error) {
+	tasks, err := h.store.GetAll(ctx)
+	if err != nil {
+		return Task{}, false, err
+	}
+	for _, task := range tasks {
+		if task.DeletedAt == nil && strings.EqualFold(task.Name, name) {
+			return task, true, nil
+		}
+	}
+	return Task{}, false, nil
+}
+
+// remainingCapacity returns how many more tasks may be stored before the
+// configured maximum is reached. Tasks in the trash count towards it, since
+// they are still stored.
+func (h *Handlers) remainingCapacity(ctx context.Context) (int, error) {
+	if h.maxTasks == 0 {
+		return math.MaxInt, nil
+	}
+	n, err := h.store.Count(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return max(h.maxTasks-n, 0), nil
+}
+
+// checkCapacity responds with 507 and returns false if storing n more tasks
+// would exceed the configured maximum. It lets requests fail early, dry runs
+// included; the store enforces the limit again when the tasks are created,
+// so concurrent requests cannot get past it.
+func (h *Handlers) checkCapacity(ctx context.Context, w http.ResponseWriter, n int) bool {
+	remaining, err := h.remainingCapacity(ctx)
+	if err != nil {
+		h.storeError(ctx, w, err)
+		return false
+	}
+	if n > remaining {
+		respondError(w, http.StatusInsufficientStorage, h.capacityMessage())
+		return false
+	}
+	return true
+}
+
+// capacityMessage explains that the task limit has been reached.
+func (h *Handlers) capacityMessage() string {
+	return fmt.Sprintf("Task limit of %d reached", h.maxTasks)
+}
+
+// validateParent checks that parentID names a task, not in the trash, that can
+// be the parent of the task with the given ID: it must not be the task itself
+// or one of its descendants. id is empty for a task being created.
+func (h *Handlers) validateParent(ctx context.Context, id, parentID string) error {
+	if parentID == id {
+		return errSelfParent
+	}
+	parent, err := h.store.Get(ctx, parentID)
+	if errors.Is(err, ErrNotFound) || (err == nil && parent.DeletedAt != nil) {
+		return errParentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	for id != "" && parent.ParentID != nil {
+		if *parent.ParentID == id {
+			return errParentCycle
+		}
+		if parent, err = h.store.Get(ctx, *parent.ParentID); errors.Is(err, ErrNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parentError writes the response for an error returned by validateParent.
+func (h *Handlers) parentError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errParentNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errSelfParent), errors.Is(err, errParentCycle):
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		h.storeError(ctx, w, err)
+	}
+}
+
+// subtasks returns the direct children of the task with the given ID,
+// including those in the trash only if includeDeleted is set.
+func (h *Handlers) subtasks(ctx context.Context, id string, includeDeleted bool) ([]Task, error) {
+	all, err := h.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	children := []Task{}
+	for _, task := range all {
+		if task.ParentID != nil && *task.ParentID == id && (includeDeleted || task.DeletedAt == nil) {
+			children = append(children, task)
+		}
+	}
+	return children, nil
+}
+
+// blockedBySubtasks responds with 409 and returns true if the task with the
+// given ID still has subtasks, so deleting it would orphan them. Subtasks
+// already in the trash only count if includeDeleted is set. Deletion never
+// cascades: clients must delete or move the subtasks first.
+func (h *Handlers) blockedBySubtasks(ctx context.Context, w http.ResponseWriter, id string, includeDeleted bool) bool {
+	children, err := h.subtasks(ctx, id, includeDeleted)
+	if err != nil {
+		h.storeError(ctx, w, err)
+		return true
+	}
+	if len(children) > 0 {
+		respondError(w, http.StatusConflict, "Task has subtasks; delete or move them first")
+		return true
+	}
+	return false
+}
+
+// taskETag returns a strong entity tag for the task's current representation.
+func taskETag(task Task) string {
+	data, _ := json.Marshal(task)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether a comma-separated If-Match or If-None-Match
+// header value lists etag or is "*". Weak tags are compared by their opaque
+// part.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// storeError writes the response for an error returned by the store: 404 for
+// a missing task, 409 for a duplicate ID or a stale version, 412 for a failed
+// If-Match precondition, 500 for anything else.
+func (h *Handlers) storeError(ctx context.Context, w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		respondError(w, http.StatusNotFound, "Task not found")
+		return
+	}
+	if errors.Is(err, ErrExists) {
+		respondError(w, http.StatusConflict, "A task with this ID already exists")
+		return
+	}
+	if errors.Is(err, ErrTaskLimit) {
+		respondError(w, http.StatusInsufficientStorage, h.capacityMessage())
+		return
+	}
+	if errors.Is(err, ErrNoProject) {
+		respondError(w, http.StatusNotFound, errProjectNotFound.Error())
+		return
+	}
+	if errors.Is(err, errIDsExhausted) {
+		respondError(w, http.StatusInsufficientStorage, err.Error())
+		return
+	}
+	if errors.Is(err, errPreconditionFailed) {
+		respondError(w, http.StatusPreconditionFailed, "Task has been modified")
+		return
+	}
+	if errors.Is(err, errVersionConflict) {
+		respondError(w, http.StatusConflict, "Version does not match the stored task")
+		return
+	}
+	if errors.Is(err, ErrStale) {
+		respondError(w, http.StatusConflict, "Tasks were changed by another request; try again")
+		return
+	}
+	if errors.Is(err, errBlocked) {
+		respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		h.logger.WarnContext(ctx, "Request timed out", "error", err)
+		respondError(w, http.StatusServiceUnavailable, "Request timed out")
+		return
+	}
+	h.logger.ErrorContext(ctx, "Store error", "error", err)
+	respondError(w, http.StatusInternalServerError, "Internal server error")
+}
 
 func respondJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -128,6 +2160,8 @@ func respondJSON(w http.ResponseWriter, code int, payload interface{}) {
 	_ = json.NewEncoder(w).Encode(payload)
 }
 
+// respondError writes an error response of the form {"error": message}. Every
+// error the API returns goes through here so clients can parse them uniformly.
 func respondError(w http.ResponseWriter, code int, message string) {
 	respondJSON(w, code, map[string]string{"error": message})
 }
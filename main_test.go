@@ -2,34 +2,1036 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-// setupRouter initializes the router and handlers for testing.
-func setupRouter() (*mux.Router, *Handlers) {
-	store := NewTaskStore()
-	h := &Handlers{store: store}
+// setupRouter initializes the router and handlers for testing, backed by a
+// memory store the test can inspect directly.
+func setupRouter() (*mux.Router, *MemoryStore) {
+	store, _ := NewMemoryStore("")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := &Handlers{
+		store:       store,
+		events:      newEventBroker(),
+		activity:    newActivityLog(100),
+		logger:      logger,
+		idempotency: newIdempotencyCache(time.Hour),
+		ids:         uuidGenerator{},
+		pollTimeout: 100 * time.Millisecond,
+	}
 	router := mux.NewRouter()
-	router.HandleFunc("/tasks", h.getTasksHandler).Methods("GET")
-	router.HandleFunc("/tasks", h.createTaskHandler).Methods("POST")
+	router.HandleFunc("/healthz", healthHandler).Methods("GET")
+	router.HandleFunc("/readyz", h.readyHandler).Methods("GET")
+	router.HandleFunc("/version", versionHandler).Methods("GET")
+	router.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
+	router.HandleFunc("/graphql", h.graphQLHandler()).Methods("POST")
+	router.HandleFunc("/tasks", allowHead(h.getTasksHandler)).Methods("GET", "HEAD")
+	router.HandleFunc("/tasks", h.idempotent(h.createTaskHandler)).Methods("POST")
+	router.HandleFunc("/tasks", h.patchTasksHandler).Methods("PATCH")
+	router.HandleFunc("/tasks", h.deleteAllTasksHandler).Methods("DELETE")
+	router.HandleFunc("/tasks/batch-delete", h.batchDeleteTasksHandler).Methods("POST")
+	router.HandleFunc("/tasks/bulk", h.createTasksBulkHandler).Methods("POST")
+	router.HandleFunc("/tasks/complete-all", h.completeAllTasksHandler).Methods("POST")
+	router.HandleFunc("/tasks/activity", h.getActivityHandler).Methods("GET")
+	router.HandleFunc("/tasks/events", h.taskEventsHandler).Methods("GET")
+	router.HandleFunc("/tasks/poll", h.pollTasksHandler).Methods("GET")
+	router.HandleFunc("/tasks/export.csv", h.exportTasksCSVHandler).Methods("GET")
+	router.HandleFunc("/tasks/import", h.importTasksCSVHandler).Methods("POST")
+	router.HandleFunc("/tasks/restore", h.restoreSnapshotHandler).Methods("POST")
+	router.HandleFunc("/tasks/search", h.searchTasksHandler).Methods("POST")
+	router.HandleFunc("/tasks/snapshot", h.getSnapshotHandler).Methods("GET")
+	router.HandleFunc("/tasks/stats", h.getTaskStatsHandler).Methods("GET")
+	router.HandleFunc("/tasks/tags", h.getTagsHandler).Methods("GET")
+	router.HandleFunc("/tasks/transaction", h.idempotent(h.transactionHandler)).Methods("POST")
+	router.HandleFunc("/tasks/{id}", allowHead(h.getTaskHandler)).Methods("GET", "HEAD")
 	router.HandleFunc("/tasks/{id}", h.updateTaskHandler).Methods("PUT")
+	router.HandleFunc("/tasks/{id}", h.patchTaskHandler).Methods("PATCH")
 	router.HandleFunc("/tasks/{id}", h.deleteTaskHandler).Methods("DELETE")
-	return router, h
+	router.HandleFunc("/tasks/{id}/restore", h.restoreTaskHandler).Methods("POST")
+	router.HandleFunc("/tasks/{id}/duplicate", h.idempotent(h.duplicateTaskHandler)).Methods("POST")
+	router.HandleFunc("/tasks/{id}/archive", h.archiveTaskHandler).Methods("POST")
+	router.HandleFunc("/tasks/{id}/unarchive", h.unarchiveTaskHandler).Methods("POST")
+	router.HandleFunc("/tasks/{id}/complete", h.completeTaskHandler).Methods("POST")
+	router.HandleFunc("/tasks/{id}/reopen", h.reopenTaskHandler).Methods("POST")
+	router.HandleFunc("/tasks/{id}/move-to/{projectID}", h.moveTaskToProjectHandler).Methods("POST")
+	router.HandleFunc("/tasks/{id}/comments", h.getCommentsHandler).Methods("GET")
+	router.HandleFunc("/tasks/{id}/comments", h.createCommentHandler).Methods("POST")
+	router.HandleFunc("/tasks/{id}/move", h.moveTaskHandler).Methods("PUT")
+	router.HandleFunc("/tasks/{id}/purge", h.purgeTaskHandler).Methods("DELETE")
+	router.HandleFunc("/tasks/{id}/subtasks", h.getSubtasksHandler).Methods("GET")
+	router.HandleFunc("/tasks/{id}/blockers", h.getBlockersHandler).Methods("GET")
+	router.HandleFunc("/tasks/{id}/history", h.getTaskHistoryHandler).Methods("GET")
+	router.HandleFunc("/templates", h.getTemplatesHandler).Methods("GET")
+	router.HandleFunc("/templates", h.createTemplateHandler).Methods("POST")
+	router.HandleFunc("/templates/{id}", h.getTemplateHandler).Methods("GET")
+	router.HandleFunc("/templates/{id}/apply", h.idempotent(h.applyTemplateHandler)).Methods("POST")
+	router.HandleFunc("/projects", h.getProjectsHandler).Methods("GET")
+	router.HandleFunc("/projects", h.createProjectHandler).Methods("POST")
+	router.HandleFunc("/projects/{id}", h.getProjectHandler).Methods("GET")
+	router.HandleFunc("/projects/{id}", h.updateProjectHandler).Methods("PUT")
+	router.HandleFunc("/projects/{id}", h.deleteProjectHandler).Methods("DELETE")
+	return router, store
+}
+
+func TestHealthHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	// Hold the store's write lock to prove the probe doesn't need it
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"status":"ok"}` {
+		t.Errorf("handler returned unexpected body: got %v", body)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tasks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handlers{store: store, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	rr := httptest.NewRecorder()
+	h.readyHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	store.Close()
+	rr = httptest.NewRecorder()
+	h.readyHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code for a closed store: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+}
+
+func TestReadyHandlerDraining(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, draining: new(atomic.Bool), logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	rr := httptest.NewRecorder()
+	h.readyHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	h.draining.Store(true)
+	rr = httptest.NewRecorder()
+	h.readyHandler(rr, httptest.NewRequest("GET", "/readyz", nil))
+	if status := rr.Code; status != http.StatusServiceUnavailable || !strings.Contains(rr.Body.String(), "draining") {
+		t.Errorf("handler returned %v %s while draining, want %v", status, rr.Body, http.StatusServiceUnavailable)
+	}
+}
+
+func TestGetTasksHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	// Pre-populate store with a task
+	task := Task{ID: "1", Name: "Test Task", Description: "A test task", Status: 0}
+	store.tasks["1"] = task
+
+	req, _ := http.NewRequest("GET", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if list.Total != 1 || len(list.Tasks) != 1 || list.Tasks[0].Name != "Test Task" {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+}
+
+func TestGetTasksHandlerEmpty(t *testing.T) {
+	router, _ := setupRouter()
+
+	req, _ := http.NewRequest("GET", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"tasks":[],"total":0}` {
+		t.Errorf("handler returned wrong body for no tasks: got %s", body)
+	}
+}
+
+func TestGetTasksHandlerArrayFormat(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, bareLists: true}
+
+	rr := httptest.NewRecorder()
+	h.getTasksHandler(rr, httptest.NewRequest("GET", "/tasks", nil))
+	if body := strings.TrimSpace(rr.Body.String()); body != `[]` || rr.Header().Get("X-Total-Count") != "0" {
+		t.Errorf("handler returned wrong response for no tasks: %s, total %q", body, rr.Header().Get("X-Total-Count"))
+	}
+
+	store.tasks["1"] = Task{ID: "1", Name: "A"}
+	store.tasks["2"] = Task{ID: "2", Name: "B"}
+	rr = httptest.NewRecorder()
+	h.getTasksHandler(rr, httptest.NewRequest("GET", "/tasks?limit=1&fields=name", nil))
+	var tasks []map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &tasks); err != nil {
+		t.Fatalf("Could not parse response body as an array: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0]["name"] != "A" || rr.Header().Get("X-Total-Count") != "2" {
+		t.Errorf("handler returned wrong page: %v, total %q", tasks, rr.Header().Get("X-Total-Count"))
+	}
+	if link := rr.Header().Get("Link"); !strings.HasPrefix(link, "</tasks?") || !strings.Contains(link, "cursor=") || !strings.HasSuffix(link, `>; rel="next"`) {
+		t.Errorf("handler returned wrong Link header: %q", link)
+	}
+}
+
+func TestGetTasksHandlerPagination(t *testing.T) {
+	router, store := setupRouter()
+
+	// Pre-populate store with several tasks
+	for _, id := range []string{"1", "2", "3", "4", "5"} {
+		store.tasks[id] = Task{ID: id, Name: "Task " + id}
+	}
+
+	req, _ := http.NewRequest("GET", "/tasks?limit=2&offset=4", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if list.Total != 5 || len(list.Tasks) != 1 {
+		t.Errorf("handler returned unexpected page: got %v", rr.Body.String())
+	}
+
+	// Test invalid parameters
+	for _, query := range []string{"limit=abc", "limit=-1", "offset=-5"} {
+		req, _ = http.NewRequest("GET", "/tasks?"+query, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for %q: got %v want %v", query, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestGetTaskHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	// Pre-populate store with a task
+	taskID := "1"
+	store.tasks[taskID] = Task{ID: taskID, Name: "Test Task", Description: "A test task", Status: 0}
+
+	req, _ := http.NewRequest("GET", "/tasks/"+taskID, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var task Task
+	if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if task.ID != taskID || task.Name != "Test Task" {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+
+	// Test get non-existent task
+	req, _ = http.NewRequest("GET", "/tasks/nonexistent", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for non-existent task: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestGetTaskHandlerETag(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Cached Task"}
+
+	req, _ := http.NewRequest("GET", "/tasks/1", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("handler did not set an ETag")
+	}
+
+	req, _ = http.NewRequest("GET", "/tasks/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotModified {
+		t.Errorf("handler returned wrong status code for matching ETag: got %v want %v", status, http.StatusNotModified)
+	}
+	if rr.Body.Len() != 0 {
+		t.Errorf("handler returned a body with 304: got %v", rr.Body.String())
+	}
+
+	// A stale If-Match makes the update fail instead of overwriting
+	req, _ = http.NewRequest("PATCH", "/tasks/1", bytes.NewBuffer([]byte(`{"status": 1}`)))
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code for current If-Match: got %v want %v", status, http.StatusOK)
+	}
+	if newETag := rr.Header().Get("ETag"); newETag == "" || newETag == etag {
+		t.Errorf("handler did not return a new ETag: got %q", newETag)
+	}
+
+	req, _ = http.NewRequest("PUT", "/tasks/1", bytes.NewBuffer([]byte(`{"name": "Clobbered", "status": 0}`)))
+	req.Header.Set("If-Match", etag)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusPreconditionFailed {
+		t.Errorf("handler returned wrong status code for stale If-Match: got %v want %v", status, http.StatusPreconditionFailed)
+	}
+	if task := store.tasks["1"]; task.Name != "Cached Task" {
+		t.Errorf("stale update modified the task: got %+v", task)
+	}
+}
+
+func TestHeadHandlers(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Checked Task"}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/tasks", http.StatusOK},
+		{"/tasks/1", http.StatusOK},
+		{"/tasks/missing", http.StatusNotFound},
+		{"/tasks?limit=-1", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		get, _ := http.NewRequest("GET", tt.path, nil)
+		getRR := httptest.NewRecorder()
+		router.ServeHTTP(getRR, get)
+
+		head, _ := http.NewRequest("HEAD", tt.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, head)
+
+		if status := rr.Code; status != tt.status {
+			t.Errorf("HEAD %s returned wrong status code: got %v want %v", tt.path, status, tt.status)
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("HEAD %s returned a body: got %v", tt.path, rr.Body.String())
+		}
+		if length := rr.Header().Get("Content-Length"); length != strconv.Itoa(getRR.Body.Len()) {
+			t.Errorf("HEAD %s returned wrong Content-Length: got %q want %d", tt.path, length, getRR.Body.Len())
+		}
+		if etag := rr.Header().Get("ETag"); etag != getRR.Header().Get("ETag") {
+			t.Errorf("HEAD %s returned wrong ETag: got %q want %q", tt.path, etag, getRR.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestGetTasksHandlerStatusFilter(t *testing.T) {
+	router, store := setupRouter()
+
+	// Pre-populate store with tasks of both statuses
+	store.tasks["1"] = Task{ID: "1", Name: "Open Task", Status: 0}
+	store.tasks["2"] = Task{ID: "2", Name: "Done Task", Status: 1}
+
+	req, _ := http.NewRequest("GET", "/tasks?status=0", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if list.Total != 1 || len(list.Tasks) != 1 || list.Tasks[0].ID != "1" {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+
+	// Test invalid status
+	req, _ = http.NewRequest("GET", "/tasks?status=2", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid status: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestGetTasksHandlerSearch(t *testing.T) {
+	router, store := setupRouter()
+
+	// Pre-populate store with tasks
+	store.tasks["1"] = Task{ID: "1", Name: "Buy milk", Description: "From the corner shop", Status: 0}
+	store.tasks["2"] = Task{ID: "2", Name: "Write report", Description: "Include MILK sales", Status: 1}
+	store.tasks["3"] = Task{ID: "3", Name: "Walk dog", Description: "", Status: 0}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"?q=milk", 2},
+		{"?q=milk&status=0", 1},
+		{"?q=", 3},
+		{"?q=cheese", 0},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/tasks"+tt.query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var list TaskList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		if list.Total != tt.want {
+			t.Errorf("handler returned wrong number of tasks for %q: got %v want %v", tt.query, list.Total, tt.want)
+		}
+	}
+}
+
+func TestGetTasksHandlerOverdueFilter(t *testing.T) {
+	router, store := setupRouter()
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	store.tasks["1"] = Task{ID: "1", Name: "Late", Status: 0, DueDate: &past}
+	store.tasks["2"] = Task{ID: "2", Name: "Late but done", Status: 1, DueDate: &past}
+	store.tasks["3"] = Task{ID: "3", Name: "Not due yet", Status: 0, DueDate: &future}
+	store.tasks["4"] = Task{ID: "4", Name: "No due date", Status: 0}
+
+	req, _ := http.NewRequest("GET", "/tasks?overdue=true", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if list.Total != 1 || list.Tasks[0].ID != "1" {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+
+	// Test invalid overdue value
+	req, _ = http.NewRequest("GET", "/tasks?overdue=maybe", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid overdue: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestGetTasksHandlerTagFilter(t *testing.T) {
+	router, store := setupRouter()
+
+	store.tasks["1"] = Task{ID: "1", Name: "Tagged", Tags: []string{"work", "urgent"}}
+	store.tasks["2"] = Task{ID: "2", Name: "Other", Tags: []string{"home"}}
+
+	req, _ := http.NewRequest("GET", "/tasks?tag=Work", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if list.Total != 1 || list.Tasks[0].ID != "1" {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+}
+
+func TestGetTasksHandlerAssigneeFilter(t *testing.T) {
+	router, store := setupRouter()
+
+	store.tasks["1"] = Task{ID: "1", Name: "Mine", Assignee: "alice"}
+	store.tasks["2"] = Task{ID: "2", Name: "Theirs", Assignee: "bob"}
+	store.tasks["3"] = Task{ID: "3", Name: "Nobody's"}
+
+	req, _ := http.NewRequest("GET", "/tasks?assignee=Alice", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if list.Total != 1 || list.Tasks[0].ID != "1" {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+}
+
+func TestGetTasksHandlerSort(t *testing.T) {
+	router, store := setupRouter()
+
+	// Pre-populate store with tasks in no particular order
+	store.tasks["1"] = Task{ID: "1", Name: "Bravo", Status: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Alpha", Status: 0}
+	store.tasks["3"] = Task{ID: "3", Name: "Charlie", Status: 0}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"2", "1", "3"}},
+		{"?sort=name&order=desc", []string{"3", "1", "2"}},
+		{"?sort=status", []string{"2", "3", "1"}},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/tasks"+tt.query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var list TaskList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		var got []string
+		for _, task := range list.Tasks {
+			got = append(got, task.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("handler returned wrong order for %q: got %v want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Test unknown sort field
+	req, _ := http.NewRequest("GET", "/tasks?sort=color", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for unknown sort: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestGetTaskStatsHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	deleted := time.Now()
+	store.tasks["1"] = Task{ID: "1", Name: "Done", Status: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Open", Status: 0}
+	store.tasks["3"] = Task{ID: "3", Name: "Also open", Status: 0}
+	store.tasks["4"] = Task{ID: "4", Name: "Trashed", Status: 1, DeletedAt: &deleted}
+
+	req, _ := http.NewRequest("GET", "/tasks/stats", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var stats TaskStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if want := (TaskStats{Total: 3, Completed: 1, Incomplete: 2}); stats != want {
+		t.Errorf("handler returned wrong stats: got %+v want %+v", stats, want)
+	}
+}
+
+func TestCreateTaskHandler(t *testing.T) {
+	router, _ := setupRouter()
+	
+	taskPayload := []byte(`{"name": "New Task", "description": "A new test task", "status": 0}`)
+	req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer(taskPayload))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	var createdTask Task
+	json.Unmarshal(rr.Body.Bytes(), &createdTask)
+	if createdTask.Name != "New Task" || createdTask.ID == "" {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+	if createdTask.CreatedAt.IsZero() || !createdTask.UpdatedAt.Equal(createdTask.CreatedAt) {
+		t.Errorf("handler did not set timestamps: got %v", rr.Body.String())
+	}
+	if location := rr.Header().Get("Location"); location != "/tasks/"+createdTask.ID {
+		t.Errorf("handler returned wrong Location header: got %q want %q", location, "/tasks/"+createdTask.ID)
+	}
+	if createdTask.Version != 1 {
+		t.Errorf("handler did not start version at 1: got %v", createdTask.Version)
+	}
+	if createdTask.Priority != 0 {
+		t.Errorf("handler did not default priority to 0: got %v", createdTask.Priority)
+	}
+
+	// Test tag normalization and validation
+	req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Tagged", "tags": [" Work ", "URGENT"]}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var taggedTask Task
+	json.Unmarshal(rr.Body.Bytes(), &taggedTask)
+	if strings.Join(taggedTask.Tags, ",") != "work,urgent" {
+		t.Errorf("handler did not normalize tags: got %v", taggedTask.Tags)
+	}
+	for _, tags := range []string{`["a", ""]`, `["work", "WORK"]`} {
+		req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Tagged", "tags": `+tags+`}`)))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for tags %s: got %v want %v", tags, status, http.StatusBadRequest)
+		}
+	}
+
+	// Test invalid due date
+	req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Deadline", "due_date": "next tuesday"}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid due date: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	// Test invalid priority
+	req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Urgent", "priority": 3}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid priority: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestCreateTaskHandlerSuppliedID(t *testing.T) {
+	router, store := setupRouter()
+
+	id := "9a1e1fa0-6a8e-4d3c-8d4b-0b5a3d1f2c7e"
+	payload := []byte(`{"id": "` + strings.ToUpper(id) + `", "name": "Imported"}`)
+	req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer(payload))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	if _, ok := store.tasks[id]; !ok {
+		t.Errorf("handler did not store the task under its canonical ID: got %v", rr.Body.String())
+	}
+
+	// Importing the same task again conflicts
+	req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer(payload))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code for duplicate ID: got %v want %v", status, http.StatusConflict)
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"id": "task-1", "name": "Imported"}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for malformed ID: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestCreateTaskHandlerIdempotencyKey(t *testing.T) {
+	router, store := setupRouter()
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Retried"}`)))
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := send("retry-1")
+	retry := send("retry-1")
+	if status := retry.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code for retry: got %v want %v", status, http.StatusCreated)
+	}
+	if retry.Body.String() != first.Body.String() || retry.Header().Get("Location") != first.Header().Get("Location") {
+		t.Errorf("retry did not replay the original response: got %v want %v", retry.Body.String(), first.Body.String())
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry was not marked as replayed")
+	}
+	if len(store.tasks) != 1 {
+		t.Errorf("retry created a duplicate task: got %d tasks", len(store.tasks))
+	}
+
+	// A different key creates a new task
+	send("retry-2")
+	if len(store.tasks) != 2 {
+		t.Errorf("new key did not create a task: got %d tasks", len(store.tasks))
+	}
+
+	// Reusing a key with a different body is refused
+	req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Something else"}`)))
+	req.Header.Set("Idempotency-Key", "retry-1")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusUnprocessableEntity {
+		t.Errorf("handler returned wrong status code for reused key: got %v want %v", status, http.StatusUnprocessableEntity)
+	}
+	if len(store.tasks) != 2 {
+		t.Errorf("reused key created a task: got %d tasks", len(store.tasks))
+	}
+
+	// The same key on another endpoint is another request
+	id := first.Header().Get("Location")[len("/tasks/"):]
+	req, _ = http.NewRequest("POST", "/tasks/"+id+"/duplicate", bytes.NewBuffer([]byte(`{"name": "Retried"}`)))
+	req.Header.Set("Idempotency-Key", "retry-1")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("key was shared between endpoints: got status %v, replayed %q", status, rr.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestIdempotencyCacheMaxEntries(t *testing.T) {
+	c := newIdempotencyCache(time.Hour)
+	c.maxEntries = 2
+	var hash [sha256.Size]byte
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, ok := c.reserve(key, hash); !ok {
+			t.Fatalf("reserve(%q) was refused", key)
+		}
+		c.complete(key, http.StatusCreated, http.Header{}, nil)
+	}
+	if len(c.entries) != 2 {
+		t.Errorf("cache grew past its limit: got %d entries", len(c.entries))
+	}
+	if _, ok := c.entries["a"]; ok {
+		t.Errorf("cache kept the oldest entry")
+	}
+}
+
+func TestCreateTaskHandlerMaxTasks(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	store.tasks["1"] = Task{ID: "1", Name: "Existing"}
+	h := &Handlers{store: store, ids: uuidGenerator{}, maxTasks: 2}
+
+	req, _ := http.NewRequest("POST", "/tasks/bulk", bytes.NewBuffer([]byte(`[{"name": "One"}, {"name": "Two"}]`)))
+	rr := httptest.NewRecorder()
+	h.createTasksBulkHandler(rr, req)
+	if status := rr.Code; status != http.StatusInsufficientStorage {
+		t.Errorf("handler returned wrong status code for bulk over the limit: got %v want %v", status, http.StatusInsufficientStorage)
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "One"}`)))
+	rr = httptest.NewRecorder()
+	h.createTaskHandler(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code below the limit: got %v want %v", status, http.StatusCreated)
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Two"}`)))
+	rr = httptest.NewRecorder()
+	h.createTaskHandler(rr, req)
+	if status := rr.Code; status != http.StatusInsufficientStorage {
+		t.Errorf("handler returned wrong status code at the limit: got %v want %v", status, http.StatusInsufficientStorage)
+	}
+}
+
+func TestCreateTaskHandlerMaxTasksConcurrent(t *testing.T) {
+	router, store := setupRouter()
+	store.SetMaxTasks(5)
+
+	var wg sync.WaitGroup
+	var created, refused atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Racing"}`)))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			switch rr.Code {
+			case http.StatusCreated:
+				created.Add(1)
+			case http.StatusInsufficientStorage:
+				refused.Add(1)
+			default:
+				t.Errorf("handler returned unexpected status code: %v: %s", rr.Code, rr.Body)
+			}
+		}()
+	}
+	wg.Wait()
+	if created.Load() != 5 || refused.Load() != 15 || len(store.tasks) != 5 {
+		t.Errorf("concurrent creates went past the limit: %d created, %d refused, %d stored", created.Load(), refused.Load(), len(store.tasks))
+	}
+}
+
+func TestCreateTaskHandlerDefaults(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, ids: uuidGenerator{}, defaultStatus: StatusCompleted, defaultPriority: 1}
+
+	tests := []struct {
+		body     string
+		status   Status
+		priority int
+	}{
+		{`{"name": "Defaults"}`, StatusCompleted, 1},
+		{`{"name": "Explicit", "status": 0, "priority": 0}`, StatusIncomplete, 0},
+		{`{"name": "Priority only", "priority": 2}`, StatusCompleted, 2},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		h.createTaskHandler(rr, req)
+		var task Task
+		if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		if task.Status != tt.status || task.Priority != tt.priority {
+			t.Errorf("handler created %s with status %v and priority %v, want %v and %v", tt.body, task.Status, task.Priority, tt.status, tt.priority)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/tasks/bulk", strings.NewReader(`[{"name": "Bulk"}]`))
+	rr := httptest.NewRecorder()
+	h.createTasksBulkHandler(rr, req)
+	var created []Task
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || len(created) != 1 {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if created[0].Status != StatusCompleted || created[0].Priority != 1 {
+		t.Errorf("bulk handler did not apply defaults: got %+v", created[0])
+	}
+}
+
+func TestCreateTaskHandlerTextFields(t *testing.T) {
+	router, _ := setupRouter()
+
+	// Surrounding whitespace is trimmed before storing
+	req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "  Padded  ", "description": " Notes\n"}`)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var task Task
+	json.Unmarshal(rr.Body.Bytes(), &task)
+	if task.Name != "Padded" || task.Description != "Notes" {
+		t.Errorf("handler did not trim text fields: got %q, %q", task.Name, task.Description)
+	}
+
+	tests := map[string]string{
+		"blank name":       `{"name": "   "}`,
+		"long name":        `{"name": "` + strings.Repeat("a", maxNameLength+1) + `"}`,
+		"long description": `{"name": "Task", "description": "` + strings.Repeat("a", maxDescriptionLength+1) + `"}`,
+	}
+	for name, payload := range tests {
+		req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(payload)))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", name, status, http.StatusBadRequest)
+		}
+	}
+
+	// A name of exactly the maximum length is accepted
+	req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "`+strings.Repeat("é", maxNameLength)+`"}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code for maximum-length name: got %v want %v", status, http.StatusCreated)
+	}
+}
+
+func TestCreateTaskHandlerTagLimits(t *testing.T) {
+	router, _ := setupRouter()
+
+	tooMany := make([]string, maxTags+1)
+	for i := range tooMany {
+		tooMany[i] = "tag" + strconv.Itoa(i)
+	}
+	manyJSON, _ := json.Marshal(tooMany)
+	long := strings.Repeat("x", maxTagLength+1)
+
+	tests := []struct {
+		tags string
+		want string
+	}{
+		{string(manyJSON), "At most " + strconv.Itoa(maxTags) + " tags are allowed"},
+		{`["work", "` + long + `"]`, `Tag "` + long + `" must be at most 50 characters`},
+		{`["work", "to do"]`, `Tag "to do" may only contain`},
+		{`["work!"]`, `Tag "work!" may only contain`},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "Tagged", "tags": `+tt.tags+`}`))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if rr.Code != http.StatusBadRequest || !strings.HasPrefix(body.Error, tt.want) {
+			t.Errorf("handler returned %v %q for tags %s, want 400 starting %q", rr.Code, body.Error, tt.tags, tt.want)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "Tagged", "tags": ["q3:release", "team/api", "v1.2", "café", "`+strings.Repeat("x", maxTagLength)+`"]}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("handler rejected valid tags: %v %s", rr.Code, rr.Body)
+	}
+}
+
+func TestCreateTasksBulkHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	bulkPayload := []byte(`[{"name": "First", "status": 0}, {"name": "Second", "status": 1}]`)
+	req, _ := http.NewRequest("POST", "/tasks/bulk", bytes.NewBuffer(bulkPayload))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+
+	var created []Task
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	if len(created) != 2 || created[0].ID == "" || created[0].ID == created[1].ID {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	}
+	if len(store.tasks) != 2 {
+		t.Errorf("store has %d tasks, want 2", len(store.tasks))
+	}
+
+	// Test that one invalid task rejects the whole batch
+	invalidPayload := []byte(`[{"name": "Valid", "status": 0}, {"name": "", "status": 0}]`)
+	req, _ = http.NewRequest("POST", "/tasks/bulk", bytes.NewBuffer(invalidPayload))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid batch: got %v want %v", status, http.StatusBadRequest)
+	}
+	if !strings.Contains(rr.Body.String(), "index 1") {
+		t.Errorf("error does not name the bad index: got %v", rr.Body.String())
+	}
+	if len(store.tasks) != 2 {
+		t.Errorf("invalid batch modified the store: got %d tasks, want 2", len(store.tasks))
+	}
+}
+
+func TestCompleteAllTasksHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	deleted := time.Now()
+	store.tasks["1"] = Task{ID: "1", Name: "Open"}
+	store.tasks["2"] = Task{ID: "2", Name: "Also open"}
+	store.tasks["3"] = Task{ID: "3", Name: "Done", Status: 1}
+	store.tasks["4"] = Task{ID: "4", Name: "Trashed", DeletedAt: &deleted}
+
+	// Complete only the listed tasks
+	req, _ := http.NewRequest("POST", "/tasks/complete-all", bytes.NewBuffer([]byte(`{"ids": ["1", "3"]}`)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"updated":1}` {
+		t.Errorf("handler returned unexpected body: got %v", body)
+	}
+	if store.tasks["1"].Status != 1 || store.tasks["2"].Status != 0 {
+		t.Errorf("handler completed the wrong tasks: got %+v", store.tasks)
+	}
+
+	// Without a body, every remaining incomplete task is completed
+	req, _ = http.NewRequest("POST", "/tasks/complete-all", http.NoBody)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"updated":1}` {
+		t.Errorf("handler returned unexpected body: got %v", body)
+	}
+	if store.tasks["2"].Status != 1 || store.tasks["4"].Status != 0 {
+		t.Errorf("handler completed the wrong tasks: got %+v", store.tasks)
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks/complete-all", bytes.NewBuffer([]byte(`{"ids": ["missing"]}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for unknown ID: got %v want %v", status, http.StatusNotFound)
+	}
 }
 
-func TestGetTasksHandler(t *testing.T) {
-	router, h := setupRouter()
+func TestPatchTasksHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	store.tasks["1"] = Task{ID: "1", Name: "Overdue", DueDate: &past, Version: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Not due yet", DueDate: &future, Version: 1}
+	store.tasks["3"] = Task{ID: "3", Name: "Overdue but done", Status: 1, DueDate: &past, Version: 1}
+	store.tasks["4"] = Task{ID: "4", Name: "Overdue but archived", DueDate: &past, Archived: true, Version: 1}
+
+	body := `{"filter": {"overdue": true}, "set": {"priority": 2, "tags": ["Late"]}}`
+	req, _ := http.NewRequest("PATCH", "/tasks", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"updated":1}` {
+		t.Errorf("handler returned unexpected body: got %v", body)
+	}
+	if task := store.tasks["1"]; task.Priority != 2 || len(task.Tags) != 1 || task.Tags[0] != "late" || task.Version != 2 {
+		t.Errorf("handler did not update the matching task: got %+v", task)
+	}
+	for _, id := range []string{"2", "3", "4"} {
+		if task := store.tasks[id]; task.Priority != 0 || task.Version != 1 {
+			t.Errorf("handler updated task %s, which does not match: got %+v", id, task)
+		}
+	}
+
+	for _, body := range []string{
+		`{"filter": {"status": 2}, "set": {"priority": 1}}`,
+		`{"filter": {}, "set": {"priority": 5}}`,
+		`{"filter": {}, "set": {"name": " "}}`,
+		`{"filter": {}, "set": {}}`,
+		`{"filter": {}}`,
+		`{"filter": {}, "set": {"parent_id": "1"}}`,
+	} {
+		req, _ := http.NewRequest("PATCH", "/tasks", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", body, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestUpdateTaskHandler(t *testing.T) {
+	router, store := setupRouter()
 
 	// Pre-populate store with a task
-	task := Task{ID: "1", Name: "Test Task", Description: "A test task", Status: 0}
-	h.store.tasks["1"] = task
+	taskID := "1"
+	createdAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store.tasks[taskID] = Task{ID: taskID, Name: "Old Name", Description: "Old Desc", Status: 0, CreatedAt: createdAt, UpdatedAt: createdAt, Version: 2}
 
-	req, _ := http.NewRequest("GET", "/tasks", nil)
+	// The client must not be able to overwrite created_at
+	updatePayload := []byte(`{"name": "Updated Name", "description": "Updated Desc", "status": 1, "created_at": "2030-01-01T00:00:00Z", "version": 2}`)
+	req, _ := http.NewRequest("PUT", "/tasks/"+taskID, bytes.NewBuffer(updatePayload))
+	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 
@@ -37,44 +1039,89 @@ func TestGetTasksHandler(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	var tasks []Task
-	if err := json.Unmarshal(rr.Body.Bytes(), &tasks); err != nil {
-		t.Fatalf("Could not parse response body: %v", err)
+	if store.tasks[taskID].Name != "Updated Name" || store.tasks[taskID].Status != 1 {
+		t.Errorf("task was not updated correctly in the store")
 	}
-	if len(tasks) != 1 || tasks[0].Name != "Test Task" {
-		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	if !store.tasks[taskID].CreatedAt.Equal(createdAt) || !store.tasks[taskID].UpdatedAt.After(createdAt) {
+		t.Errorf("task timestamps were not maintained correctly: got %+v", store.tasks[taskID])
+	}
+	var updated Task
+	json.Unmarshal(rr.Body.Bytes(), &updated)
+	if updated.Version != 3 {
+		t.Errorf("handler did not increment version: got %v want 3", updated.Version)
+	}
+
+	// Replaying the same update now carries a stale version
+	req, _ = http.NewRequest("PUT", "/tasks/"+taskID, bytes.NewBuffer(updatePayload))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code for stale version: got %v want %v", status, http.StatusConflict)
+	}
+
+	// A task in the trash cannot be replaced or recreated
+	deleted := time.Now()
+	store.tasks["2"] = Task{ID: "2", Name: "Trashed", DeletedAt: &deleted}
+	req, _ = http.NewRequest("PUT", "/tasks/2", bytes.NewBuffer([]byte(`{"name": "Replaced"}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for trashed task: got %v want %v", status, http.StatusNotFound)
 	}
 }
 
-func TestCreateTaskHandler(t *testing.T) {
-	router, _ := setupRouter()
-	
-	taskPayload := []byte(`{"name": "New Task", "description": "A new test task", "status": 0}`)
-	req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer(taskPayload))
-	req.Header.Set("Content-Type", "application/json")
+func TestUpdateTaskHandlerUpsert(t *testing.T) {
+	router, store := setupRouter()
+
+	// PUT to an unused ID creates the task
+	id := "9a1e1fa0-6a8e-4d3c-8d4b-0b5a3d1f2c7e"
+	req, _ := http.NewRequest("PUT", "/tasks/"+id, bytes.NewBuffer([]byte(`{"name": "Synced", "status": 0}`)))
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
-
 	if status := rr.Code; status != http.StatusCreated {
-		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+		t.Errorf("handler returned wrong status code for new ID: got %v want %v", status, http.StatusCreated)
+	}
+	if location := rr.Header().Get("Location"); location != "/tasks/"+id {
+		t.Errorf("handler returned wrong Location header: got %q want %q", location, "/tasks/"+id)
+	}
+	if task, ok := store.tasks[id]; !ok || task.Name != "Synced" || task.Version != 1 {
+		t.Errorf("handler did not create the task: got %+v", store.tasks)
 	}
 
-	var createdTask Task
-	json.Unmarshal(rr.Body.Bytes(), &createdTask)
-	if createdTask.Name != "New Task" || createdTask.ID == "" {
-		t.Errorf("handler returned unexpected body: got %v", rr.Body.String())
+	// PUT again replaces it
+	req, _ = http.NewRequest("PUT", "/tasks/"+id, bytes.NewBuffer([]byte(`{"name": "Synced again", "version": 1}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code for existing ID: got %v want %v", status, http.StatusOK)
+	}
+	if task := store.tasks[id]; task.Name != "Synced again" || len(store.tasks) != 1 {
+		t.Errorf("handler did not replace the task: got %+v", store.tasks)
+	}
+
+	// New IDs must be UUIDs, and validation still applies
+	for path, payload := range map[string]string{
+		"/tasks/not-a-uuid":                           `{"name": "Synced"}`,
+		"/tasks/0b5a3d1f-2c7e-4d3c-8d4b-9a1e1fa06a8e": `{"name": ""}`,
+	} {
+		req, _ = http.NewRequest("PUT", path, bytes.NewBuffer([]byte(payload)))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("PUT %s returned wrong status code: got %v want %v", path, status, http.StatusBadRequest)
+		}
 	}
 }
 
-func TestUpdateTaskHandler(t *testing.T) {
-	router, h := setupRouter()
+func TestPatchTaskHandler(t *testing.T) {
+	router, store := setupRouter()
 
 	// Pre-populate store with a task
 	taskID := "1"
-	h.store.tasks[taskID] = Task{ID: taskID, Name: "Old Name", Description: "Old Desc", Status: 0}
+	store.tasks[taskID] = Task{ID: taskID, Name: "Old Name", Description: "Old Desc", Status: 0}
 
-	updatePayload := []byte(`{"name": "Updated Name", "description": "Updated Desc", "status": 1}`)
-	req, _ := http.NewRequest("PUT", "/tasks/"+taskID, bytes.NewBuffer(updatePayload))
+	patchPayload := []byte(`{"status": 1}`)
+	req, _ := http.NewRequest("PATCH", "/tasks/"+taskID, bytes.NewBuffer(patchPayload))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
@@ -83,12 +1130,53 @@ func TestUpdateTaskHandler(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
 
-	if h.store.tasks[taskID].Name != "Updated Name" || h.store.tasks[taskID].Status != 1 {
-		t.Errorf("task was not updated correctly in the store")
+	task := store.tasks[taskID]
+	if task.Status != 1 || task.Name != "Old Name" || task.Description != "Old Desc" {
+		t.Errorf("task was not patched correctly in the store: got %+v", task)
+	}
+
+	// Test invalid status
+	req, _ = http.NewRequest("PATCH", "/tasks/"+taskID, bytes.NewBuffer([]byte(`{"status": 2}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid status: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	// Test assigning and unassigning
+	req, _ = http.NewRequest("PATCH", "/tasks/"+taskID, bytes.NewBuffer([]byte(`{"assignee": " alice "}`)))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if task := store.tasks[taskID]; task.Assignee != "alice" {
+		t.Errorf("handler did not assign task: got %q", task.Assignee)
+	}
+	req, _ = http.NewRequest("PATCH", "/tasks/"+taskID, bytes.NewBuffer([]byte(`{"assignee": "  "}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for blank assignee: got %v want %v", status, http.StatusBadRequest)
+	}
+	req, _ = http.NewRequest("PATCH", "/tasks/"+taskID, bytes.NewBuffer([]byte(`{"assignee": ""}`)))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if task := store.tasks[taskID]; task.Assignee != "" {
+		t.Errorf("handler did not unassign task: got %q", task.Assignee)
+	}
+
+	// Test blank name and trimming
+	req, _ = http.NewRequest("PATCH", "/tasks/"+taskID, bytes.NewBuffer([]byte(`{"name": "  "}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for blank name: got %v want %v", status, http.StatusBadRequest)
+	}
+	req, _ = http.NewRequest("PATCH", "/tasks/"+taskID, bytes.NewBuffer([]byte(`{"name": " New Name "}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if task := store.tasks[taskID]; task.Name != "New Name" {
+		t.Errorf("handler did not trim patched name: got %q", task.Name)
 	}
 
-	// Test update non-existent task
-	req, _ = http.NewRequest("PUT", "/tasks/nonexistent", bytes.NewBuffer(updatePayload))
+	// Test patch non-existent task
+	req, _ = http.NewRequest("PATCH", "/tasks/nonexistent", bytes.NewBuffer(patchPayload))
 	rr = httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 	if status := rr.Code; status != http.StatusNotFound {
@@ -97,11 +1185,11 @@ func TestUpdateTaskHandler(t *testing.T) {
 }
 
 func TestDeleteTaskHandler(t *testing.T) {
-	router, h := setupRouter()
+	router, store := setupRouter()
 	
 	// Pre-populate store with a task
 	taskID := "1"
-	h.store.tasks[taskID] = Task{ID: taskID, Name: "To Be Deleted", Description: "", Status: 0}
+	store.tasks[taskID] = Task{ID: taskID, Name: "To Be Deleted", Description: "", Status: 0}
 	
 	req, _ := http.NewRequest("DELETE", "/tasks/"+taskID, nil)
 	rr := httptest.NewRecorder()
@@ -111,8 +1199,16 @@ func TestDeleteTaskHandler(t *testing.T) {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
 	}
 
-	if _, ok := h.store.tasks[taskID]; ok {
-		t.Errorf("task was not deleted from the store")
+	if task, ok := store.tasks[taskID]; !ok || task.DeletedAt == nil {
+		t.Errorf("task was not moved to the trash: got %+v", task)
+	}
+
+	// Trashed tasks are hidden from reads
+	req, _ = http.NewRequest("GET", "/tasks/"+taskID, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for trashed task: got %v want %v", status, http.StatusNotFound)
 	}
 
 	// Test delete non-existent task
@@ -123,3 +1219,399 @@ func TestDeleteTaskHandler(t *testing.T) {
 		t.Errorf("handler returned wrong status code for non-existent task: got %v want %v", status, http.StatusNotFound)
 	}
 }
+
+func TestDeleteTaskHandlerIdempotent(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "To Be Deleted", Version: 1}
+
+	var deletedAt time.Time
+	for attempt := 1; attempt <= 2; attempt++ {
+		req, _ := http.NewRequest("DELETE", "/tasks/1?idempotent=true", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code on attempt %d: got %v want %v", attempt, status, http.StatusOK)
+		}
+		var task Task
+		json.Unmarshal(rr.Body.Bytes(), &task)
+		if task.ID != "1" || task.DeletedAt == nil || task.Version != 2 {
+			t.Errorf("handler returned wrong task on attempt %d: %+v", attempt, task)
+		}
+		if attempt == 1 {
+			deletedAt = *task.DeletedAt
+		} else if !task.DeletedAt.Equal(deletedAt) {
+			t.Errorf("repeated delete changed deleted_at: got %v want %v", task.DeletedAt, deletedAt)
+		}
+	}
+
+	req, _ := http.NewRequest("DELETE", "/tasks/missing?idempotent=true", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for non-existent task: got %v want %v", status, http.StatusNotFound)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/tasks/1?idempotent=maybe", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for invalid idempotent: got %v want %v", status, http.StatusBadRequest)
+	}
+}
+
+func TestRestoreTaskHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	deletedAt := time.Now().UTC()
+	store.tasks["1"] = Task{ID: "1", Name: "Trashed", DeletedAt: &deletedAt}
+	store.tasks["2"] = Task{ID: "2", Name: "Kept"}
+
+	// Trashed tasks are listed only on request
+	for query, want := range map[string]int{"": 1, "?include_deleted=true": 2} {
+		req, _ := http.NewRequest("GET", "/tasks"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var list TaskList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		if list.Total != want {
+			t.Errorf("handler returned wrong number of tasks for %q: got %v want %v", query, list.Total, want)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/tasks/1/restore", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if store.tasks["1"].DeletedAt != nil {
+		t.Errorf("task was not restored in the store")
+	}
+
+	// Test restore non-existent task
+	req, _ = http.NewRequest("POST", "/tasks/nonexistent/restore", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for non-existent task: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestArchiveTaskHandlers(t *testing.T) {
+	router, store := setupRouter()
+
+	store.tasks["1"] = Task{ID: "1", Name: "Done", Status: 1, Version: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Open", Version: 1}
+
+	req, _ := http.NewRequest("POST", "/tasks/1/archive", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if task := store.tasks["1"]; !task.Archived || task.Status != 1 || task.Version != 2 {
+		t.Errorf("task was not archived as is: got %+v", task)
+	}
+
+	// Archived tasks are listed only on request
+	for query, want := range map[string]int{"": 1, "?include_archived=true": 2} {
+		req, _ := http.NewRequest("GET", "/tasks"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var list TaskList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		if list.Total != want {
+			t.Errorf("handler returned wrong number of tasks for %q: got %v want %v", query, list.Total, want)
+		}
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks/1/unarchive", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if store.tasks["1"].Archived {
+		t.Errorf("task was not unarchived in the store")
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks/nonexistent/archive", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for non-existent task: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestCompleteAndReopenTaskHandlers(t *testing.T) {
+	router, store := setupRouter()
+
+	deletedAt := time.Now().UTC()
+	store.tasks["1"] = Task{ID: "1", Name: "Open", Version: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Blocked", DependsOn: []string{"1"}, Version: 1}
+	store.tasks["3"] = Task{ID: "3", Name: "Trashed", DeletedAt: &deletedAt}
+
+	tests := []struct {
+		path    string
+		want    int
+		id      string
+		status  Status
+		version int
+	}{
+		{"/tasks/2/complete", http.StatusConflict, "2", StatusIncomplete, 1},
+		{"/tasks/1/complete", http.StatusOK, "1", StatusCompleted, 2},
+		{"/tasks/1/complete", http.StatusOK, "1", StatusCompleted, 2},
+		{"/tasks/2/complete", http.StatusOK, "2", StatusCompleted, 2},
+		{"/tasks/1/reopen", http.StatusOK, "1", StatusIncomplete, 3},
+		{"/tasks/3/reopen", http.StatusNotFound, "3", StatusIncomplete, 0},
+		{"/tasks/nonexistent/complete", http.StatusNotFound, "", 0, 0},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", tt.path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != tt.want {
+			t.Errorf("POST %s returned wrong status code: got %v want %v: %s", tt.path, status, tt.want, rr.Body)
+		}
+		if task := store.tasks[tt.id]; tt.id != "" && (task.Status != tt.status || task.Version != tt.version) {
+			t.Errorf("POST %s left task %+v, want status %v at version %d", tt.path, task, tt.status, tt.version)
+		}
+	}
+}
+
+func TestPurgeTaskHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	deletedAt := time.Now().UTC()
+	store.tasks["1"] = Task{ID: "1", Name: "Trashed", DeletedAt: &deletedAt}
+
+	req, _ := http.NewRequest("DELETE", "/tasks/1/purge", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+	if _, ok := store.tasks["1"]; ok {
+		t.Errorf("task was not removed from the store")
+	}
+
+	// Test purge non-existent task
+	req, _ = http.NewRequest("DELETE", "/tasks/1/purge", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for non-existent task: got %v want %v", status, http.StatusNotFound)
+	}
+}
+
+func TestSubtasks(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["parent"] = Task{ID: "parent", Name: "Parent"}
+
+	// Create a subtask of an existing parent
+	req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Child", "parent_id": "parent"}`)))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusCreated)
+	}
+	var child Task
+	json.Unmarshal(rr.Body.Bytes(), &child)
+
+	// A missing parent is rejected
+	req, _ = http.NewRequest("POST", "/tasks", bytes.NewBuffer([]byte(`{"name": "Orphan", "parent_id": "missing"}`)))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned wrong status code for missing parent: got %v want %v", status, http.StatusNotFound)
+	}
+
+	// A task cannot become its own parent or its child's child
+	for _, parentID := range []string{"parent", child.ID} {
+		req, _ = http.NewRequest("PATCH", "/tasks/parent", bytes.NewBuffer([]byte(`{"parent_id": "`+parentID+`"}`)))
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for parent %s: got %v want %v", parentID, status, http.StatusBadRequest)
+		}
+	}
+
+	// List the subtasks
+	req, _ = http.NewRequest("GET", "/tasks/parent/subtasks", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if list.Total != 1 || list.Tasks[0].ID != child.ID {
+		t.Errorf("handler returned unexpected subtasks: got %v", rr.Body.String())
+	}
+
+	// Deleting the parent is blocked until the subtask is detached
+	req, _ = http.NewRequest("DELETE", "/tasks/parent", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code for parent with subtasks: got %v want %v", status, http.StatusConflict)
+	}
+	req, _ = http.NewRequest("PATCH", "/tasks/"+child.ID, bytes.NewBuffer([]byte(`{"parent_id": ""}`)))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if store.tasks[child.ID].ParentID != nil {
+		t.Errorf("handler did not detach subtask: got %+v", store.tasks[child.ID])
+	}
+	req, _ = http.NewRequest("DELETE", "/tasks/parent", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code after detaching: got %v want %v", status, http.StatusNoContent)
+	}
+}
+
+func TestDeleteAllTasksHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	// Pre-populate store with tasks
+	store.tasks["1"] = Task{ID: "1", Name: "First"}
+	store.tasks["2"] = Task{ID: "2", Name: "Second"}
+
+	// Test that the confirmation guard is enforced
+	req, _ := http.NewRequest("DELETE", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code without confirm: got %v want %v", status, http.StatusBadRequest)
+	}
+	if len(store.tasks) != 2 {
+		t.Errorf("tasks were deleted without confirmation")
+	}
+
+	req, _ = http.NewRequest("DELETE", "/tasks?confirm=true", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusNoContent)
+	}
+	if len(store.tasks) != 0 {
+		t.Errorf("tasks were not deleted from the store")
+	}
+}
+
+
+func TestMalformedBodyReturnsJSONError(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Existing"}
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{"POST", "/tasks"},
+		{"POST", "/tasks/bulk"},
+		{"PUT", "/tasks/1"},
+		{"PATCH", "/tasks/1"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(`{"name": `))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", tt.method, tt.path, status, http.StatusBadRequest)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s returned wrong Content-Type: got %q", tt.method, tt.path, ct)
+		}
+		var body map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body["error"] == "" {
+			t.Errorf("%s %s did not return a JSON error: got %v", tt.method, tt.path, rr.Body.String())
+		}
+	}
+}
+
+func TestCreateTaskHandlerDedupe(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Buy Milk"}
+	deletedAt := time.Now()
+	store.tasks["2"] = Task{ID: "2", Name: "Walk dog", DeletedAt: &deletedAt}
+
+	tests := []struct {
+		query string
+		body  string
+		want  int
+	}{
+		{"?dedupe=true", `{"name": "  buy milk "}`, http.StatusOK},
+		{"", `{"name": "Buy Milk"}`, http.StatusCreated},
+		{"?dedupe=true", `{"name": "Walk dog"}`, http.StatusCreated},
+		{"?dedupe=maybe", `{"name": "Buy Milk"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/tasks"+tt.query, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.want {
+			t.Errorf("handler returned wrong status code for %s %s: got %v want %v", tt.query, tt.body, status, tt.want)
+		}
+		if tt.want == http.StatusOK {
+			var task Task
+			json.Unmarshal(rr.Body.Bytes(), &task)
+			if task.ID != "1" || rr.Header().Get("Location") != "/tasks/1" {
+				t.Errorf("handler did not return the existing task: got %+v", task)
+			}
+		}
+	}
+	if len(store.tasks) != 4 {
+		t.Errorf("store holds %d tasks, want 4", len(store.tasks))
+	}
+}
+
+func TestOversizedBodyRejected(t *testing.T) {
+	router, store := setupRouter()
+	handler := bodyLimitMiddleware(64)(router)
+
+	body := `{"name": "` + strings.Repeat("x", 100) + `"}`
+	req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusRequestEntityTooLarge)
+	}
+	if !strings.Contains(rr.Body.String(), `"error"`) {
+		t.Errorf("handler did not return a JSON error: got %v", rr.Body.String())
+	}
+	if len(store.tasks) != 0 {
+		t.Errorf("oversized request stored a task")
+	}
+}
+
+func TestUnknownFieldsRejected(t *testing.T) {
+	router, store := setupRouter()
+
+	taskPayload := []byte(`{"name": "Typo", "statuss": 1}`)
+	req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer(taskPayload))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+	if !strings.Contains(rr.Body.String(), "statuss") {
+		t.Errorf("error does not name the unknown field: got %v", rr.Body.String())
+	}
+	if len(store.tasks) != 0 {
+		t.Errorf("task was created despite the unknown field")
+	}
+}
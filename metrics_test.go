@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	router, store := setupRouter()
+	router.Use(metricsMiddleware)
+	store.tasks["1"] = Task{ID: "1", Name: "Counted"}
+
+	counter := httpRequestsTotal.WithLabelValues("GET", "/tasks/{id}", "200")
+	before := testutil.ToFloat64(counter)
+
+	req, _ := http.NewRequest("GET", "/tasks/1", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := testutil.ToFloat64(counter) - before; got != 1 {
+		t.Errorf("request counter increased by %v, want 1", got)
+	}
+}
+
+func TestMetricsMiddlewareUnmatched(t *testing.T) {
+	handler := metricsMiddleware(http.NotFoundHandler())
+	counter := httpRequestsTotal.WithLabelValues("GET", unmatchedRoute, "404")
+	before := testutil.ToFloat64(counter)
+
+	for _, path := range []string{"/wp-admin", "/.env", "/no/such/route"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	if got := testutil.ToFloat64(counter) - before; got != 3 {
+		t.Errorf("unmatched request counter increased by %v, want 3", got)
+	}
+}
+
+func TestTaskCountGauge(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	gauge := newTaskCountGauge(func() []Store { return []Store{store} })
+
+	deleted := time.Now()
+	store.tasks["1"] = Task{ID: "1", Name: "Live"}
+	store.tasks["2"] = Task{ID: "2", Name: "Trashed", DeletedAt: &deleted}
+
+	if got := testutil.ToFloat64(gauge); got != 1 {
+		t.Errorf("gauge reported %v tasks, want 1", got)
+	}
+}
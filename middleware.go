@@ -0,0 +1,679 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
+)
+
+// responseWriter wraps an http.ResponseWriter to record the status code
+// written by the handler.
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// loggingMiddleware logs the method, path, status code and duration of every
+// request to logger.
+func loggingMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+			logger.InfoContext(r.Context(), "Request",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", rw.status,
+				"duration", time.Since(start),
+			)
+		})
+	}
+}
+
+// allowHead lets a GET handler answer HEAD requests too. The handler runs as
+// usual, but only its status and headers are sent, with Content-Length set to
+// the size the body would have had.
+func allowHead(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			next(w, r)
+			return
+		}
+		hw := &headResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next(hw, r)
+		if hw.status != http.StatusNotModified && hw.status != http.StatusNoContent {
+			w.Header().Set("Content-Length", strconv.Itoa(hw.size))
+		}
+		w.WriteHeader(hw.status)
+	}
+}
+
+// headResponseWriter discards the body of a response to a HEAD request,
+// counting its bytes, and holds back the status until the size is known.
+type headResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (hw *headResponseWriter) WriteHeader(code int) {
+	hw.status = code
+}
+
+func (hw *headResponseWriter) Write(p []byte) (int, error) {
+	hw.size += len(p)
+	return len(p), nil
+}
+
+// maxRequestIDLength bounds the X-Request-ID values accepted from clients.
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key under which requestIDMiddleware stores the
+// request's ID.
+type requestIDKey struct{}
+
+// requestIDMiddleware gives every request an ID, taken from its X-Request-ID
+// header or generated if that is missing or unusable. The ID is echoed back in
+// the response header and stored in the request context, where
+// requestIDLogHandler adds it to every log line for the request.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to
+// echo and log: non-empty, not too long and printable ASCII only.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDFromContext returns the ID requestIDMiddleware stored in ctx, or
+// "" if there is none.
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDLogHandler adds a request_id attribute to records logged with the
+// context of a request that has one.
+type requestIDLogHandler struct {
+	slog.Handler
+}
+
+func (h requestIDLogHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDLogHandler) WithGroup(name string) slog.Handler {
+	return requestIDLogHandler{h.Handler.WithGroup(name)}
+}
+
+// gzipMinSize is the smallest response body worth compressing. Smaller ones
+// would barely shrink, or even grow, once gzip's framing is added.
+const gzipMinSize = 1024
+
+// gzipMiddleware compresses responses for clients that accept gzip. Bodies
+// under gzipMinSize, event streams and anything the handler flushes before
+// the body is decided on are sent as is.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+	for _, coding := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(coding, ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of a response until it knows whether
+// the body is large enough to compress, then either compresses everything
+// written or passes it through.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (gw *gzipResponseWriter) WriteHeader(code int) {
+	if !gw.decided {
+		gw.status = code
+	}
+}
+
+func (gw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if gw.decided {
+		if gw.gz != nil {
+			return gw.gz.Write(p)
+		}
+		return gw.ResponseWriter.Write(p)
+	}
+	gw.buf = append(gw.buf, p...)
+	if len(gw.buf) >= gw.minSize() {
+		if err := gw.decide(gw.compressible()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends what has been written so far. A response flushed before it
+// reaches gzipMinSize is a stream, so it is left uncompressed.
+func (gw *gzipResponseWriter) Flush() {
+	if !gw.decided {
+		gw.decide(false)
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (gw *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// minSize returns gzipMinSize, or 0 for event streams so they are decided on
+// (and passed through) at their first write.
+func (gw *gzipResponseWriter) minSize() int {
+	if !gw.compressible() {
+		return 0
+	}
+	return gzipMinSize
+}
+
+// compressible reports whether the response's headers allow compressing it.
+func (gw *gzipResponseWriter) compressible() bool {
+	h := gw.Header()
+	return h.Get("Content-Encoding") == "" &&
+		!strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+}
+
+// decide writes the status line and the buffered body, compressed or not.
+func (gw *gzipResponseWriter) decide(compress bool) error {
+	gw.decided = true
+	if compress {
+		gw.Header().Set("Content-Encoding", "gzip")
+		gw.Header().Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+	gw.ResponseWriter.WriteHeader(gw.status)
+	if len(gw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if gw.gz != nil {
+		_, err = gw.gz.Write(gw.buf)
+	} else {
+		_, err = gw.ResponseWriter.Write(gw.buf)
+	}
+	gw.buf = nil
+	return err
+}
+
+// close sends any response still buffered, uncompressed as it is small, and
+// finishes the gzip stream.
+func (gw *gzipResponseWriter) close() {
+	if !gw.decided {
+		gw.decide(false)
+	}
+	if gw.gz != nil {
+		gw.gz.Close()
+	}
+}
+
+// defaultContentSecurityPolicy forbids loading anything and being framed,
+// which suits responses that are only ever data.
+const defaultContentSecurityPolicy = "default-src 'none'; frame-ancestors 'none'"
+
+// securityHeadersMiddleware sets headers that stop browsers from sniffing
+// responses as another content type, rendering them in frames, or loading
+// anything beyond what contentSecurityPolicy allows.
+func securityHeadersMiddleware(contentSecurityPolicy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("X-Frame-Options", "DENY")
+			w.Header().Set("Content-Security-Policy", contentSecurityPolicy)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// corsAllowedHeaders are the request headers browser clients may send.
+var corsAllowedHeaders = []string{"Content-Type", "Authorization", "Idempotency-Key", "If-Match", "If-None-Match", "X-Request-ID", tenantHeader}
+
+// corsMiddleware sets the CORS headers browsers need to call the API from
+// allowedOrigin, and answers OPTIONS preflight requests directly, letting
+// browsers cache the answer for maxAge.
+func corsMiddleware(allowedOrigin string, maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", preflightAllowedHeaders(r.Header.Get("Access-Control-Request-Headers")))
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Link, Location, X-Request-ID, X-Total-Count")
+			if r.Method == http.MethodOptions {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// preflightAllowedHeaders answers the Access-Control-Request-Headers of a
+// preflight by echoing the requested headers that are allowed, or lists
+// every allowed header when none were requested.
+func preflightAllowedHeaders(requested string) string {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(corsAllowedHeaders, ", ")
+	}
+	var allowed []string
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if slices.ContainsFunc(corsAllowedHeaders, func(h string) bool { return strings.EqualFold(h, header) }) {
+			allowed = append(allowed, header)
+		}
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// preflightHandler gives OPTIONS requests a route to match. The response is
+// normally written by corsMiddleware before this is reached.
+func preflightHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notFoundHandler answers requests for paths no route serves.
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	respondError(w, http.StatusNotFound, "No such endpoint")
+}
+
+// methodNotAllowedHandler answers requests whose path router serves but not
+// with the request's method, listing the methods it does accept in the Allow
+// header.
+func methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := allowedMethods(router, r)
+		// The preflight route matches every path, so a path nothing else
+		// serves is unknown rather than OPTIONS-only.
+		if !slices.ContainsFunc(allowed, func(m string) bool { return m != http.MethodOptions }) {
+			notFoundHandler(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		respondError(w, http.StatusMethodNotAllowed, "Method "+r.Method+" not allowed")
+	})
+}
+
+// allowedMethods returns, sorted, the methods router has a route for at r's
+// path.
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var allowed []string
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			req := r.Clone(r.Context())
+			req.Method = method
+			var match mux.RouteMatch
+			if route.Match(req, &match) && !slices.Contains(allowed, method) {
+				allowed = append(allowed, method)
+			}
+		}
+		return nil
+	})
+	slices.Sort(allowed)
+	return allowed
+}
+
+// ipRateLimiter keeps a token-bucket limiter per client IP.
+type ipRateLimiter struct {
+	mu       sync.Mutex
+	limiters map[string]*ipLimiter
+	limit    rate.Limit
+	burst    int
+}
+
+type ipLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newIPRateLimiter returns a limiter allowing each IP limit requests per
+// second with bursts of up to burst requests.
+func newIPRateLimiter(limit float64, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		limiters: make(map[string]*ipLimiter),
+		limit:    rate.Limit(limit),
+		burst:    burst,
+	}
+}
+
+// allow reports whether a request from ip may proceed.
+func (l *ipRateLimiter) allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.limiters[ip]
+	if !ok {
+		entry = &ipLimiter{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[ip] = entry
+	}
+	entry.lastSeen = time.Now()
+	return entry.limiter.Allow()
+}
+
+// evictIdle removes limiters that have not been used for maxIdle, checking
+// every interval until ctx is done.
+func (l *ipRateLimiter) evictIdle(ctx context.Context, interval, maxIdle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.mu.Lock()
+			for ip, entry := range l.limiters {
+				if now.Sub(entry.lastSeen) > maxIdle {
+					delete(l.limiters, ip)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// rateLimitMiddleware rejects requests with 429 once the client IP exceeds
+// its rate limit. A nil limiter lets every request through.
+func rateLimitMiddleware(l *ipRateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.allow(clientIP(r)) {
+				respondError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the IP address the request came from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// bodyLimitMiddleware caps request bodies at limit bytes. Reading past the
+// limit fails with an *http.MaxBytesError, which handlers report as 413.
+func bodyLimitMiddleware(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestTimeoutMiddleware answers a request with 503 if its handler has not
+// started responding after timeout. The handler's context is cancelled at
+// the same moment, so store calls that honour it give up too, and anything
+// it writes afterwards is discarded. A handler that has already started
+// responding, such as a long export, is left to finish. Routes whose path
+// template is listed in except, which wait on purpose, are let through
+// unbounded.
+func requestTimeoutMiddleware(timeout time.Duration, except ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil && slices.Contains(except, tmpl) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{w: w, header: w.Header().Clone()}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case <-done:
+				tw.mu.Lock()
+				tw.copyHeader()
+				tw.mu.Unlock()
+				return
+			case p := <-panicked:
+				panic(p)
+			case <-ctx.Done():
+			}
+			tw.mu.Lock()
+			started := tw.wroteHeader
+			if !started {
+				tw.timedOut = true
+				respondError(w, http.StatusServiceUnavailable, "Request timed out")
+			}
+			tw.mu.Unlock()
+			if started {
+				select {
+				case <-done:
+				case p := <-panicked:
+					panic(p)
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter lets requestTimeoutMiddleware and a handler running on
+// another goroutine share a response. The handler gets its own header map,
+// copied out when it starts responding, and its writes are dropped once the
+// middleware has answered with 503.
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeader(code)
+}
+
+// writeHeader sends the handler's headers and status. The caller holds tw.mu.
+func (tw *timeoutWriter) writeHeader(code int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.copyHeader()
+	tw.wroteHeader = true
+	tw.w.WriteHeader(code)
+}
+
+// copyHeader replaces the response headers with the handler's, unless the
+// response has started. The caller holds tw.mu.
+func (tw *timeoutWriter) copyHeader() {
+	if tw.wroteHeader {
+		return
+	}
+	dst := tw.w.Header()
+	clear(dst)
+	for name, values := range tw.header {
+		dst[name] = values
+	}
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.w.Write(p)
+}
+
+// Flush sends what has been written so far, unless the request has timed
+// out.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeader(http.StatusOK)
+	http.NewResponseController(tw.w).Flush()
+}
+
+// jsonContentTypeMiddleware rejects POST, PUT and PATCH requests whose body
+// is not declared as JSON with 415, before a handler tries to decode it. A
+// charset parameter is allowed if it is UTF-8. Requests without a body, and
+// routes whose path template is listed in except, are let through.
+func jsonContentTypeMiddleware(except ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !hasBody(r) || (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil && slices.Contains(except, tmpl) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			charset, hasCharset := params["charset"]
+			if err != nil || mediaType != "application/json" || (hasCharset && !strings.EqualFold(charset, "utf-8")) {
+				respondError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasBody reports whether a request carries a body, either of a known
+// non-zero length or chunked.
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && (r.ContentLength > 0 || r.ContentLength == -1)
+}
+
+// authMiddleware requires requests to carry an "Authorization: Bearer <key>"
+// header matching apiKey, except for the /healthz and /readyz probes. It is a
+// no-op when apiKey is empty so local development needs no setup.
+func authMiddleware(apiKey string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if apiKey == "" {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+				respondError(w, http.StatusUnauthorized, "Missing or invalid API key")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
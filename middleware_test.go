@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, Config{LogFormat: "json"})
+
+	handler := loggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req, _ := http.NewRequest("GET", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusTeapot {
+		t.Errorf("middleware changed the status code: got %v want %v", status, http.StatusTeapot)
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("middleware did not log JSON: %v", err)
+	}
+	if entry["method"] != "GET" || entry["path"] != "/tasks" || entry["status"] != float64(http.StatusTeapot) {
+		t.Errorf("middleware logged unexpected entry: got %v", entry)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, Config{LogFormat: "json"})
+	handler := requestIDMiddleware(loggingMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"propagated", "abc-123", true},
+		{"missing", "", false},
+		{"unprintable", "bad\nid", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			req, _ := http.NewRequest("GET", "/tasks", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Request-ID", tt.incoming)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			id := rr.Header().Get("X-Request-ID")
+			if tt.keep && id != tt.incoming {
+				t.Errorf("middleware did not echo the request ID: got %q want %q", id, tt.incoming)
+			}
+			if !tt.keep && (id == "" || id == tt.incoming) {
+				t.Errorf("middleware did not generate a request ID: got %q", id)
+			}
+			var entry map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("middleware did not log JSON: %v", err)
+			}
+			if entry["request_id"] != id {
+				t.Errorf("log line has wrong request ID: got %v want %q", entry["request_id"], id)
+			}
+		})
+	}
+}
+
+func TestJSONContentTypeMiddleware(t *testing.T) {
+	router, _ := setupRouter()
+	router.Use(jsonContentTypeMiddleware("/tasks/import"))
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"json", "POST", "/tasks", "application/json", `{"name": "A"}`, http.StatusCreated},
+		{"utf-8 charset", "POST", "/tasks", "application/json; charset=UTF-8", `{"name": "B"}`, http.StatusCreated},
+		{"other charset", "POST", "/tasks", "application/json; charset=latin1", `{"name": "C"}`, http.StatusUnsupportedMediaType},
+		{"form", "POST", "/tasks", "application/x-www-form-urlencoded", `name=D`, http.StatusUnsupportedMediaType},
+		{"missing", "PATCH", "/tasks", "", `{"set": {"priority": 1}}`, http.StatusUnsupportedMediaType},
+		{"no body", "POST", "/tasks/complete-all", "", ``, http.StatusOK},
+		{"exempt route", "POST", "/tasks/import", "text/csv", "name\nE\n", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.status {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", status, tt.status, rr.Body)
+			}
+			if tt.status == http.StatusUnsupportedMediaType && !strings.Contains(rr.Body.String(), `"error"`) {
+				t.Errorf("handler did not return a JSON error: got %v", rr.Body)
+			}
+		})
+	}
+}
+
+func TestUnmatchedRouteHandlers(t *testing.T) {
+	router := mux.NewRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/tasks", ok).Methods("GET")
+	router.HandleFunc("/tasks", ok).Methods("POST")
+	router.HandleFunc("/tasks/{id}", ok).Methods("GET")
+	router.Methods(http.MethodOptions).HandlerFunc(preflightHandler)
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	router.MethodNotAllowedHandler = methodNotAllowedHandler(router)
+
+	req, _ := http.NewRequest("PUT", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusMethodNotAllowed {
+		t.Errorf("router returned wrong status code: got %v want %v", status, http.StatusMethodNotAllowed)
+	}
+	if allow := rr.Header().Get("Allow"); allow != "GET, OPTIONS, POST" {
+		t.Errorf("router returned wrong Allow header: got %q", allow)
+	}
+	if !strings.Contains(rr.Body.String(), `"error"`) {
+		t.Errorf("router did not return a JSON error: got %v", rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/nowhere", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("router returned wrong status code: got %v want %v", status, http.StatusNotFound)
+	}
+	if !strings.Contains(rr.Body.String(), `"error"`) {
+		t.Errorf("router did not return a JSON error: got %v", rr.Body.String())
+	}
+}
+
+func TestGzipMiddleware(t *testing.T) {
+	large := strings.Repeat("task ", 1000)
+	handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if r.URL.Path == "/small" {
+			io.WriteString(w, "ok")
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		// Write in pieces to cross the size threshold mid-response
+		io.WriteString(w, large[:100])
+		io.WriteString(w, large[100:])
+	}))
+
+	req, _ := http.NewRequest("GET", "/large", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Errorf("middleware changed the status code: got %v want %v", status, http.StatusCreated)
+	}
+	if ce := rr.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("middleware did not compress a large response: Content-Encoding %q", ce)
+	}
+	zr, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("response is not gzip: %v", err)
+	}
+	if body, err := io.ReadAll(zr); err != nil || string(body) != large {
+		t.Errorf("decompressed body does not match: %d bytes, %v", len(body), err)
+	}
+
+	for _, tt := range []struct{ path, acceptEncoding string }{
+		{"/small", "gzip"},
+		{"/large", ""},
+		{"/large", "gzip;q=0"},
+	} {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if ce := rr.Header().Get("Content-Encoding"); ce != "" {
+			t.Errorf("middleware compressed %s for Accept-Encoding %q", tt.path, tt.acceptEncoding)
+		}
+	}
+}
+
+func TestGzipMiddlewareSkipsEventStreams(t *testing.T) {
+	router, _ := setupRouter()
+	router.Use(gzipMiddleware)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/tasks/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Could not subscribe to events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+		t.Errorf("middleware compressed an event stream: Content-Encoding %q", ce)
+	}
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	handler := securityHeadersMiddleware("default-src 'self'")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req, _ := http.NewRequest("GET", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	for name, want := range map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Content-Security-Policy": "default-src 'self'",
+	} {
+		if got := rr.Header().Get(name); got != want {
+			t.Errorf("middleware set wrong %s: got %q want %q", name, got, want)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).Methods("GET")
+	router.Methods(http.MethodOptions).HandlerFunc(preflightHandler)
+	router.Use(corsMiddleware("https://example.com", 10*time.Minute))
+
+	req, _ := http.NewRequest("GET", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("middleware returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	if origin := rr.Header().Get("Access-Control-Allow-Origin"); origin != "https://example.com" {
+		t.Errorf("middleware set wrong allowed origin: got %q", origin)
+	}
+
+	// Test preflight request
+	req, _ = http.NewRequest("OPTIONS", "/tasks", nil)
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Errorf("middleware returned wrong status code for preflight: got %v want %v", status, http.StatusNoContent)
+	}
+	if methods := rr.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(methods, "PATCH") {
+		t.Errorf("middleware set wrong allowed methods: got %q", methods)
+	}
+	if maxAge := rr.Header().Get("Access-Control-Max-Age"); maxAge != "600" {
+		t.Errorf("middleware set wrong max age: got %q want 600", maxAge)
+	}
+	if headers := rr.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(headers, "Idempotency-Key") {
+		t.Errorf("middleware set wrong allowed headers: got %q", headers)
+	}
+
+	req, _ = http.NewRequest("OPTIONS", "/tasks", nil)
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-unknown, authorization")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if headers := rr.Header().Get("Access-Control-Allow-Headers"); headers != "content-type, authorization" {
+		t.Errorf("middleware echoed wrong allowed headers: got %q", headers)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := newIPRateLimiter(1, 2)
+	handler := rateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 0, 3)
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("POST", "/tasks", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("middleware returned wrong status codes for burst: got %v", codes)
+	}
+
+	// A different client has its own budget
+	req, _ := http.NewRequest("POST", "/tasks", nil)
+	req.RemoteAddr = "192.0.2.2:1234"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("middleware limited an unrelated client: got %v want %v", status, http.StatusOK)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	handler := authMiddleware("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path   string
+		header string
+		want   int
+	}{
+		{"/tasks", "", http.StatusUnauthorized},
+		{"/tasks", "Bearer wrong", http.StatusUnauthorized},
+		{"/tasks", "secret", http.StatusUnauthorized},
+		{"/tasks", "Bearer secret", http.StatusOK},
+		{"/healthz", "", http.StatusOK},
+		{"/readyz", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != tt.want {
+			t.Errorf("middleware returned wrong status code for %s with %q: got %v want %v", tt.path, tt.header, status, tt.want)
+		}
+	}
+
+	// Test that an empty key disables auth
+	handler = authMiddleware("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req, _ := http.NewRequest("GET", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("middleware enforced auth without a key: got %v want %v", status, http.StatusOK)
+	}
+}
+
+func TestRequestTimeoutMiddleware(t *testing.T) {
+	h := &Handlers{logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	router := mux.NewRouter()
+	router.Use(requestTimeoutMiddleware(10*time.Millisecond, "/tasks/poll"))
+	router.HandleFunc("/tasks", func(w http.ResponseWriter, r *http.Request) {
+		// Stands in for a store call that hangs until the request is given up.
+		<-r.Context().Done()
+		h.storeError(r.Context(), w, r.Context().Err())
+	})
+	router.HandleFunc("/tasks/poll", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Errorf("exempt route got a deadline")
+		}
+	})
+
+	req, _ := http.NewRequest("GET", "/tasks", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+	if expected := `{"error":"Request timed out"}`; strings.TrimSpace(rr.Body.String()) != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+
+	req, _ = http.NewRequest("GET", "/tasks/poll", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+// slowStore is a store whose Get takes delay and, like MemoryStore, pays no
+// attention to the context.
+type slowStore struct {
+	*MemoryStore
+	delay time.Duration
+}
+
+func (s slowStore) Get(ctx context.Context, id string) (Task, error) {
+	time.Sleep(s.delay)
+	return s.MemoryStore.Get(ctx, id)
+}
+
+func TestRequestTimeoutMiddlewareRouter(t *testing.T) {
+	cfg, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig returned error: %v", err)
+	}
+	cfg.RequestTimeout = 20 * time.Millisecond
+	memory, _ := NewMemoryStore("")
+	memory.tasks["1"] = Task{ID: "1", Name: "Slow"}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	h := newHandlers(cfg, slowStore{MemoryStore: memory, delay: time.Second}, uuidGenerator{}, logger)
+	router := newRouter(h, cfg, newIPRateLimiter(cfg.RateLimit, cfg.RateLimitBurst), logger)
+
+	req, _ := http.NewRequest("GET", "/tasks/1", nil)
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	router.ServeHTTP(rr, req)
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("request was not cut short: took %v", elapsed)
+	}
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+	if expected := `{"error":"Request timed out"}`; strings.TrimSpace(rr.Body.String()) != expected {
+		t.Errorf("handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
+	}
+}
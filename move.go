@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// positionGap is the distance between the positions of consecutive tasks
+// when they are first placed or reindexed. Moving a task puts it halfway
+// between its new neighbors, so each gap can be split many times before
+// positions have to be spread out again.
+const positionGap = 1024
+
+// TaskMove is the body of a move request. Exactly one field must be set: an
+// explicit position, or the ID of the task to place the moved one directly
+// before or after.
+type TaskMove struct {
+	Position *float64 `json:"position"`
+	Before   string   `json:"before"`
+	After    string   `json:"after"`
+}
+
+// nextPosition returns the position that puts a new task after every stored
+// one.
+func (h *Handlers) nextPosition(ctx context.Context) (float64, error) {
+	tasks, err := h.store.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var last float64
+	for _, task := range tasks {
+		last = max(last, task.Position)
+	}
+	return last + positionGap, nil
+}
+
+// moveTaskHandler changes a task's position in the manual sort order used by
+// ?sort=position. Only the moved task is rewritten, unless there is no room
+// left between its new neighbors, in which case every task is reindexed.
+func (h *Handlers) moveTaskHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var move TaskMove
+	if err := decodeJSON(r, &move); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	set := 0
+	for _, given := range []bool{move.Position != nil, move.Before != "", move.After != ""} {
+		if given {
+			set++
+		}
+	}
+	if set != 1 {
+		respondError(w, http.StatusBadRequest, "Exactly one of position, before and after is required")
+		return
+	}
+	if move.Before == id || move.After == id {
+		respondError(w, http.StatusBadRequest, "A task cannot be moved relative to itself")
+		return
+	}
+
+	if move.Position != nil {
+		h.setPosition(w, r, id, *move.Position)
+		return
+	}
+
+	tasks, err := h.filteredTasks(r.Context(), taskFilter{includeArchived: true})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	sortTasks(tasks, "position", false)
+	found := false
+	order := make([]Task, 0, len(tasks))
+	for _, task := range tasks {
+		if task.ID == id {
+			found = true
+		} else {
+			order = append(order, task)
+		}
+	}
+	if !found {
+		h.storeError(r.Context(), w, ErrNotFound)
+		return
+	}
+	anchor := move.Before + move.After
+	i := slices.IndexFunc(order, func(task Task) bool { return task.ID == anchor })
+	if i < 0 {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Task %s not found", anchor))
+		return
+	}
+	if move.After != "" {
+		i++
+	}
+
+	// The moved task goes between order[i-1] and order[i].
+	var lo, hi float64
+	switch {
+	case i == 0:
+		lo, hi = order[0].Position-2*positionGap, order[0].Position
+	case i == len(order):
+		lo, hi = order[i-1].Position, order[i-1].Position+2*positionGap
+	default:
+		lo, hi = order[i-1].Position, order[i].Position
+	}
+	if position := lo + (hi-lo)/2; lo < position && position < hi {
+		h.setPosition(w, r, id, position)
+		return
+	}
+
+	positions := make(map[string]float64, len(order)+1)
+	for j, task := range slices.Insert(order, i, Task{ID: id}) {
+		positions[task.ID] = float64(j+1) * positionGap
+	}
+	now := time.Now().UTC()
+	updated, err := h.store.UpdateMatching(r.Context(), func(task Task) bool {
+		position, ok := positions[task.ID]
+		return ok && task.Position != position
+	}, func(task *Task) error {
+		task.Position = positions[task.ID]
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventUpdated, updated...)
+
+	task, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	w.Header().Set("ETag", taskETag(task))
+	respondJSON(w, http.StatusOK, task)
+}
+
+// setPosition moves a task to the given position.
+func (h *Handlers) setPosition(w http.ResponseWriter, r *http.Request, id string, position float64) {
+	task, err := h.store.Update(r.Context(), id, func(task *Task) error {
+		if task.DeletedAt != nil {
+			return ErrNotFound
+		}
+		if task.Position != position {
+			task.Position = position
+			task.UpdatedAt = time.Now().UTC()
+			task.Version++
+		}
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventUpdated, task)
+	w.Header().Set("ETag", taskETag(task))
+	respondJSON(w, http.StatusOK, task)
+}
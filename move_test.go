@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// listOrder returns the IDs of the listed tasks in manual order.
+func listOrder(t *testing.T, router http.Handler) string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/tasks?sort=position", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	var ids []string
+	for _, task := range list.Tasks {
+		ids = append(ids, task.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestMoveTaskHandler(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["a"] = Task{ID: "a", Name: "A", Position: 1024, Version: 1}
+	store.tasks["b"] = Task{ID: "b", Name: "B", Position: 2048, Version: 1}
+	store.tasks["c"] = Task{ID: "c", Name: "C", Position: 3072, Version: 1}
+
+	tests := []struct {
+		id   string
+		body string
+		want string
+	}{
+		{"c", `{"before": "a"}`, "c,a,b"},
+		{"c", `{"after": "a"}`, "a,c,b"},
+		{"a", `{"after": "b"}`, "c,b,a"},
+		{"b", `{"position": 0}`, "b,c,a"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("PUT", "/tasks/"+tt.id+"/move", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code for %s: got %v want %v: %s", tt.body, status, http.StatusOK, rr.Body)
+		}
+		if got := listOrder(t, router); got != tt.want {
+			t.Errorf("moving %s with %s gave order %s, want %s", tt.id, tt.body, got, tt.want)
+		}
+	}
+	if task := store.tasks["b"]; task.Version != 2 {
+		t.Errorf("moved task was not versioned: got %+v", task)
+	}
+}
+
+func TestMoveTaskHandlerReindexes(t *testing.T) {
+	router, store := setupRouter()
+	// Tasks stored before positions existed all share the same one
+	store.tasks["a"] = Task{ID: "a", Name: "A"}
+	store.tasks["b"] = Task{ID: "b", Name: "B"}
+	store.tasks["c"] = Task{ID: "c", Name: "C"}
+
+	req, _ := http.NewRequest("PUT", "/tasks/c/move", strings.NewReader(`{"after": "a"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+	if got := listOrder(t, router); got != "a,c,b" {
+		t.Errorf("reindexing gave order %s, want a,c,b", got)
+	}
+	if a, c := store.tasks["a"], store.tasks["c"]; a.Position != positionGap || c.Position != 2*positionGap {
+		t.Errorf("tasks were not spread out: got %v and %v", a.Position, c.Position)
+	}
+}
+
+func TestMoveTaskHandlerInvalid(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["a"] = Task{ID: "a", Name: "A"}
+
+	tests := []struct {
+		id     string
+		body   string
+		status int
+	}{
+		{"a", `{}`, http.StatusBadRequest},
+		{"a", `{"before": "b", "position": 1}`, http.StatusBadRequest},
+		{"a", `{"before": "a"}`, http.StatusBadRequest},
+		{"a", `{"after": "missing"}`, http.StatusNotFound},
+		{"missing", `{"position": 1}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("PUT", "/tasks/"+tt.id+"/move", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != tt.status {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", tt.body, status, tt.status)
+		}
+	}
+}
+
+func TestNewTasksGoLast(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["a"] = Task{ID: "a", Name: "Z is listed first by position", Position: 5000}
+
+	req, _ := http.NewRequest("POST", "/tasks/bulk", strings.NewReader(`[{"name": "B"}, {"name": "A"}]`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var created []Task
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if len(created) != 2 || created[0].Position != 5000+positionGap || created[1].Position != 5000+2*positionGap {
+		t.Errorf("new tasks were not placed last: got %+v", created)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ndjsonMediaType is the media type of newline-delimited JSON, one value per
+// line.
+const ndjsonMediaType = "application/x-ndjson"
+
+// acceptsNDJSON reports whether an Accept header asks for newline-delimited
+// JSON.
+func acceptsNDJSON(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == ndjsonMediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// respondTaskStream writes a page of tasks as newline-delimited JSON, one task
+// per line, flushing each line as it goes so clients can process the tasks as
+// they arrive rather than once the whole list is in. The tasks are a snapshot
+// taken beforehand, so the store is not held while the client reads. As with
+// respondTaskArray, the total and the next page go in headers.
+func respondTaskStream(w http.ResponseWriter, r *http.Request, list TaskList, fields map[string]bool) {
+	setListHeaders(w, r, list)
+	w.Header().Set("Content-Type", ndjsonMediaType)
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	for _, task := range list.Tasks {
+		if err := enc.Encode(selectFields(task, fields)); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// setListHeaders puts the total of a task list in the X-Total-Count header
+// and its next page, if any, in a Link header, for list responses that have
+// no room for them in the body.
+func setListHeaders(w http.ResponseWriter, r *http.Request, list TaskList) {
+	w.Header().Set("X-Total-Count", strconv.Itoa(list.Total))
+	if list.NextCursor != "" {
+		next := r.URL.Query()
+		next.Del("offset")
+		next.Set("cursor", list.NextCursor)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+}
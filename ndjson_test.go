@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetTasksHandlerNDJSON(t *testing.T) {
+	router, store := setupRouter()
+	router.Use(prettyJSONMiddleware(true))
+	for i := 0; i < maxPageLimit+100; i++ {
+		id := fmt.Sprintf("%04d", i)
+		store.tasks[id] = Task{ID: id, Name: "Task " + id}
+	}
+	store.tasks["done"] = Task{ID: "done", Name: "Done", Status: StatusCompleted}
+
+	req, _ := http.NewRequest("GET", "/tasks?status=0&fields=id", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != ndjsonMediaType {
+		t.Fatalf("handler returned %v with Content-Type %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if !rr.Flushed {
+		t.Errorf("handler did not flush the stream")
+	}
+	if total := rr.Header().Get("X-Total-Count"); total != "600" {
+		t.Errorf("handler returned wrong X-Total-Count: got %q want 600", total)
+	}
+	var ids []string
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var task map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &task); err != nil {
+			t.Fatalf("line %q is not a JSON object: %v", scanner.Text(), err)
+		}
+		if len(task) != 1 {
+			t.Errorf("handler did not select fields: got %v", task)
+		}
+		ids = append(ids, task["id"].(string))
+	}
+	if len(ids) != 600 || ids[0] != "0000" || ids[599] != "0599" {
+		t.Errorf("handler streamed %d tasks from %v, want all 600 in order", len(ids), ids[:1])
+	}
+
+	req, _ = http.NewRequest("GET", "/tasks?status=0&limit=2", nil)
+	req.Header.Set("Accept", "application/json, application/x-ndjson")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if lines := strings.Count(rr.Body.String(), "\n"); lines != 2 {
+		t.Errorf("handler streamed %d tasks with limit=2, want 2", lines)
+	}
+	if link := rr.Header().Get("Link"); !strings.Contains(link, `rel="next"`) {
+		t.Errorf("handler did not link the next page: got %q", link)
+	}
+}
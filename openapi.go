@@ -0,0 +1,24 @@
+package main
+
+import (
+	"embed"
+	"net/http"
+)
+
+// openAPIFS holds the OpenAPI description of the API. Keep openapi.json in
+// step with the routes registered in main; TestOpenAPIDocumentsEveryRoute
+// catches endpoints that are missing from it.
+//
+//go:embed openapi.json
+var openAPIFS embed.FS
+
+// openAPIHandler serves the embedded OpenAPI document.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	spec, err := openAPIFS.ReadFile("openapi.json")
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPIHandler(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	openAPIHandler(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var spec struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &spec); err != nil || !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("handler did not serve an OpenAPI 3 document: %v", err)
+	}
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	data, err := openAPIFS.ReadFile("openapi.json")
+	if err != nil {
+		t.Fatalf("Could not read spec: %v", err)
+	}
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("Could not parse spec: %v", err)
+	}
+
+	router, _ := setupRouter()
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("spec does not document %s %s", method, path)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// pollTasksHandler answers GET /tasks/poll?since=<RFC 3339 time> with the
+// tasks updated after since, including ones moved to the trash, oldest
+// change first. If there are none it waits for a change, for at most the
+// configured poll timeout, and responds with an empty list if nothing
+// changes. Clients pass the latest updated_at they have seen as the next
+// since. Purged tasks are not reported. Like the event stream, a poll is
+// exempt from the server's write timeout, as it may wait longer.
+func (h *Handlers) pollTasksHandler(w http.ResponseWriter, r *http.Request) {
+	since, err := time.Parse(time.RFC3339Nano, r.URL.Query().Get("since"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Since must be an RFC 3339 timestamp")
+		return
+	}
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Subscribe before looking at the store so a change made in between
+	// still wakes the poll.
+	ch := h.events.subscribe(1)
+	defer h.events.unsubscribe(ch)
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.pollTimeout)
+	defer cancel()
+	for {
+		tasks, err := h.changedSince(r.Context(), since)
+		if err != nil {
+			h.storeError(r.Context(), w, err)
+			return
+		}
+		if len(tasks) > 0 {
+			respondJSON(w, http.StatusOK, TaskList{Tasks: tasks, Total: len(tasks)})
+			return
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			respondJSON(w, http.StatusOK, TaskList{Tasks: []Task{}, Total: 0})
+			return
+		}
+	}
+}
+
+// changedSince returns the tasks updated after since, sorted by update time.
+func (h *Handlers) changedSince(ctx context.Context, since time.Time) ([]Task, error) {
+	all, err := h.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []Task{}
+	for _, task := range all {
+		if task.UpdatedAt.After(since) {
+			tasks = append(tasks, task)
+		}
+	}
+	sortTasks(tasks, "updated_at", false)
+	return tasks, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollTasksHandler(t *testing.T) {
+	router, store := setupRouter()
+	then := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store.tasks["old"] = Task{ID: "old", Name: "Old", UpdatedAt: then}
+	store.tasks["new"] = Task{ID: "new", Name: "New", UpdatedAt: then.Add(time.Minute)}
+
+	poll := func(since time.Time) TaskList {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "/tasks/poll?since="+since.Format(time.RFC3339Nano), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+		}
+		var list TaskList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		return list
+	}
+
+	if list := poll(then); list.Total != 1 || list.Tasks[0].ID != "new" {
+		t.Errorf("poll returned %+v, want only the task changed after since", list)
+	}
+
+	start := time.Now()
+	if list := poll(then.Add(time.Hour)); list.Total != 0 || list.Tasks == nil {
+		t.Errorf("poll with no changes returned %+v, want an empty list", list)
+	}
+	if waited := time.Since(start); waited < 100*time.Millisecond {
+		t.Errorf("poll with no changes returned after %v, before the timeout", waited)
+	}
+
+	// A change made while the poll waits ends it.
+	since := time.Now().UTC()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "Created while polling"}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	if list := poll(since); list.Total != 1 || list.Tasks[0].Name != "Created while polling" {
+		t.Errorf("poll returned %+v, want the task created while it waited", list)
+	}
+}
+
+func TestPollTasksHandlerInvalidSince(t *testing.T) {
+	router, _ := setupRouter()
+	for _, path := range []string{"/tasks/poll", "/tasks/poll?since=yesterday"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("GET %s returned %v, want %v", path, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// pgForeignKeyViolation is the SQLSTATE PostgreSQL reports when a row
+// references a missing one.
+const pgForeignKeyViolation = "23503"
+
+// pgUniqueViolation is the SQLSTATE PostgreSQL reports when a row would
+// duplicate a key.
+const pgUniqueViolation = "23505"
+
+// postgresMigrations are applied in order when a PostgresStore is opened. As
+// with sqliteMigrations, append new statements rather than editing existing
+// ones.
+var postgresMigrations = []string{
+	`CREATE TABLE tasks (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		description TEXT NOT NULL,
+		status      INTEGER NOT NULL,
+		priority    INTEGER NOT NULL,
+		due_date    TIMESTAMPTZ,
+		created_at  TIMESTAMPTZ NOT NULL,
+		updated_at  TIMESTAMPTZ NOT NULL,
+		deleted_at  TIMESTAMPTZ,
+		tags        TEXT NOT NULL DEFAULT '[]',
+		version     INTEGER NOT NULL DEFAULT 0,
+		parent_id   TEXT,
+		assignee    TEXT NOT NULL DEFAULT ''
+	)`,
+	`ALTER TABLE tasks ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE tasks ADD COLUMN position DOUBLE PRECISION NOT NULL DEFAULT 0`,
+	`CREATE TABLE comments (
+		id         TEXT PRIMARY KEY,
+		task_id    TEXT NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+		author     TEXT NOT NULL,
+		body       TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX comments_task_id ON comments (task_id)`,
+	`ALTER TABLE tasks ADD COLUMN remind_at TIMESTAMPTZ`,
+	`ALTER TABLE tasks ADD COLUMN reminded_at TIMESTAMPTZ`,
+	`ALTER TABLE tasks ADD COLUMN expires_at TIMESTAMPTZ`,
+	`ALTER TABLE tasks ADD COLUMN depends_on TEXT NOT NULL DEFAULT '[]'`,
+	`CREATE TABLE templates (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		tasks      TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	)`,
+	`ALTER TABLE tasks ADD COLUMN project_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE projects (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		description TEXT NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL
+	)`,
+}
+
+// The shared task, comment, template and project statements rewritten for
+// PostgreSQL placeholders.
+var (
+	pgSelectTaskSQL     = postgresBind(selectTasksSQL + " WHERE id = ?")
+	pgInsertTaskSQL     = postgresBind(insertTaskSQL)
+	pgUpdateTaskSQL     = postgresBind(updateTaskSQL)
+	pgUpdateVersionSQL  = postgresBind(updateTaskVersionSQL)
+	pgInsertCommentSQL  = postgresBind(insertCommentSQL)
+	pgSelectTemplateSQL = postgresBind(selectTemplatesSQL + " WHERE id = ?")
+	pgInsertTemplateSQL = postgresBind(insertTemplateSQL)
+	pgSelectProjectSQL  = postgresBind(selectProjectsSQL + " WHERE id = ?")
+	pgInsertProjectSQL  = postgresBind(insertProjectSQL)
+	pgUpdateProjectSQL  = postgresBind(updateProjectSQL)
+	// pgShareProjectSQL reads a project a task is being put in, locking it
+	// against DeleteProject until the task is stored.
+	pgShareProjectSQL = pgSelectProjectSQL + " FOR SHARE"
+)
+
+// PostgresStore is a Store backed by a PostgreSQL database.
+type PostgresStore struct {
+	db       *sql.DB
+	maxTasks int // 0 means unlimited
+}
+
+// NewPostgresStore connects to the PostgreSQL database at url and brings its
+// schema up to date.
+func NewPostgresStore(url string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+
+	if err := migrate(db, postgresMigrations, postgresBind); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating database: %w", err)
+	}
+	return &PostgresStore{db: db}, nil
+}
+
+func (s *PostgresStore) GetAll(ctx context.Context) ([]Task, error) {
+	return queryTasks(ctx, s.db, selectTasksSQL)
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (Task, error) {
+	return getPostgresTask(ctx, s.db, id)
+}
+
+// Snapshot reads in a repeatable-read transaction, so every query sees the
+// database as it was at the first.
+func (s *PostgresStore) Snapshot(ctx context.Context) (Snapshot, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer tx.Rollback()
+
+	return readSnapshot(ctx, tx)
+}
+
+func (s *PostgresStore) Count(ctx context.Context) (int, error) {
+	return countTasks(ctx, s.db)
+}
+
+func (s *PostgresStore) SetMaxTasks(n int) {
+	s.maxTasks = n
+}
+
+func (s *PostgresStore) Create(ctx context.Context, tasks ...Task) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.checkTaskLimit(ctx, tx, len(tasks)); err != nil {
+		return err
+	}
+	if err := checkProjects(ctx, tx, pgShareProjectSQL, tasks...); err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if _, err := getPostgresTask(ctx, tx, task.ID); err == nil {
+			return ErrExists
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, pgInsertTaskSQL, taskArgs(task)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) Update(ctx context.Context, id string, fn func(*Task) error) (Task, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the row so concurrent updates of the same task are serialized.
+	task, err := scanTask(tx.QueryRowContext(ctx, pgSelectTaskSQL+" FOR UPDATE", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, ErrNotFound
+	}
+	if err != nil {
+		return Task{}, err
+	}
+	project := task.ProjectID
+	if err := fn(&task); err != nil {
+		return Task{}, err
+	}
+	if task.ProjectID != project {
+		if err := checkProjects(ctx, tx, pgShareProjectSQL, task); err != nil {
+			return Task{}, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, pgUpdateTaskSQL, append(taskArgs(task)[1:], id)...); err != nil {
+		return Task{}, err
+	}
+	return task, tx.Commit()
+}
+
+func (s *PostgresStore) UpdateMatching(ctx context.Context, match func(Task) bool, fn func(*Task) error) ([]Task, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, selectTasksSQL+" FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	updated, moved := []Task{}, []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !match(task) {
+			continue
+		}
+		project := task.ProjectID
+		if err := fn(&task); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		updated = append(updated, task)
+		if task.ProjectID != project {
+			moved = append(moved, task)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkProjects(ctx, tx, pgShareProjectSQL, moved...); err != nil {
+		return nil, err
+	}
+
+	for _, task := range updated {
+		if _, err := tx.ExecContext(ctx, pgUpdateTaskSQL, append(taskArgs(task)[1:], task.ID)...); err != nil {
+			return nil, err
+		}
+	}
+	return updated, tx.Commit()
+}
+
+func (s *PostgresStore) Commit(ctx context.Context, changes []TaskChange) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.checkTaskLimit(ctx, tx, createdTasks(changes)); err != nil {
+		return err
+	}
+	if err := checkProjects(ctx, tx, pgShareProjectSQL, changedTasks(changes)...); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if err := commitChange(ctx, tx, change, getPostgresTask, pgInsertTaskSQL, pgUpdateVersionSQL); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// checkTaskLimit is checkTaskLimit for PostgreSQL, where transactions run
+// concurrently. It first locks the tasks table against other writers, so two
+// creates cannot both count the same free room.
+func (s *PostgresStore) checkTaskLimit(ctx context.Context, tx *sql.Tx, n int) error {
+	if s.maxTasks == 0 || n == 0 {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE tasks IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+	return checkTaskLimit(ctx, tx, s.maxTasks, n)
+}
+
+func (s *PostgresStore) Delete(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM tasks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) DeleteMatching(ctx context.Context, match func(Task) bool) ([]Task, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, selectTasksSQL+" FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	deleted := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if match(task) {
+			deleted = append(deleted, task)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, task := range deleted {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = $1", task.ID); err != nil {
+			return nil, err
+		}
+	}
+	return deleted, tx.Commit()
+}
+
+func (s *PostgresStore) DeleteAll(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM tasks")
+	return err
+}
+
+// Replace relies on the comments table's foreign key to cascade the deletion
+// of tasks to their comments.
+func (s *PostgresStore) Replace(ctx context.Context, snapshot Snapshot) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tasks"); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM projects"); err != nil {
+		return err
+	}
+	for _, project := range snapshot.Projects {
+		if _, err := tx.ExecContext(ctx, pgInsertProjectSQL, projectArgs(project)...); err != nil {
+			return err
+		}
+	}
+	for _, task := range snapshot.Tasks {
+		if _, err := tx.ExecContext(ctx, pgInsertTaskSQL, taskArgs(task)...); err != nil {
+			return err
+		}
+	}
+	for _, comment := range snapshot.Comments {
+		if _, err := tx.ExecContext(ctx, pgInsertCommentSQL, commentArgs(comment)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *PostgresStore) Comments(ctx context.Context, taskID string) ([]Comment, error) {
+	return queryComments(ctx, s.db, selectCommentsSQL+" WHERE task_id = $1", taskID)
+}
+
+// AddComment relies on the comments table's foreign key to reject comments on
+// tasks that do not exist, including ones deleted concurrently.
+func (s *PostgresStore) AddComment(ctx context.Context, comment Comment) error {
+	_, err := s.db.ExecContext(ctx, pgInsertCommentSQL, commentArgs(comment)...)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *PostgresStore) Templates(ctx context.Context) ([]Template, error) {
+	return queryTemplates(ctx, s.db, selectTemplatesSQL)
+}
+
+func (s *PostgresStore) Template(ctx context.Context, id string) (Template, error) {
+	return getTemplate(ctx, s.db, pgSelectTemplateSQL, id)
+}
+
+// AddTemplate relies on the templates table's primary key to reject a taken
+// ID.
+func (s *PostgresStore) AddTemplate(ctx context.Context, template Template) error {
+	_, err := s.db.ExecContext(ctx, pgInsertTemplateSQL, templateArgs(template)...)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return ErrExists
+	}
+	return err
+}
+
+func (s *PostgresStore) Projects(ctx context.Context) ([]Project, error) {
+	return queryProjects(ctx, s.db, selectProjectsSQL)
+}
+
+func (s *PostgresStore) Project(ctx context.Context, id string) (Project, error) {
+	return getProject(ctx, s.db, pgSelectProjectSQL, id)
+}
+
+// AddProject relies on the projects table's primary key to reject a taken
+// ID.
+func (s *PostgresStore) AddProject(ctx context.Context, project Project) error {
+	_, err := s.db.ExecContext(ctx, pgInsertProjectSQL, projectArgs(project)...)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return ErrExists
+	}
+	return err
+}
+
+func (s *PostgresStore) UpdateProject(ctx context.Context, id string, fn func(*Project) error) (Project, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Project{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the row so concurrent updates of the same project are serialized.
+	project, err := getProject(ctx, tx, pgSelectProjectSQL+" FOR UPDATE", id)
+	if err != nil {
+		return Project{}, err
+	}
+	if err := fn(&project); err != nil {
+		return Project{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, pgUpdateProjectSQL, append(projectArgs(project)[1:], id)...); err != nil {
+		return Project{}, err
+	}
+	return project, tx.Commit()
+}
+
+func (s *PostgresStore) DeleteProject(ctx context.Context, id string, cascade bool) ([]Task, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getProject(ctx, tx, pgSelectProjectSQL+" FOR UPDATE", id); err != nil {
+		return nil, err
+	}
+	// Every task is locked, so none can come to refer to the project's tasks
+	// before they are deleted.
+	rows, err := tx.QueryContext(ctx, selectTasksSQL+" FOR UPDATE")
+	if err != nil {
+		return nil, err
+	}
+	deleted, outside := []Task{}, []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if task.ProjectID == id {
+			deleted = append(deleted, task)
+		} else {
+			outside = append(outside, task)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(deleted) > 0 && !cascade {
+		return nil, ErrProjectNotEmpty
+	}
+	if refersTo(outside, deleted) {
+		return nil, ErrProjectReferenced
+	}
+
+	for _, task := range deleted {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = $1", task.ID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM projects WHERE id = $1", id); err != nil {
+		return nil, err
+	}
+	return deleted, tx.Commit()
+}
+
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// getPostgresTask loads a single task by ID, returning ErrNotFound if there
+// is none.
+func getPostgresTask(ctx context.Context, q queryer, id string) (Task, error) {
+	task, err := scanTask(q.QueryRowContext(ctx, pgSelectTaskSQL, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, ErrNotFound
+	}
+	return task, err
+}
+
+// postgresBind rewrites the "?" placeholders in query as the numbered $1, $2,
+// ... parameters PostgreSQL expects. The shared statements never contain a
+// literal "?", so no quoting rules are needed.
+func postgresBind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+)
+
+// prettyJSONMiddleware indents JSON responses for people reading them, when
+// the request has ?pretty=true or, unless it has ?pretty=false, when
+// PRETTY_JSON is on. Handlers always write compact JSON through respondJSON;
+// the body is reformatted here once complete, so every JSON response,
+// JSON:API documents included, is treated alike. Responses of any other type,
+// such as event streams and CSV files, are passed straight through.
+func prettyJSONMiddleware(byDefault bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pretty := byDefault
+			if value := r.URL.Query().Get("pretty"); value != "" {
+				var err error
+				if pretty, err = parseBoolParam(value); err != nil {
+					respondError(w, http.StatusBadRequest, "Pretty must be true or false")
+					return
+				}
+			}
+			if !pretty || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			pw := &prettyResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(pw, r)
+			pw.close()
+		})
+	}
+}
+
+// prettyResponseWriter buffers a JSON response so it can be indented once
+// complete.
+type prettyResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+func (pw *prettyResponseWriter) WriteHeader(code int) {
+	if pw.wroteHeader {
+		return
+	}
+	pw.wroteHeader = true
+	pw.status = code
+	mediaType, _, _ := mime.ParseMediaType(pw.Header().Get("Content-Type"))
+	if mediaType != "application/json" && mediaType != jsonAPIMediaType {
+		pw.passthrough = true
+		pw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (pw *prettyResponseWriter) Write(p []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if pw.passthrough {
+		return pw.ResponseWriter.Write(p)
+	}
+	return pw.buf.Write(p)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (pw *prettyResponseWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
+
+// close sends the buffered response, indented if it is valid JSON.
+func (pw *prettyResponseWriter) close() {
+	if !pw.wroteHeader || pw.passthrough {
+		return
+	}
+	body := pw.buf.Bytes()
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err == nil {
+		body = indented.Bytes()
+	}
+	pw.Header().Del("Content-Length")
+	pw.ResponseWriter.WriteHeader(pw.status)
+	_, _ = pw.ResponseWriter.Write(body)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrettyJSONMiddleware(t *testing.T) {
+	tests := []struct {
+		byDefault bool
+		query     string
+		accept    string
+		want      int
+		pretty    bool
+	}{
+		{false, "", "", http.StatusOK, false},
+		{false, "?pretty=true", "", http.StatusOK, true},
+		{false, "?pretty=1", jsonAPIMediaType, http.StatusOK, true},
+		{true, "", "", http.StatusOK, true},
+		{true, "?pretty=false", "", http.StatusOK, false},
+		{false, "?pretty=maybe", "", http.StatusBadRequest, false},
+	}
+	for _, tt := range tests {
+		router, store := setupRouter()
+		store.tasks["1"] = Task{ID: "1", Name: "Read me"}
+		router.Use(prettyJSONMiddleware(tt.byDefault))
+		router.Use(jsonAPIMiddleware)
+
+		req, _ := http.NewRequest("GET", "/tasks/1"+tt.query, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("default %v, %s returned %v, want %v", tt.byDefault, tt.query, rr.Code, tt.want)
+			continue
+		}
+		if pretty := strings.Contains(rr.Body.String(), "\n  \""); pretty != tt.pretty {
+			t.Errorf("default %v, %s returned pretty %v, want %v: %s", tt.byDefault, tt.query, pretty, tt.pretty, rr.Body)
+		}
+	}
+}
+
+func TestPrettyJSONMiddlewareSkipsCSV(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Exported"}
+	router.Use(prettyJSONMiddleware(true))
+
+	req, _ := http.NewRequest("GET", "/tasks/export.csv", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Exported") {
+		t.Errorf("middleware changed a CSV export: %v %s", rr.Code, rr.Body)
+	}
+}
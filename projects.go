@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Project groups related tasks, such as everything for one release, beyond
+// what tags express: a task belongs to at most one project.
+type Project struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ProjectInput is the body of a request creating or replacing a project.
+type ProjectInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// ProjectSummary is a project as it is read back, with the number of tasks
+// in it.
+type ProjectSummary struct {
+	Project
+	TaskCount int `json:"task_count"` // tasks in the project, not counting the trash
+}
+
+// ProjectList is the response body listing projects.
+type ProjectList struct {
+	Projects []ProjectSummary `json:"projects"`
+	Total    int              `json:"total"`
+}
+
+// errProjectNotFound is returned by validateProject when a task refers to a
+// project that does not exist.
+var errProjectNotFound = errors.New("Project not found")
+
+// getProjectsHandler lists the projects, sorted by name, with their task
+// counts.
+func (h *Handlers) getProjectsHandler(w http.ResponseWriter, r *http.Request) {
+	projects, err := h.store.Projects(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	counts, err := h.projectTaskCounts(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	slices.SortFunc(projects, func(a, b Project) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	summaries := make([]ProjectSummary, len(projects))
+	for i, project := range projects {
+		summaries[i] = ProjectSummary{Project: project, TaskCount: counts[project.ID]}
+	}
+	respondJSON(w, http.StatusOK, ProjectList{Projects: summaries, Total: len(summaries)})
+}
+
+// getProjectHandler returns a project with its task count.
+func (h *Handlers) getProjectHandler(w http.ResponseWriter, r *http.Request) {
+	project, err := h.store.Project(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.projectError(r.Context(), w, err)
+		return
+	}
+	counts, err := h.projectTaskCounts(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, ProjectSummary{Project: project, TaskCount: counts[project.ID]})
+}
+
+// createProjectHandler stores a new project.
+func (h *Handlers) createProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var input ProjectInput
+	if err := decodeJSON(r, &input); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	if err := h.normalizeProjectInput(&input); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	project := Project{
+		ID:          uuid.New().String(),
+		Name:        input.Name,
+		Description: input.Description,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	if err := h.store.AddProject(r.Context(), project); err != nil {
+		h.projectError(r.Context(), w, err)
+		return
+	}
+	w.Header().Set("Location", "/projects/"+project.ID)
+	respondJSON(w, http.StatusCreated, project)
+}
+
+// updateProjectHandler replaces the name and description of a project. Its
+// tasks are left alone.
+func (h *Handlers) updateProjectHandler(w http.ResponseWriter, r *http.Request) {
+	var input ProjectInput
+	if err := decodeJSON(r, &input); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	if err := h.normalizeProjectInput(&input); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	project, err := h.store.UpdateProject(r.Context(), mux.Vars(r)["id"], func(project *Project) error {
+		project.Name = input.Name
+		project.Description = input.Description
+		return nil
+	})
+	if err != nil {
+		h.projectError(r.Context(), w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, project)
+}
+
+// deleteProjectHandler removes a project. While tasks are in it, even in the
+// trash, it is refused with 409 Conflict unless the delete cascades, removing
+// the tasks and their comments for good along with the project. Whether it
+// cascades is PROJECT_DELETE's setting, which ?cascade=true or ?cascade=false
+// overrides.
+func (h *Handlers) deleteProjectHandler(w http.ResponseWriter, r *http.Request) {
+	cascade := h.cascadeProjects
+	if v := r.URL.Query().Get("cascade"); v != "" {
+		var err error
+		if cascade, err = strconv.ParseBool(v); err != nil {
+			respondError(w, http.StatusBadRequest, "Cascade must be true or false")
+			return
+		}
+	}
+
+	removed, err := h.store.DeleteProject(r.Context(), mux.Vars(r)["id"], cascade)
+	if err != nil {
+		h.projectError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventDeleted, removed...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// moveTaskToProjectHandler puts a task in the project named in the request,
+// taking it out of any project it was in. A task already in the project is
+// returned unchanged. Tasks in the trash cannot be moved. The store checks
+// that the project exists as it moves the task, so one deleted meanwhile is
+// not left referred to.
+func (h *Handlers) moveTaskToProjectHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var before Task
+	task, err := h.store.Update(r.Context(), vars["id"], func(task *Task) error {
+		if task.DeletedAt != nil {
+			return errTrashed
+		}
+		before = *task
+		if task.ProjectID != vars["projectID"] {
+			task.ProjectID = vars["projectID"]
+			task.UpdatedAt = time.Now().UTC()
+			task.Version++
+		}
+		return nil
+	})
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if task.ProjectID != before.ProjectID {
+		h.publishUpdate(before, task)
+	}
+	respondJSON(w, http.StatusOK, task)
+}
+
+// normalizeProjectInput sanitizes and trims the fields of input, then checks
+// them.
+func (h *Handlers) normalizeProjectInput(input *ProjectInput) error {
+	input.Name = strings.TrimSpace(h.sanitize(input.Name))
+	input.Description = strings.TrimSpace(h.sanitize(input.Description))
+	if input.Name == "" {
+		return errors.New("Name is required")
+	}
+	if err := validateLength("Name", input.Name, maxNameLength); err != nil {
+		return err
+	}
+	return validateLength("Description", input.Description, maxDescriptionLength)
+}
+
+// projectTaskCounts returns the number of tasks outside the trash in each
+// project, by project ID.
+func (h *Handlers) projectTaskCounts(ctx context.Context) (map[string]int, error) {
+	tasks, err := h.store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, task := range tasks {
+		if task.ProjectID != "" && task.DeletedAt == nil {
+			counts[task.ProjectID]++
+		}
+	}
+	return counts, nil
+}
+
+// validateProject checks that projectID, unless it is empty, names a project
+// a task can be put in. It answers early with a clear error; the store checks
+// again when the task is written, with ErrNoProject, in case the project is
+// deleted in between.
+func (h *Handlers) validateProject(ctx context.Context, projectID string) error {
+	if projectID == "" {
+		return nil
+	}
+	_, err := h.store.Project(ctx, projectID)
+	if errors.Is(err, ErrNotFound) {
+		return errProjectNotFound
+	}
+	return err
+}
+
+// projectError is storeError for project requests, where ErrNotFound means
+// the project is missing. It also writes the response for an error returned
+// by validateProject.
+func (h *Handlers) projectError(ctx context.Context, w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errProjectNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrNotFound):
+		respondError(w, http.StatusNotFound, "Project not found")
+	case errors.Is(err, ErrProjectNotEmpty):
+		respondError(w, http.StatusConflict, "Project has tasks; move them out, or delete it with cascade=true to delete them too")
+	case errors.Is(err, ErrProjectReferenced):
+		respondError(w, http.StatusConflict, "Tasks outside the project are subtasks of, or depend on, tasks in it; change them first")
+	default:
+		h.storeError(ctx, w, err)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestProjects(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Ship it", Version: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Unrelated", Version: 1}
+
+	req, _ := http.NewRequest("POST", "/projects", strings.NewReader(`{"name": " Release 2.0 ", "description": "Spring release"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusCreated, rr.Body)
+	}
+	var project Project
+	if err := json.Unmarshal(rr.Body.Bytes(), &project); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if project.Name != "Release 2.0" || project.Description != "Spring release" || project.ID == "" {
+		t.Errorf("handler stored wrong project: %+v", project)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/projects/"+project.ID {
+		t.Errorf("handler returned wrong Location: got %q", loc)
+	}
+
+	req, _ = http.NewRequest("POST", "/projects", strings.NewReader(`{"name": "Backlog"}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	req, _ = http.NewRequest("GET", "/projects", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var list ProjectList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || list.Total != 2 || list.Projects[0].Name != "Backlog" || list.Projects[1].ID != project.ID {
+		t.Errorf("handler listed %+v, %v", list, err)
+	}
+
+	for i := range 2 {
+		req, _ = http.NewRequest("POST", "/tasks/1/move-to/"+project.ID, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+		}
+		var task Task
+		if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		if task.ProjectID != project.ID || task.Version != 2 {
+			t.Errorf("move %d returned %+v", i+1, task)
+		}
+	}
+	if stored := store.tasks["1"]; stored.ProjectID != project.ID || stored.Version != 2 {
+		t.Errorf("store holds %+v after the move", stored)
+	}
+
+	req, _ = http.NewRequest("GET", "/tasks?project="+project.ID, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var tasks TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &tasks); err != nil || tasks.Total != 1 || tasks.Tasks[0].ID != "1" {
+		t.Errorf("filtering by project returned %+v, %v", tasks, err)
+	}
+}
+
+func TestProjectsErrors(t *testing.T) {
+	router, store := setupRouter()
+	deleted := time.Now().UTC()
+	store.tasks["1"] = Task{ID: "1", Name: "Active"}
+	store.tasks["2"] = Task{ID: "2", Name: "Trashed", DeletedAt: &deleted}
+	store.projects["p1"] = Project{ID: "p1", Name: "Release"}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/projects", `{"name": "  "}`, http.StatusBadRequest},
+		{"POST", "/projects", `{"name": "` + strings.Repeat("a", maxNameLength+1) + `"}`, http.StatusBadRequest},
+		{"POST", "/projects", `{"name": "A", "owner": "bob"}`, http.StatusBadRequest},
+		{"POST", "/tasks/1/move-to/missing", ``, http.StatusNotFound},
+		{"POST", "/tasks/missing/move-to/p1", ``, http.StatusNotFound},
+		{"POST", "/tasks/2/move-to/p1", ``, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s %s returned %v, want %v: %s", tt.method, tt.path, tt.body, rr.Code, tt.want, rr.Body)
+		}
+	}
+	if len(store.projects) != 1 {
+		t.Errorf("invalid projects were stored: %+v", store.projects)
+	}
+	if store.tasks["1"].ProjectID != "" || store.tasks["2"].ProjectID != "" {
+		t.Errorf("failed moves changed tasks: %+v", store.tasks)
+	}
+}
+
+func TestProjectCRUD(t *testing.T) {
+	router, store := setupRouter()
+	deleted := time.Now().UTC()
+	store.projects["p1"] = Project{ID: "p1", Name: "Release", Description: "Spring release"}
+	store.tasks["1"] = Task{ID: "1", Name: "In it", ProjectID: "p1"}
+	store.tasks["2"] = Task{ID: "2", Name: "Trashed", ProjectID: "p1", DeletedAt: &deleted}
+	store.tasks["3"] = Task{ID: "3", Name: "Elsewhere"}
+
+	req, _ := http.NewRequest("GET", "/projects/p1", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var summary ProjectSummary
+	if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("handler returned %v: %s", rr.Code, rr.Body)
+	}
+	if summary.Name != "Release" || summary.TaskCount != 1 {
+		t.Errorf("handler returned %+v, want Release with 1 task", summary)
+	}
+
+	req, _ = http.NewRequest("GET", "/projects", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var list ProjectList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || list.Total != 1 || list.Projects[0].TaskCount != 1 {
+		t.Errorf("handler listed %+v, %v", list, err)
+	}
+
+	req, _ = http.NewRequest("PUT", "/projects/p1", strings.NewReader(`{"name": "Release 2.1"}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+	if got := store.projects["p1"]; got.Name != "Release 2.1" || got.Description != "" {
+		t.Errorf("store holds %+v after the update", got)
+	}
+	if store.tasks["1"].ProjectID != "p1" {
+		t.Errorf("updating the project changed its task: %+v", store.tasks["1"])
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"GET", "/projects/missing", ``, http.StatusNotFound},
+		{"PUT", "/projects/missing", `{"name": "A"}`, http.StatusNotFound},
+		{"PUT", "/projects/p1", `{"name": ""}`, http.StatusBadRequest},
+		{"DELETE", "/projects/missing", ``, http.StatusNotFound},
+		{"DELETE", "/projects/p1?cascade=maybe", ``, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s %s returned %v, want %v: %s", tt.method, tt.path, tt.body, rr.Code, tt.want, rr.Body)
+		}
+	}
+}
+
+func TestDeleteProjectHandler(t *testing.T) {
+	router, store := setupRouter()
+	deleted := time.Now().UTC()
+	store.projects["empty"] = Project{ID: "empty", Name: "Empty"}
+	store.projects["p1"] = Project{ID: "p1", Name: "Release"}
+	store.tasks["1"] = Task{ID: "1", Name: "Trashed", ProjectID: "p1", DeletedAt: &deleted}
+	store.tasks["2"] = Task{ID: "2", Name: "Elsewhere"}
+	store.comments["1"] = []Comment{{ID: "c1", TaskID: "1", Body: "Note"}}
+
+	req, _ := http.NewRequest("DELETE", "/projects/empty", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code for an empty project: got %v want %v: %s", status, http.StatusNoContent, rr.Body)
+	}
+
+	for _, path := range []string{"/projects/p1", "/projects/p1?cascade=false"} {
+		req, _ = http.NewRequest("DELETE", path, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusConflict {
+			t.Errorf("DELETE %s returned %v, want %v: %s", path, status, http.StatusConflict, rr.Body)
+		}
+	}
+	if _, ok := store.projects["p1"]; !ok || len(store.tasks) != 2 {
+		t.Fatalf("refused deletes changed the store: %+v, %+v", store.projects, store.tasks)
+	}
+
+	// A task outside the project must not be left depending on a deleted one
+	store.tasks["2"] = Task{ID: "2", Name: "Elsewhere", DependsOn: []string{"1"}}
+	req, _ = http.NewRequest("DELETE", "/projects/p1?cascade=true", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code for a referenced task: got %v want %v: %s", status, http.StatusConflict, rr.Body)
+	}
+	if _, ok := store.tasks["1"]; !ok {
+		t.Fatalf("refused cascading delete removed the task")
+	}
+	store.tasks["2"] = Task{ID: "2", Name: "Elsewhere"}
+
+	req, _ = http.NewRequest("DELETE", "/projects/p1?cascade=true", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusNoContent, rr.Body)
+	}
+	if _, ok := store.projects["p1"]; ok {
+		t.Errorf("cascading delete kept the project")
+	}
+	if _, ok := store.tasks["1"]; ok || len(store.comments["1"]) != 0 {
+		t.Errorf("cascading delete kept the project's task or its comments")
+	}
+	if _, ok := store.tasks["2"]; !ok {
+		t.Errorf("cascading delete removed a task outside the project")
+	}
+}
+
+func TestDeleteProjectHandlerCascadeByDefault(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, events: newEventBroker(), activity: newActivityLog(10), cascadeProjects: true}
+	store.projects["p1"] = Project{ID: "p1", Name: "Release"}
+	store.tasks["1"] = Task{ID: "1", Name: "In it", ProjectID: "p1"}
+
+	req := mux.SetURLVars(httptest.NewRequest("DELETE", "/projects/p1?cascade=false", nil), map[string]string{"id": "p1"})
+	rr := httptest.NewRecorder()
+	h.deleteProjectHandler(rr, req)
+	if status := rr.Code; status != http.StatusConflict {
+		t.Errorf("handler returned wrong status code with cascade=false: got %v want %v", status, http.StatusConflict)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest("DELETE", "/projects/p1", nil), map[string]string{"id": "p1"})
+	rr = httptest.NewRecorder()
+	h.deleteProjectHandler(rr, req)
+	if status := rr.Code; status != http.StatusNoContent {
+		t.Errorf("handler returned wrong status code: got %v want %v: %s", status, http.StatusNoContent, rr.Body)
+	}
+	if len(store.tasks) != 0 || len(store.projects) != 0 {
+		t.Errorf("delete left %+v, %+v", store.tasks, store.projects)
+	}
+}
+
+func TestTaskProjectID(t *testing.T) {
+	router, store := setupRouter()
+	store.projects["p1"] = Project{ID: "p1", Name: "Release"}
+
+	req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "Ship it", "project_id": "p1"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusCreated, rr.Body)
+	}
+	var task Task
+	if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil || task.ProjectID != "p1" {
+		t.Errorf("handler created %+v, %v", task, err)
+	}
+
+	req, _ = http.NewRequest("PATCH", "/tasks/"+task.ID, strings.NewReader(`{"project_id": ""}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if got := store.tasks[task.ID].ProjectID; rr.Code != http.StatusOK || got != "" {
+		t.Errorf("patch returned %v and left project %q: %s", rr.Code, got, rr.Body)
+	}
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{"POST", "/tasks", `{"name": "Lost", "project_id": "missing"}`},
+		{"POST", "/tasks/bulk", `[{"name": "Fine"}, {"name": "Lost", "project_id": "missing"}]`},
+		{"PATCH", "/tasks/" + task.ID, `{"project_id": "missing"}`},
+		{"PUT", "/tasks/" + task.ID, `{"name": "Ship it", "project_id": "missing", "version": 2}`},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "Project not found") {
+			t.Errorf("%s %s %s returned %v: %s", tt.method, tt.path, tt.body, rr.Code, rr.Body)
+		}
+	}
+	if len(store.tasks) != 1 || store.tasks[task.ID].ProjectID != "" {
+		t.Errorf("references to a missing project were stored: %+v", store.tasks)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Recurrence values. A task without a recurrence has an empty one; "none" is
+// accepted from clients as a synonym.
+const (
+	recurrenceDaily   = "daily"
+	recurrenceWeekly  = "weekly"
+	recurrenceMonthly = "monthly"
+)
+
+// normalizeRecurrence lowercases a recurrence and maps "none" to empty.
+func normalizeRecurrence(recurrence string) string {
+	recurrence = strings.ToLower(strings.TrimSpace(recurrence))
+	if recurrence == "none" {
+		return ""
+	}
+	return recurrence
+}
+
+// validateRecurrence checks a normalized recurrence.
+func validateRecurrence(recurrence string) error {
+	switch recurrence {
+	case "", recurrenceDaily, recurrenceWeekly, recurrenceMonthly:
+		return nil
+	}
+	return errors.New("Recurrence must be none, daily, weekly or monthly")
+}
+
+// nextDueDate advances due by whole recurrence periods until it is after now,
+// so a chore that was completed late is not created already overdue. A task
+// without a due date is next due one period from now.
+func nextDueDate(recurrence string, due *time.Time, now time.Time) time.Time {
+	next := now
+	if due != nil {
+		next = *due
+	}
+	for {
+		switch recurrence {
+		case recurrenceDaily:
+			next = next.AddDate(0, 0, 1)
+		case recurrenceWeekly:
+			next = next.AddDate(0, 0, 7)
+		default:
+			next = next.AddDate(0, 1, 0)
+		}
+		if next.After(now) {
+			return next
+		}
+	}
+}
+
+// runRecurrence creates the next occurrence of completed recurring tasks
+// every interval until ctx is done.
+func (h *Handlers) runRecurrence(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := h.spawnRecurrences(ctx, now.UTC()); err != nil {
+				h.logger.Error("Failed to create recurring tasks", "error", err)
+			}
+		}
+	}
+}
+
+// spawnRecurrences creates a fresh incomplete copy of every completed
+// recurring task, due one period later. The recurrence moves to the copy, so
+// each completion is only repeated once. Tasks that would exceed the task
+// limit are left for a later run.
+func (h *Handlers) spawnRecurrences(ctx context.Context, now time.Time) error {
+	all, err := h.store.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+	remaining, err := h.remainingCapacity(ctx)
+	if err != nil {
+		return err
+	}
+	due := map[string]bool{}
+	for _, task := range all {
+		if len(due) < remaining && recurrenceDue(task) {
+			due[task.ID] = true
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	// Check again under the store's lock, as the tasks may have changed.
+	var next []Task
+	done, err := h.store.UpdateMatching(ctx, func(task Task) bool {
+		return due[task.ID] && recurrenceDue(task)
+	}, func(task *Task) error {
+		nextDue := nextDueDate(task.Recurrence, task.DueDate, now)
+		clone := Task{
+			Name:        task.Name,
+			Description: task.Description,
+			Priority:    task.Priority,
+			DueDate:     &nextDue,
+			Tags:        task.Tags,
+			ParentID:    task.ParentID,
+			DependsOn:   task.DependsOn,
+			Assignee:    task.Assignee,
+			ProjectID:   task.ProjectID,
+			Recurrence:  task.Recurrence,
+		}
+		if err := h.prepareNewTask(&clone, now); err != nil {
+			return err
+		}
+		next = append(next, clone)
+
+		task.Recurrence = ""
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil || len(done) == 0 {
+		return err
+	}
+
+	if err := h.store.Create(ctx, next...); err != nil {
+		// Give the recurrences back so a later run tries again.
+		for i, task := range done {
+			recurrence := next[i].Recurrence
+			h.store.Update(ctx, task.ID, func(task *Task) error {
+				task.Recurrence = recurrence
+				return nil
+			})
+		}
+		return err
+	}
+	h.publish(eventUpdated, done...)
+	h.publish(eventCreated, next...)
+	return nil
+}
+
+// recurrenceDue reports whether task is a completed recurring task whose next
+// occurrence has not been created yet.
+func recurrenceDue(task Task) bool {
+	return task.Recurrence != "" && task.Status == 1 && task.DeletedAt == nil
+}
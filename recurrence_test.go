@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestNextDueDate(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	due := time.Date(2024, 3, 9, 9, 0, 0, 0, time.UTC)
+	longOverdue := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		recurrence string
+		due        *time.Time
+		want       time.Time
+	}{
+		{"daily", recurrenceDaily, &due, time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{"weekly", recurrenceWeekly, &due, time.Date(2024, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"monthly", recurrenceMonthly, &due, time.Date(2024, 4, 9, 9, 0, 0, 0, time.UTC)},
+		{"skips missed periods", recurrenceWeekly, &longOverdue, time.Date(2024, 3, 14, 9, 0, 0, 0, time.UTC)},
+		{"no due date", recurrenceDaily, nil, now.AddDate(0, 0, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextDueDate(tt.recurrence, tt.due, now); !got.Equal(tt.want) {
+				t.Errorf("nextDueDate returned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpawnRecurrences(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, ids: uuidGenerator{}}
+
+	now := time.Now().UTC()
+	due := now.Add(-time.Hour)
+	store.projects["home"] = Project{ID: "home", Name: "Home"}
+	store.tasks["1"] = Task{ID: "1", Name: "Water plants", Status: 1, DueDate: &due, Tags: []string{"home"}, ProjectID: "home", Recurrence: recurrenceDaily, Version: 1}
+	store.tasks["2"] = Task{ID: "2", Name: "Not done yet", Recurrence: recurrenceDaily, Version: 1}
+	store.tasks["3"] = Task{ID: "3", Name: "One-off", Status: 1, Version: 1}
+
+	if err := h.spawnRecurrences(context.Background(), now); err != nil {
+		t.Fatalf("spawnRecurrences returned error: %v", err)
+	}
+	if len(store.tasks) != 4 {
+		t.Fatalf("spawnRecurrences created %d tasks, want 1", len(store.tasks)-3)
+	}
+	if done := store.tasks["1"]; done.Recurrence != "" || done.Version != 2 {
+		t.Errorf("completed task kept its recurrence: got %+v", done)
+	}
+	for id, task := range store.tasks {
+		if id == "1" || id == "2" || id == "3" {
+			continue
+		}
+		if task.Name != "Water plants" || task.Status != 0 || task.Recurrence != recurrenceDaily || task.ProjectID != "home" ||
+			task.DueDate == nil || !task.DueDate.Equal(due.AddDate(0, 0, 1)) || task.Version != 1 {
+			t.Errorf("next occurrence is wrong: got %+v", task)
+		}
+	}
+
+	// Running again must not repeat the same completion
+	if err := h.spawnRecurrences(context.Background(), now); err != nil {
+		t.Fatalf("spawnRecurrences returned error: %v", err)
+	}
+	if len(store.tasks) != 4 {
+		t.Errorf("second run created %d more tasks, want 0", len(store.tasks)-4)
+	}
+}
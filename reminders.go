@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// runReminders sends the reminders that have come due every interval until
+// ctx is done.
+func (h *Handlers) runReminders(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := h.sendReminders(ctx, now.UTC()); err != nil {
+				h.logger.Error("Failed to send reminders", "error", err)
+			}
+		}
+	}
+}
+
+// sendReminders marks every task whose reminder is due as reminded, then
+// logs a reminder for each and publishes it as a reminder event, which
+// reaches event stream clients and the webhook. Marking the tasks first means
+// each reminder is sent at most once, even if the server stops right after.
+func (h *Handlers) sendReminders(ctx context.Context, now time.Time) error {
+	reminded, err := h.store.UpdateMatching(ctx, func(task Task) bool {
+		return reminderDue(task, now)
+	}, func(task *Task) error {
+		task.RemindedAt = &now
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil || len(reminded) == 0 {
+		return err
+	}
+
+	for _, task := range reminded {
+		h.logger.Info("Task reminder", "task_id", task.ID, "name", task.Name, "remind_at", *task.RemindAt, "due_date", task.DueDate)
+	}
+	h.publish(eventUpdated, reminded...)
+	h.publish(eventReminder, reminded...)
+	return nil
+}
+
+// reminderDue reports whether task is an incomplete task outside the trash
+// whose reminder time has passed without a reminder being sent.
+func reminderDue(task Task, now time.Time) bool {
+	return task.RemindAt != nil && task.RemindedAt == nil && !task.RemindAt.After(now) &&
+		task.Status == StatusIncomplete && task.DeletedAt == nil
+}
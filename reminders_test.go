@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendReminders(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, events: newEventBroker(), logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	ch := h.events.subscribe(16)
+	defer h.events.unsubscribe(ch)
+
+	now := time.Now().UTC()
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	store.tasks["due"] = Task{ID: "due", Name: "Due", RemindAt: &past, Version: 1}
+	store.tasks["future"] = Task{ID: "future", Name: "Future", RemindAt: &future, Version: 1}
+	store.tasks["sent"] = Task{ID: "sent", Name: "Already reminded", RemindAt: &past, RemindedAt: &past, Version: 1}
+	store.tasks["completed"] = Task{ID: "completed", Name: "Completed", Status: StatusCompleted, RemindAt: &past, Version: 1}
+	store.tasks["trashed"] = Task{ID: "trashed", Name: "Trashed", RemindAt: &past, DeletedAt: &past, Version: 1}
+	store.tasks["none"] = Task{ID: "none", Name: "No reminder", Version: 1}
+
+	if err := h.sendReminders(context.Background(), now); err != nil {
+		t.Fatalf("sendReminders returned error: %v", err)
+	}
+	if task := store.tasks["due"]; task.RemindedAt == nil || !task.RemindedAt.Equal(now) || task.Version != 2 {
+		t.Errorf("due reminder was not marked as sent: %+v", task)
+	}
+	for _, id := range []string{"future", "completed", "trashed", "none"} {
+		if task := store.tasks[id]; task.RemindedAt != nil || task.Version != 1 {
+			t.Errorf("task %s was reminded: %+v", id, task)
+		}
+	}
+
+	var events []string
+	for len(ch) > 0 {
+		event := <-ch
+		events = append(events, event.Type+" "+event.Task.ID)
+	}
+	if got, want := strings.Join(events, ","), "updated due,reminder due"; got != want {
+		t.Errorf("sendReminders published %q, want %q", got, want)
+	}
+
+	// A second run finds nothing left to send.
+	if err := h.sendReminders(context.Background(), now.Add(time.Minute)); err != nil {
+		t.Fatalf("sendReminders returned error: %v", err)
+	}
+	if len(ch) != 0 {
+		t.Errorf("second run sent the reminder again")
+	}
+}
+
+func TestChangingRemindAtReschedules(t *testing.T) {
+	router, store := setupRouter()
+	sent := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	store.tasks["1"] = Task{ID: "1", Name: "Task", RemindAt: &sent, RemindedAt: &sent, Version: 1}
+
+	// Replacing the task with the same reminder keeps it marked as sent.
+	req, _ := http.NewRequest("PUT", "/tasks/1", strings.NewReader(`{"name": "Renamed", "remind_at": "2024-05-01T09:00:00Z", "version": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+	if task := store.tasks["1"]; task.RemindedAt == nil {
+		t.Errorf("PUT with an unchanged remind_at cleared reminded_at: %+v", task)
+	}
+
+	req, _ = http.NewRequest("PATCH", "/tasks/1", strings.NewReader(`{"remind_at": "2024-06-01T09:00:00Z"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+	if task := store.tasks["1"]; task.RemindedAt != nil || task.RemindAt == nil || task.RemindAt.Month() != time.June {
+		t.Errorf("PATCH of remind_at did not schedule a new reminder: %+v", task)
+	}
+}
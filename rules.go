@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ValidationRules are constraints a deployment places on tasks on top of the
+// ones the API always enforces, such as a shorter name limit or a required
+// description. They are loaded at startup from the JSON file VALIDATION_RULES
+// names. The zero value adds no constraints.
+type ValidationRules struct {
+	MaxNameLength        int      `json:"max_name_length"`        // 0 means the built-in limit
+	MaxDescriptionLength int      `json:"max_description_length"` // 0 means the built-in limit
+	RequireDescription   bool     `json:"require_description"`
+	RequireAssignee      bool     `json:"require_assignee"`
+	RequireDueDate       bool     `json:"require_due_date"`
+	AllowedStatuses      []Status `json:"allowed_statuses"`   // empty means every status
+	AllowedPriorities    []int    `json:"allowed_priorities"` // empty means every priority
+}
+
+// validationRules are the rules in force. They are set once at startup from
+// Config.ValidationRules.
+var validationRules ValidationRules
+
+// loadValidationRules reads the rules in the JSON file at path. An empty path
+// means no rules. Unknown fields are rejected, so a misspelt rule is not
+// silently ignored, and so are rules that would loosen the built-in limits.
+func loadValidationRules(path string) (ValidationRules, error) {
+	var rules ValidationRules
+	if path == "" {
+		return rules, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, fmt.Errorf("VALIDATION_RULES: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return rules, fmt.Errorf("VALIDATION_RULES: %s: %w", path, err)
+	}
+	if rules.MaxNameLength < 0 || rules.MaxNameLength > maxNameLength {
+		return rules, fmt.Errorf("VALIDATION_RULES: max_name_length must be between 0 and %d", maxNameLength)
+	}
+	if rules.MaxDescriptionLength < 0 || rules.MaxDescriptionLength > maxDescriptionLength {
+		return rules, fmt.Errorf("VALIDATION_RULES: max_description_length must be between 0 and %d", maxDescriptionLength)
+	}
+	for _, status := range rules.AllowedStatuses {
+		if !status.valid() {
+			return rules, fmt.Errorf("VALIDATION_RULES: allowed_statuses: %w", errInvalidStatus)
+		}
+	}
+	for _, priority := range rules.AllowedPriorities {
+		if !validPriority(priority) {
+			return rules, errors.New("VALIDATION_RULES: allowed_priorities may only hold 0, 1 and 2")
+		}
+	}
+	return rules, nil
+}
+
+// checkTask checks a normalized task against the rules.
+func (v ValidationRules) checkTask(task Task) error {
+	if err := v.checkName(task.Name); err != nil {
+		return err
+	}
+	if err := v.checkDescription(task.Description); err != nil {
+		return err
+	}
+	if v.RequireAssignee && task.Assignee == "" {
+		return errors.New("Assignee is required")
+	}
+	if v.RequireDueDate && task.DueDate == nil {
+		return errors.New("Due date is required")
+	}
+	if err := v.checkStatus(task.Status); err != nil {
+		return err
+	}
+	return v.checkPriority(task.Priority)
+}
+
+// checkPatch checks the fields a normalized patch sets against the rules.
+// Fields it leaves alone were checked when they were set.
+func (v ValidationRules) checkPatch(patch TaskPatch) error {
+	if patch.Name != nil {
+		if err := v.checkName(*patch.Name); err != nil {
+			return err
+		}
+	}
+	if patch.Description != nil {
+		if err := v.checkDescription(*patch.Description); err != nil {
+			return err
+		}
+	}
+	if patch.Assignee != nil && v.RequireAssignee && *patch.Assignee == "" {
+		return errors.New("Assignee is required")
+	}
+	if patch.Status != nil {
+		if err := v.checkStatus(*patch.Status); err != nil {
+			return err
+		}
+	}
+	if patch.Priority != nil {
+		return v.checkPriority(*patch.Priority)
+	}
+	return nil
+}
+
+func (v ValidationRules) checkName(name string) error {
+	if v.MaxNameLength > 0 {
+		return validateLength("Name", name, v.MaxNameLength)
+	}
+	return nil
+}
+
+func (v ValidationRules) checkDescription(description string) error {
+	if v.RequireDescription && description == "" {
+		return errors.New("Description is required")
+	}
+	if v.MaxDescriptionLength > 0 {
+		return validateLength("Description", description, v.MaxDescriptionLength)
+	}
+	return nil
+}
+
+// checkStatus checks that tasks may be given status.
+func (v ValidationRules) checkStatus(status Status) error {
+	if len(v.AllowedStatuses) == 0 || slices.Contains(v.AllowedStatuses, status) {
+		return nil
+	}
+	names := make([]string, len(v.AllowedStatuses))
+	for i, allowed := range v.AllowedStatuses {
+		names[i] = statusNames[allowed]
+	}
+	return fmt.Errorf("Status must be %s", strings.Join(names, " or "))
+}
+
+func (v ValidationRules) checkPriority(priority int) error {
+	if len(v.AllowedPriorities) == 0 || slices.Contains(v.AllowedPriorities, priority) {
+		return nil
+	}
+	values := make([]string, len(v.AllowedPriorities))
+	for i, allowed := range v.AllowedPriorities {
+		values[i] = strconv.Itoa(allowed)
+	}
+	return fmt.Errorf("Priority must be %s", strings.Join(values, " or "))
+}
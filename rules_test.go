@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useValidationRules puts rules in force for the rest of the test.
+func useValidationRules(t *testing.T, rules ValidationRules) {
+	t.Helper()
+	saved := validationRules
+	validationRules = rules
+	t.Cleanup(func() { validationRules = saved })
+}
+
+func TestValidationRules(t *testing.T) {
+	useValidationRules(t, ValidationRules{
+		MaxNameLength:      10,
+		RequireDescription: true,
+		RequireAssignee:    true,
+		AllowedStatuses:    []Status{StatusIncomplete},
+		AllowedPriorities:  []int{1, 2},
+	})
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Existing", Description: "Set", Assignee: "alice", Priority: 1}
+
+	tests := []struct {
+		method, path, body string
+		want               string
+	}{
+		{"POST", "/tasks", `{"name": "Far too long a name", "description": "d", "assignee": "a", "priority": 1}`, "Name must be at most 10 characters"},
+		{"POST", "/tasks", `{"name": "Short", "assignee": "a", "priority": 1}`, "Description is required"},
+		{"POST", "/tasks", `{"name": "Short", "description": "d", "priority": 1}`, "Assignee is required"},
+		{"POST", "/tasks", `{"name": "Short", "description": "d", "assignee": "a", "priority": 0}`, "Priority must be 1 or 2"},
+		{"POST", "/tasks", `{"name": "Short", "description": "d", "assignee": "a", "priority": 1, "status": "completed"}`, "Status must be incomplete"},
+		{"PUT", "/tasks/1", `{"name": "Short", "description": "d", "assignee": "a", "priority": 0}`, "Priority must be 1 or 2"},
+		{"PATCH", "/tasks/1", `{"description": " "}`, "Description is required"},
+		{"PATCH", "/tasks/1", `{"assignee": ""}`, "Assignee is required"},
+		{"PATCH", "/tasks/1", `{"status": 1}`, "Status must be incomplete"},
+		{"POST", "/tasks/1/complete", ``, "Status must be incomplete"},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		if rr.Code != http.StatusBadRequest || body.Error != tt.want {
+			t.Errorf("%s %s %s returned %v %q, want 400 %q", tt.method, tt.path, tt.body, rr.Code, body.Error, tt.want)
+		}
+	}
+	if task := store.tasks["1"]; task.Description != "Set" || task.Assignee != "alice" || task.Status != StatusIncomplete {
+		t.Errorf("rejected requests changed the task: %+v", task)
+	}
+
+	req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "Short", "description": "d", "assignee": "a", "priority": 2}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("handler rejected a task that follows the rules: %v %s", rr.Code, rr.Body)
+	}
+}
+
+func TestLoadValidationRules(t *testing.T) {
+	if rules, err := loadValidationRules(""); err != nil || rules.RequireDescription || rules.AllowedStatuses != nil {
+		t.Errorf("loadValidationRules without a file returned %+v, %v", rules, err)
+	}
+
+	dir := t.TempDir()
+	write := func(content string) string {
+		path := filepath.Join(dir, "rules.json")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	rules, err := loadValidationRules(write(`{"max_name_length": 80, "require_due_date": true, "allowed_statuses": ["incomplete", 1]}`))
+	if err != nil {
+		t.Fatalf("loadValidationRules returned error: %v", err)
+	}
+	if rules.MaxNameLength != 80 || !rules.RequireDueDate || len(rules.AllowedStatuses) != 2 || rules.AllowedStatuses[1] != StatusCompleted {
+		t.Errorf("loadValidationRules returned wrong rules: %+v", rules)
+	}
+
+	for _, content := range []string{
+		`{"max_name_lenght": 80}`,
+		`{"max_name_length": 500}`,
+		`{"max_description_length": -1}`,
+		`{"allowed_statuses": [2]}`,
+		`{"allowed_priorities": [3]}`,
+		`[]`,
+	} {
+		if _, err := loadValidationRules(write(content)); err == nil || !strings.HasPrefix(err.Error(), "VALIDATION_RULES: ") {
+			t.Errorf("loadValidationRules(%s) returned %v, want a VALIDATION_RULES error", content, err)
+		}
+	}
+	if _, err := loadValidationRules(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("loadValidationRules accepted a missing file")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "github.com/microcosm-cc/bluemonday"
+
+// newSanitizer returns the policy task names and descriptions are sanitized
+// with when SANITIZE_HTML is on, or nil when it is off. It strips every tag,
+// dropping the contents of script and style elements, and escapes what is
+// left, so the text is safe to insert into a page as HTML.
+func newSanitizer(enabled bool) *bluemonday.Policy {
+	if !enabled {
+		return nil
+	}
+	return bluemonday.StrictPolicy()
+}
+
+// sanitize returns s with HTML removed, or s unchanged if sanitization is
+// off.
+func (h *Handlers) sanitize(s string) string {
+	if h.sanitizer == nil {
+		return s
+	}
+	return h.sanitizer.Sanitize(s)
+}
+
+// sanitizeTask removes HTML from the name and description of a task about to
+// be validated and stored.
+func (h *Handlers) sanitizeTask(task *Task) {
+	task.Name = h.sanitize(task.Name)
+	task.Description = h.sanitize(task.Description)
+}
+
+// sanitizePatch is sanitizeTask for the fields a patch sets.
+func (h *Handlers) sanitizePatch(patch *TaskPatch) {
+	if patch.Name != nil {
+		name := h.sanitize(*patch.Name)
+		patch.Name = &name
+	}
+	if patch.Description != nil {
+		description := h.sanitize(*patch.Description)
+		patch.Description = &description
+	}
+}
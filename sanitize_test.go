@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, ids: uuidGenerator{}, sanitizer: newSanitizer(true)}
+
+	tests := []struct {
+		body        string
+		name        string
+		description string
+	}{
+		{`{"name": "<script>alert(1)</script>Buy milk"}`, "Buy milk", ""},
+		{`{"name": "<img src=x onerror=alert(1)>Call <b>Bob</b>"}`, "Call Bob", ""},
+		{`{"name": "Plan", "description": "<a href=\"javascript:alert(1)\">Click</a> & go"}`, "Plan", "Click &amp; go"},
+		{`{"name": "<svg onload=alert(1)>Safe"}`, "Safe", ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		h.createTaskHandler(rr, req)
+		var task Task
+		if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		if task.Name != tt.name || task.Description != tt.description {
+			t.Errorf("handler stored %s as %q, %q; want %q, %q", tt.body, task.Name, task.Description, tt.name, tt.description)
+		}
+		if stored := store.tasks[task.ID]; stored.Name != tt.name {
+			t.Errorf("store holds unsanitized name %q", stored.Name)
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "<script>alert(1)</script>"}`))
+	rr := httptest.NewRecorder()
+	h.createTaskHandler(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for a name that is all markup: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	store.tasks["1"] = Task{ID: "1", Name: "Existing"}
+	req, _ = http.NewRequest("PATCH", "/tasks/1", strings.NewReader(`{"name": "<iframe src=evil></iframe>Renamed"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	rr = httptest.NewRecorder()
+	h.patchTaskHandler(rr, req)
+	if got := store.tasks["1"].Name; got != "Renamed" {
+		t.Errorf("patch stored name %q, want %q: %s", got, "Renamed", rr.Body)
+	}
+}
+
+func TestSanitizeHTMLOff(t *testing.T) {
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, ids: uuidGenerator{}}
+
+	req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "<b>Bold</b> & plain"}`))
+	rr := httptest.NewRecorder()
+	h.createTaskHandler(rr, req)
+	var task Task
+	if err := json.Unmarshal(rr.Body.Bytes(), &task); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if task.Name != "<b>Bold</b> & plain" {
+		t.Errorf("handler changed the name with sanitization off: got %q", task.Name)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Schemas that task payloads are checked against. They are the component
+// schemas of the embedded OpenAPI description, so the documented and the
+// enforced rules cannot drift apart.
+var (
+	taskSchema      = mustCompileSchema("Task")
+	taskPatchSchema = mustCompileSchema("TaskPatch")
+)
+
+// mustCompileSchema compiles the named component schema of openapi.json.
+func mustCompileSchema(name string) *jsonschema.Schema {
+	spec, err := openAPIFS.ReadFile("openapi.json")
+	if err != nil {
+		panic(err)
+	}
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("openapi.json", bytes.NewReader(spec)); err != nil {
+		panic(err)
+	}
+	return c.MustCompile("openapi.json#/components/schemas/" + name)
+}
+
+// schemaError reports the ways a payload breaks its schema.
+type schemaError struct {
+	subject    string // what was checked, e.g. "Task at index 2"
+	violations []string
+}
+
+func (e *schemaError) Error() string {
+	return e.subject + " does not match the schema"
+}
+
+// decodeValidated decodes data into v like decodeJSON does for a request body,
+// then checks data against schema. Violations are returned as a
+// *schemaError.
+func decodeValidated(data []byte, schema *jsonschema.Schema, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+
+	// The validator expects numbers as json.Number so it can tell 1 from 1.5.
+	var doc any
+	dec = json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	var validationErr *jsonschema.ValidationError
+	if err := schema.Validate(doc); errors.As(err, &validationErr) {
+		return &schemaError{subject: "Request body", violations: schemaViolations(validationErr)}
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// decodeValidatedBody is decodeValidated for the request body.
+func decodeValidatedBody(r *http.Request, schema *jsonschema.Schema, v any) error {
+	var data json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		return err
+	}
+	return decodeValidated(data, schema, v)
+}
+
+// schemaViolations flattens a validation error into one sorted message per
+// failed keyword, each prefixed with the JSON pointer of the offending value.
+func schemaViolations(err *jsonschema.ValidationError) []string {
+	if len(err.Causes) == 0 {
+		location := err.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []string{fmt.Sprintf("%s: %s", location, err.Message)}
+	}
+	var violations []string
+	for _, cause := range err.Causes {
+		violations = append(violations, schemaViolations(cause)...)
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+// respondSchemaError reports schema violations as a 400 listing each of them.
+func respondSchemaError(w http.ResponseWriter, err *schemaError) {
+	respondJSON(w, http.StatusBadRequest, map[string]any{
+		"error":      err.Error(),
+		"violations": err.violations,
+	})
+}
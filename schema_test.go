@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidation(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Existing", Version: 1}
+
+	tests := []struct {
+		method, path, body string
+		want               []string
+	}{
+		{"POST", "/tasks", `{"name": "Bad", "status": 3, "priority": 7}`, []string{
+			`/priority: value must be one of "0", "1", "2"`,
+			`/status: value must be one of "0", "1", "incomplete", "completed"`,
+		}},
+		{"POST", "/tasks", `{"description": "No name"}`, []string{"/: missing properties: 'name'"}},
+		{"PATCH", "/tasks/1", `{"name": ""}`, []string{"/name: length must be >= 1, but got 0"}},
+		{"POST", "/tasks/bulk", `[{"name": "Fine"}, {"name": "Bad", "tags": ["a", "a"]}]`, []string{
+			"/tags: items at index 0 and 1 are equal",
+		}},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", tt.method, tt.path, status, http.StatusBadRequest)
+			continue
+		}
+		var body struct {
+			Error      string   `json:"error"`
+			Violations []string `json:"violations"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		if body.Error == "" || !slices.Equal(body.Violations, tt.want) {
+			t.Errorf("%s %s returned wrong violations: got %q, %q want %q", tt.method, tt.path, body.Error, body.Violations, tt.want)
+		}
+	}
+}
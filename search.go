@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TaskSearch is the body of a search request. Every criterion is optional and
+// a task must satisfy all of the ones given.
+type TaskSearch struct {
+	Status          *Status    `json:"status"`
+	Tags            []string   `json:"tags"` // the task must carry every one
+	NameContains    string     `json:"name_contains"`
+	DueBefore       *time.Time `json:"due_before"`
+	DueAfter        *time.Time `json:"due_after"`
+	Assignee        string     `json:"assignee"`
+	IncludeDeleted  bool       `json:"include_deleted"`
+	IncludeArchived bool       `json:"include_archived"`
+	Sort            string     `json:"sort"`
+	Order           string     `json:"order"`
+	Limit           *int       `json:"limit"`
+	Offset          int        `json:"offset"`
+}
+
+// filter converts the search criteria into a taskFilter, returning an error
+// whose message is suitable for the response body if they are invalid or
+// contradict each other.
+func (s TaskSearch) filter() (taskFilter, error) {
+	filter := taskFilter{
+		status:          s.Status,
+		nameContains:    strings.ToLower(strings.TrimSpace(s.NameContains)),
+		tags:            normalizeTags(s.Tags),
+		assignee:        strings.TrimSpace(s.Assignee),
+		includeDeleted:  s.IncludeDeleted,
+		includeArchived: s.IncludeArchived,
+	}
+	if s.Status != nil && !s.Status.valid() {
+		return taskFilter{}, errInvalidStatus
+	}
+	if err := validateTags(filter.tags); err != nil {
+		return taskFilter{}, err
+	}
+	if s.DueBefore != nil {
+		filter.dueBefore = *s.DueBefore
+	}
+	if s.DueAfter != nil {
+		filter.dueAfter = *s.DueAfter
+	}
+	if s.DueBefore != nil && s.DueAfter != nil && !s.DueAfter.Before(*s.DueBefore) {
+		return taskFilter{}, errors.New("Due_after must be before due_before")
+	}
+	return filter, nil
+}
+
+// searchTasksHandler lists the tasks matching the criteria in the request
+// body. It returns the same page shape as the task list, for clients whose
+// filters do not fit comfortably in a query string.
+func (h *Handlers) searchTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var search TaskSearch
+	if err := decodeJSON(r, &search); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	filter, err := search.filter()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sortField, desc, err := parseSort(search.Sort, search.Order)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := defaultPageLimit
+	if search.Limit != nil {
+		limit = *search.Limit
+	}
+	if limit < 0 || search.Offset < 0 {
+		respondError(w, http.StatusBadRequest, "Limit and offset must be non-negative")
+		return
+	}
+	limit = min(limit, maxPageLimit)
+
+	tasks, err := h.filteredTasks(r.Context(), filter)
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	sortTasks(tasks, sortField, desc)
+	respondJSON(w, http.StatusOK, TaskList{Tasks: paginate(tasks, limit, search.Offset), Total: len(tasks)})
+}
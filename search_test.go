@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchTasksHandler(t *testing.T) {
+	router, store := setupRouter()
+
+	soon := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	later := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	store.tasks["1"] = Task{ID: "1", Name: "Write report", Tags: []string{"work", "urgent"}, DueDate: &soon, Assignee: "alice"}
+	store.tasks["2"] = Task{ID: "2", Name: "Review report", Tags: []string{"work"}, DueDate: &later, Assignee: "alice"}
+	store.tasks["3"] = Task{ID: "3", Name: "Buy milk", Tags: []string{"home", "urgent"}, Status: 1}
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"everything", `{}`, []string{"3", "2", "1"}},
+		{"all tags", `{"tags": ["Work", "urgent"]}`, []string{"1"}},
+		{"name", `{"name_contains": "REPORT", "sort": "name", "order": "desc"}`, []string{"1", "2"}},
+		{"due range", `{"due_after": "2024-04-01T00:00:00Z", "due_before": "2024-05-15T00:00:00Z"}`, []string{"1"}},
+		{"status and assignee", `{"status": 0, "assignee": "ALICE"}`, []string{"2", "1"}},
+		{"page", `{"limit": 1, "offset": 1}`, []string{"2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/tasks/search", strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+			}
+			var list TaskList
+			if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+				t.Fatalf("Could not parse response body: %v", err)
+			}
+			var got []string
+			for _, task := range list.Tasks {
+				got = append(got, task.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("handler returned wrong tasks: got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchTasksHandlerInvalid(t *testing.T) {
+	router, _ := setupRouter()
+
+	for _, body := range []string{
+		`{"status": 2}`,
+		`{"due_after": "2024-06-01T00:00:00Z", "due_before": "2024-05-01T00:00:00Z"}`,
+		`{"tags": [" "]}`,
+		`{"limit": -1}`,
+		`{"sort": "color"}`,
+		`{"due_before": "tomorrow"}`,
+		`{"color": "red"}`,
+	} {
+		req, _ := http.NewRequest("POST", "/tasks/search", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", body, status, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+)
+
+// seedStore seeds h's store from path, logging how many tasks it stored.
+func (h *Handlers) seedStore(path string) error {
+	n, err := h.seed(context.Background(), path)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		h.logger.Info("Seeded store", "path", path, "tasks", n)
+	}
+	return nil
+}
+
+// seed fills an empty store with the tasks in the JSON array at path, for
+// demos and test environments, returning how many it stored. A store that
+// already has tasks, such as a persistent one seeded on an earlier start, is
+// left alone. Each task goes through createTaskHandler, so it is validated
+// and completed exactly as if a client had created it, and may name an
+// earlier task of the file as its parent or dependency. The tasks are created
+// against a copy of the store first, and only stored, all together, once
+// every one has succeeded.
+func (h *Handlers) seed(ctx context.Context, path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return 0, fmt.Errorf("%s: must hold a JSON array of tasks: %w", path, err)
+	}
+	existing, err := h.store.GetAll(ctx)
+	if err != nil || len(existing) > 0 {
+		return 0, err
+	}
+
+	scratch, _ := NewMemoryStore("")
+	tx := *h
+	tx.store = scratch
+	tx.events = nil
+	tx.activity = nil
+	tasks := make([]Task, len(items))
+	for i, item := range items {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/tasks", bytes.NewReader(item))
+		if err != nil {
+			return 0, err
+		}
+		rr := httptest.NewRecorder()
+		tx.createTaskHandler(rr, req)
+		if rr.Code != http.StatusCreated {
+			var body struct {
+				Error      string   `json:"error"`
+				Violations []string `json:"violations"`
+			}
+			_ = json.Unmarshal(rr.Body.Bytes(), &body)
+			if len(body.Violations) > 0 {
+				body.Error += ": " + strings.Join(body.Violations, "; ")
+			}
+			return 0, fmt.Errorf("%s: task at index %d: %s", path, i, body.Error)
+		}
+		var created struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+			return 0, err
+		}
+		tasks[i] = scratch.tasks[created.ID]
+	}
+
+	if err := h.store.Create(ctx, tasks...); err != nil {
+		return 0, err
+	}
+	h.publish(eventCreated, tasks...)
+	return len(tasks), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSeedFile writes content to a seed file in a temporary directory.
+func writeSeedFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "seed.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	store, _ := NewMemoryStore("")
+	h := &Handlers{store: store, ids: uuidGenerator{}, activity: newActivityLog(10)}
+	path := writeSeedFile(t, `[
+		{"id": "5b0e3f4c-54e4-4a8e-9c44-0c2d1f7a9d10", "name": " Plan the demo ", "tags": ["Demo"]},
+		{"name": "Book a room", "parent_id": "5b0e3f4c-54e4-4a8e-9c44-0c2d1f7a9d10", "priority": 2}
+	]`)
+
+	n, err := h.seed(ctx, path)
+	if err != nil || n != 2 {
+		t.Fatalf("seed returned %d, %v; want 2 tasks", n, err)
+	}
+	parent, err := store.Get(ctx, "5b0e3f4c-54e4-4a8e-9c44-0c2d1f7a9d10")
+	if err != nil || parent.Name != "Plan the demo" || parent.Tags[0] != "demo" || parent.Version != 1 {
+		t.Errorf("seed stored wrong task: %+v, %v", parent, err)
+	}
+	all, _ := store.GetAll(ctx)
+	for _, task := range all {
+		if task.ID != parent.ID && (task.ParentID == nil || *task.ParentID != parent.ID || task.Position <= parent.Position) {
+			t.Errorf("seed stored wrong subtask: %+v", task)
+		}
+	}
+	if got := len(h.activity.recent()); got != 2 {
+		t.Errorf("seed recorded %d activity entries, want 2", got)
+	}
+
+	if n, err := h.seed(ctx, path); err != nil || n != 0 {
+		t.Errorf("seeding a store with tasks returned %d, %v; want it skipped", n, err)
+	}
+}
+
+func TestSeedErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{`{"name": "Not a list"}`, "JSON array"},
+		{`[{"name": "Fine"}, {"name": "   "}]`, "task at index 1: Name is required"},
+		{`[{"name": "Fine"}, {"name": "Bad", "priority": 9}]`, "task at index 1: Request body does not match the schema: /priority"},
+		{`[{"name": "Orphan", "parent_id": "missing"}]`, "task at index 0: Parent task not found"},
+	}
+	for _, tt := range tests {
+		store, _ := NewMemoryStore("")
+		h := &Handlers{store: store, ids: uuidGenerator{}}
+		_, err := h.seed(context.Background(), writeSeedFile(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("seed of %s returned %v, want an error containing %q", tt.content, err, tt.want)
+		}
+		if len(store.tasks) != 0 {
+			t.Errorf("failed seed stored tasks: %+v", store.tasks)
+		}
+	}
+}
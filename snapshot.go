@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Snapshot is a point-in-time copy of every stored task, including those in
+// the trash or archived, and of the projects they are in and the comments on
+// them, for backups.
+type Snapshot struct {
+	TakenAt  time.Time `json:"taken_at"`
+	Tasks    []Task    `json:"tasks"`
+	Projects []Project `json:"projects"`
+	Comments []Comment `json:"comments"`
+}
+
+// getSnapshotHandler returns every stored task, project and comment as a single
+// document that restoreSnapshotHandler accepts. They are read in one store
+// call, so the snapshot is consistent and can always be restored.
+func (h *Handlers) getSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := h.store.Snapshot(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	snapshot.TakenAt = time.Now().UTC()
+	sort.Slice(snapshot.Tasks, func(i, j int) bool { return snapshot.Tasks[i].ID < snapshot.Tasks[j].ID })
+	sort.Slice(snapshot.Projects, func(i, j int) bool { return snapshot.Projects[i].ID < snapshot.Projects[j].ID })
+	sort.SliceStable(snapshot.Comments, func(i, j int) bool {
+		a, b := snapshot.Comments[i], snapshot.Comments[j]
+		if a.TaskID != b.TaskID {
+			return a.TaskID < b.TaskID
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	respondJSON(w, http.StatusOK, snapshot)
+}
+
+// restoreSnapshotHandler replaces every stored task and project with the ones
+// in a snapshot. Like deleting every task, it requires confirm=true. The tasks
+// and projects are stored as they are, server-managed fields included, so
+// restoring a snapshot brings back exactly what was backed up. A task may
+// only be in a project of the snapshot.
+func (h *Handlers) restoreSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("confirm") != "true" {
+		respondError(w, http.StatusBadRequest, "Restoring a snapshot requires confirm=true")
+		return
+	}
+
+	var snapshot Snapshot
+	if err := decodeJSON(r, &snapshot); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	if h.maxTasks != 0 && len(snapshot.Tasks) > h.maxTasks {
+		respondError(w, http.StatusInsufficientStorage, h.capacityMessage())
+		return
+	}
+	projects := make(map[string]bool, len(snapshot.Projects))
+	for i, project := range snapshot.Projects {
+		if project.ID == "" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Project at index %d: ID is required", i))
+			return
+		}
+		if projects[project.ID] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Project at index %d: duplicate ID %s", i, project.ID))
+			return
+		}
+		projects[project.ID] = true
+		if strings.TrimSpace(project.Name) == "" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Project at index %d: Name is required", i))
+			return
+		}
+	}
+	seen := make(map[string]bool, len(snapshot.Tasks))
+	for i, task := range snapshot.Tasks {
+		if task.ID == "" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Task at index %d: ID is required", i))
+			return
+		}
+		if seen[task.ID] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Task at index %d: duplicate ID %s", i, task.ID))
+			return
+		}
+		seen[task.ID] = true
+		if err := validateTask(task); err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Task at index %d: %v", i, err))
+			return
+		}
+		if task.ProjectID != "" && !projects[task.ProjectID] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Task at index %d: project %s is not in the snapshot", i, task.ProjectID))
+			return
+		}
+	}
+	comments := make(map[string]bool, len(snapshot.Comments))
+	for i, comment := range snapshot.Comments {
+		if comment.ID == "" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Comment at index %d: ID is required", i))
+			return
+		}
+		if comments[comment.ID] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Comment at index %d: duplicate ID %s", i, comment.ID))
+			return
+		}
+		comments[comment.ID] = true
+		if !seen[comment.TaskID] {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Comment at index %d: task %s is not in the snapshot", i, comment.TaskID))
+			return
+		}
+	}
+
+	previous, err := h.store.GetAll(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	if err := h.store.Replace(r.Context(), snapshot); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventDeleted, previous...)
+	h.publish(eventCreated, snapshot.Tasks...)
+	respondJSON(w, http.StatusOK, map[string]int{"restored": len(snapshot.Tasks)})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	router, store := setupRouter()
+
+	deleted := time.Now().UTC().Truncate(time.Second)
+	store.tasks["1"] = Task{ID: "1", Name: "Open", Version: 3}
+	store.tasks["2"] = Task{ID: "2", Name: "Trashed", DeletedAt: &deleted, Version: 2}
+	store.tasks["3"] = Task{ID: "3", Name: "Archived", Archived: true, ProjectID: "p1", Version: 1}
+	store.projects["p1"] = Project{ID: "p1", Name: "Release", CreatedAt: deleted}
+	store.comments["2"] = []Comment{{ID: "c1", TaskID: "2", Body: "Why was this trashed?", CreatedAt: deleted}}
+
+	req, _ := http.NewRequest("GET", "/tasks/snapshot", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	snapshot := rr.Body.String()
+	var decoded Snapshot
+	if err := json.Unmarshal([]byte(snapshot), &decoded); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if len(decoded.Tasks) != 3 || decoded.Tasks[0].ID != "1" || len(decoded.Projects) != 1 || len(decoded.Comments) != 1 || decoded.TakenAt.IsZero() {
+		t.Fatalf("snapshot is incomplete: got %+v", decoded)
+	}
+
+	// Restoring brings back exactly what was backed up
+	delete(store.tasks, "1")
+	store.tasks["4"] = Task{ID: "4", Name: "Created after the snapshot"}
+	delete(store.projects, "p1")
+	store.projects["p2"] = Project{ID: "p2", Name: "Created after the snapshot"}
+	delete(store.comments, "2")
+	store.comments["4"] = []Comment{{ID: "c2", TaskID: "4", Body: "Created after the snapshot"}}
+
+	req, _ = http.NewRequest("POST", "/tasks/restore", strings.NewReader(snapshot))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("restore without confirm returned wrong status code: got %v want %v", status, http.StatusBadRequest)
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks/restore?confirm=true", strings.NewReader(snapshot))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"restored":3}` {
+		t.Fatalf("handler returned unexpected body: got %v", body)
+	}
+	if len(store.tasks) != 3 || store.tasks["1"].Version != 3 || store.tasks["2"].DeletedAt == nil || !store.tasks["3"].Archived {
+		t.Errorf("restore did not bring back the snapshot: got %+v", store.tasks)
+	}
+	if len(store.projects) != 1 || !store.projects["p1"].CreatedAt.Equal(deleted) || store.tasks["3"].ProjectID != "p1" {
+		t.Errorf("restore did not bring back the projects: got %+v", store.projects)
+	}
+	if len(store.comments) != 1 || len(store.comments["2"]) != 1 || store.comments["2"][0].ID != "c1" {
+		t.Errorf("restore did not bring back the comments: got %+v", store.comments)
+	}
+}
+
+func TestRestoreSnapshotInvalid(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Keep me"}
+
+	for _, body := range []string{
+		`{"tasks": [{"name": "No ID"}]}`,
+		`{"tasks": [{"id": "a", "name": "One"}, {"id": "a", "name": "Two"}]}`,
+		`{"tasks": [{"id": "a", "name": ""}]}`,
+		`{"tasks": "none"}`,
+		`{"tasks": [{"id": "a", "name": "One", "project_id": "p1"}]}`,
+		`{"tasks": [], "projects": [{"name": "No ID"}]}`,
+		`{"tasks": [], "projects": [{"id": "p1", "name": "One"}, {"id": "p1", "name": "Two"}]}`,
+		`{"tasks": [], "projects": [{"id": "p1", "name": " "}]}`,
+		`{"tasks": [{"id": "a", "name": "One"}], "comments": [{"task_id": "a", "body": "No ID"}]}`,
+		`{"tasks": [{"id": "a", "name": "One"}], "comments": [{"id": "c1", "task_id": "a", "body": "One"}, {"id": "c1", "task_id": "a", "body": "Two"}]}`,
+		`{"tasks": [{"id": "a", "name": "One"}], "comments": [{"id": "c1", "task_id": "b", "body": "Orphan"}]}`,
+	} {
+		req, _ := http.NewRequest("POST", "/tasks/restore?confirm=true", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("handler returned wrong status code for %s: got %v want %v", body, status, http.StatusBadRequest)
+		}
+	}
+	if _, ok := store.tasks["1"]; !ok || len(store.tasks) != 1 {
+		t.Errorf("invalid restore changed the store: got %+v", store.tasks)
+	}
+}
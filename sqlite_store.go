@@ -0,0 +1,915 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMigrations are applied in order when a SQLiteStore is opened. Append
+// new statements rather than editing existing ones so databases created by
+// earlier versions upgrade cleanly.
+var sqliteMigrations = []string{
+	`CREATE TABLE tasks (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		description TEXT NOT NULL,
+		status      INTEGER NOT NULL,
+		priority    INTEGER NOT NULL,
+		due_date    TIMESTAMP,
+		created_at  TIMESTAMP NOT NULL,
+		updated_at  TIMESTAMP NOT NULL
+	)`,
+	`ALTER TABLE tasks ADD COLUMN deleted_at TIMESTAMP`,
+	`ALTER TABLE tasks ADD COLUMN tags TEXT NOT NULL DEFAULT '[]'`,
+	`ALTER TABLE tasks ADD COLUMN version INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE tasks ADD COLUMN parent_id TEXT`,
+	`ALTER TABLE tasks ADD COLUMN assignee TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE tasks ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE tasks ADD COLUMN position REAL NOT NULL DEFAULT 0`,
+	`CREATE TABLE comments (
+		id         TEXT PRIMARY KEY,
+		task_id    TEXT NOT NULL,
+		author     TEXT NOT NULL,
+		body       TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX comments_task_id ON comments (task_id)`,
+	`ALTER TABLE tasks ADD COLUMN remind_at TIMESTAMP`,
+	`ALTER TABLE tasks ADD COLUMN reminded_at TIMESTAMP`,
+	`ALTER TABLE tasks ADD COLUMN expires_at TIMESTAMP`,
+	`ALTER TABLE tasks ADD COLUMN depends_on TEXT NOT NULL DEFAULT '[]'`,
+	`CREATE TABLE templates (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		tasks      TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`ALTER TABLE tasks ADD COLUMN project_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE projects (
+		id          TEXT PRIMARY KEY,
+		name        TEXT NOT NULL,
+		description TEXT NOT NULL,
+		created_at  TIMESTAMP NOT NULL
+	)`,
+}
+
+// taskColumns lists the tasks table columns in the order scanTask reads them
+// and taskArgs writes them. The ID must come first.
+var taskColumns = []string{
+	"id", "name", "description", "status", "priority", "due_date", "created_at", "updated_at", "deleted_at", "tags", "version", "parent_id", "assignee", "archived", "recurrence", "position", "remind_at", "reminded_at", "expires_at", "depends_on", "project_id",
+}
+
+// Statements built from taskColumns.
+var (
+	selectTasksSQL = "SELECT " + strings.Join(taskColumns, ", ") + " FROM tasks"
+	insertTaskSQL  = "INSERT INTO tasks (" + strings.Join(taskColumns, ", ") + ") VALUES (" + placeholders(len(taskColumns)) + ")"
+	updateTaskSQL  = "UPDATE tasks SET " + strings.Join(taskColumns[1:], " = ?, ") + " = ? WHERE id = ?"
+	// updateTaskVersionSQL only updates the task if it is at a given version.
+	updateTaskVersionSQL = updateTaskSQL + " AND version = ?"
+)
+
+// commentColumns lists the comments table columns in the order
+// queryComments reads them and commentArgs writes them.
+var commentColumns = []string{"id", "task_id", "author", "body", "created_at"}
+
+// Statements built from commentColumns.
+var (
+	selectCommentsSQL = "SELECT " + strings.Join(commentColumns, ", ") + " FROM comments"
+	insertCommentSQL  = "INSERT INTO comments (" + strings.Join(commentColumns, ", ") + ") VALUES (" + placeholders(len(commentColumns)) + ")"
+)
+
+// templateColumns lists the templates table columns in the order scanTemplate
+// reads them and templateArgs writes them.
+var templateColumns = []string{"id", "name", "tasks", "created_at"}
+
+// Statements built from templateColumns.
+var (
+	selectTemplatesSQL = "SELECT " + strings.Join(templateColumns, ", ") + " FROM templates"
+	insertTemplateSQL  = "INSERT INTO templates (" + strings.Join(templateColumns, ", ") + ") VALUES (" + placeholders(len(templateColumns)) + ")"
+)
+
+// projectColumns lists the projects table columns in the order scanProject
+// reads them and projectArgs writes them.
+var projectColumns = []string{"id", "name", "description", "created_at"}
+
+// Statements built from projectColumns.
+var (
+	selectProjectsSQL = "SELECT " + strings.Join(projectColumns, ", ") + " FROM projects"
+	insertProjectSQL  = "INSERT INTO projects (" + strings.Join(projectColumns, ", ") + ") VALUES (" + placeholders(len(projectColumns)) + ")"
+	updateProjectSQL  = "UPDATE projects SET " + strings.Join(projectColumns[1:], " = ?, ") + " = ? WHERE id = ?"
+)
+
+// SQLiteStore is a Store backed by a SQLite database.
+type SQLiteStore struct {
+	db       *sql.DB
+	maxTasks int // 0 means unlimited
+}
+
+// NewSQLiteStore opens the SQLite database at path, creating it if needed, and
+// brings its schema up to date.
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, and each connection to ":memory:" is a
+	// separate database, so serialize everything through one connection.
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db, sqliteMigrations, sqliteBind); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating database: %w", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) GetAll(ctx context.Context) ([]Task, error) {
+	return queryTasks(ctx, s.db, selectTasksSQL)
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, id string) (Task, error) {
+	return getTask(ctx, s.db, id)
+}
+
+func (s *SQLiteStore) Snapshot(ctx context.Context) (Snapshot, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return Snapshot{}, err
+	}
+	defer tx.Rollback()
+
+	return readSnapshot(ctx, tx)
+}
+
+func (s *SQLiteStore) Count(ctx context.Context) (int, error) {
+	return countTasks(ctx, s.db)
+}
+
+func (s *SQLiteStore) SetMaxTasks(n int) {
+	s.maxTasks = n
+}
+
+func (s *SQLiteStore) Create(ctx context.Context, tasks ...Task) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkTaskLimit(ctx, tx, s.maxTasks, len(tasks)); err != nil {
+		return err
+	}
+	if err := checkProjects(ctx, tx, selectProjectsSQL+" WHERE id = ?", tasks...); err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if _, err := getTask(ctx, tx, task.ID); err == nil {
+			return ErrExists
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, insertTaskSQL, taskArgs(task)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Update(ctx context.Context, id string, fn func(*Task) error) (Task, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Task{}, err
+	}
+	defer tx.Rollback()
+
+	task, err := getTask(ctx, tx, id)
+	if err != nil {
+		return Task{}, err
+	}
+	project := task.ProjectID
+	if err := fn(&task); err != nil {
+		return Task{}, err
+	}
+	if task.ProjectID != project {
+		if err := checkProjects(ctx, tx, selectProjectsSQL+" WHERE id = ?", task); err != nil {
+			return Task{}, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, updateTaskSQL, append(taskArgs(task)[1:], id)...); err != nil {
+		return Task{}, err
+	}
+	return task, tx.Commit()
+}
+
+func (s *SQLiteStore) UpdateMatching(ctx context.Context, match func(Task) bool, fn func(*Task) error) ([]Task, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, selectTasksSQL)
+	if err != nil {
+		return nil, err
+	}
+	updated, moved := []Task{}, []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if !match(task) {
+			continue
+		}
+		project := task.ProjectID
+		if err := fn(&task); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		updated = append(updated, task)
+		if task.ProjectID != project {
+			moved = append(moved, task)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkProjects(ctx, tx, selectProjectsSQL+" WHERE id = ?", moved...); err != nil {
+		return nil, err
+	}
+
+	for _, task := range updated {
+		if _, err := tx.ExecContext(ctx, updateTaskSQL, append(taskArgs(task)[1:], task.ID)...); err != nil {
+			return nil, err
+		}
+	}
+	return updated, tx.Commit()
+}
+
+func (s *SQLiteStore) Commit(ctx context.Context, changes []TaskChange) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkTaskLimit(ctx, tx, s.maxTasks, createdTasks(changes)); err != nil {
+		return err
+	}
+	if err := checkProjects(ctx, tx, selectProjectsSQL+" WHERE id = ?", changedTasks(changes)...); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if err := commitChange(ctx, tx, change, getTask, insertTaskSQL, updateTaskVersionSQL); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// createdTasks returns how many of changes create a task.
+func createdTasks(changes []TaskChange) int {
+	n := 0
+	for _, change := range changes {
+		if change.Version == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// changedTasks returns the tasks changes store.
+func changedTasks(changes []TaskChange) []Task {
+	tasks := make([]Task, len(changes))
+	for i, change := range changes {
+		tasks[i] = change.Task
+	}
+	return tasks
+}
+
+// checkProjects returns ErrNoProject if any of tasks is in a project that
+// query, which selects a project by ID, does not find in tx.
+func checkProjects(ctx context.Context, tx *sql.Tx, query string, tasks ...Task) error {
+	checked := make(map[string]bool)
+	for _, task := range tasks {
+		if task.ProjectID == "" || checked[task.ProjectID] {
+			continue
+		}
+		if _, err := getProject(ctx, tx, query, task.ProjectID); errors.Is(err, ErrNotFound) {
+			return ErrNoProject
+		} else if err != nil {
+			return err
+		}
+		checked[task.ProjectID] = true
+	}
+	return nil
+}
+
+// checkTaskLimit returns ErrTaskLimit if storing n more tasks in tx would
+// take the store past maxTasks, which is 0 when there is no limit.
+func checkTaskLimit(ctx context.Context, tx *sql.Tx, maxTasks, n int) error {
+	if maxTasks == 0 || n == 0 {
+		return nil
+	}
+	count, err := countTasks(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if count+n > maxTasks {
+		return ErrTaskLimit
+	}
+	return nil
+}
+
+// countTasks returns the number of rows in the tasks table.
+func countTasks(ctx context.Context, q queryer) (int, error) {
+	var n int
+	err := q.QueryRowContext(ctx, "SELECT COUNT(*) FROM tasks").Scan(&n)
+	return n, err
+}
+
+// commitChange applies one change of a Commit in tx, with get and the
+// statements written for the database in use.
+func commitChange(ctx context.Context, tx *sql.Tx, change TaskChange, get func(context.Context, queryer, string) (Task, error), insertSQL, updateSQL string) error {
+	if change.Version == 0 {
+		if _, err := get(ctx, tx, change.Task.ID); err == nil {
+			return ErrExists
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, insertSQL, taskArgs(change.Task)...)
+		return err
+	}
+	res, err := tx.ExecContext(ctx, updateSQL, append(taskArgs(change.Task)[1:], change.Task.ID, change.Version)...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStale
+	}
+	return nil
+}
+
+// SQLite only enforces foreign keys when asked to on every connection, so
+// rather than relying on ON DELETE CASCADE, the methods that remove tasks
+// delete their comments themselves.
+
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE task_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteMatching(ctx context.Context, match func(Task) bool) ([]Task, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, selectTasksSQL)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if match(task) {
+			deleted = append(deleted, task)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, task := range deleted {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE task_id = ?", task.ID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ?", task.ID); err != nil {
+			return nil, err
+		}
+	}
+	return deleted, tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteAll(ctx context.Context) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM comments"); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM tasks"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Replace(ctx context.Context, snapshot Snapshot) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"comments", "tasks", "projects"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return err
+		}
+	}
+	for _, project := range snapshot.Projects {
+		if _, err := tx.ExecContext(ctx, insertProjectSQL, projectArgs(project)...); err != nil {
+			return err
+		}
+	}
+	for _, task := range snapshot.Tasks {
+		if _, err := tx.ExecContext(ctx, insertTaskSQL, taskArgs(task)...); err != nil {
+			return err
+		}
+	}
+	for _, comment := range snapshot.Comments {
+		if _, err := tx.ExecContext(ctx, insertCommentSQL, commentArgs(comment)...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Comments(ctx context.Context, taskID string) ([]Comment, error) {
+	return queryComments(ctx, s.db, selectCommentsSQL+" WHERE task_id = ?", taskID)
+}
+
+func (s *SQLiteStore) AddComment(ctx context.Context, comment Comment) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := getTask(ctx, tx, comment.TaskID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, insertCommentSQL, commentArgs(comment)...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Templates(ctx context.Context) ([]Template, error) {
+	return queryTemplates(ctx, s.db, selectTemplatesSQL)
+}
+
+func (s *SQLiteStore) Template(ctx context.Context, id string) (Template, error) {
+	return getTemplate(ctx, s.db, selectTemplatesSQL+" WHERE id = ?", id)
+}
+
+func (s *SQLiteStore) AddTemplate(ctx context.Context, template Template) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := getTemplate(ctx, tx, selectTemplatesSQL+" WHERE id = ?", template.ID); err == nil {
+		return ErrExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, insertTemplateSQL, templateArgs(template)...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) Projects(ctx context.Context) ([]Project, error) {
+	return queryProjects(ctx, s.db, selectProjectsSQL)
+}
+
+func (s *SQLiteStore) Project(ctx context.Context, id string) (Project, error) {
+	return getProject(ctx, s.db, selectProjectsSQL+" WHERE id = ?", id)
+}
+
+func (s *SQLiteStore) AddProject(ctx context.Context, project Project) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := getProject(ctx, tx, selectProjectsSQL+" WHERE id = ?", project.ID); err == nil {
+		return ErrExists
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, insertProjectSQL, projectArgs(project)...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) UpdateProject(ctx context.Context, id string, fn func(*Project) error) (Project, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Project{}, err
+	}
+	defer tx.Rollback()
+
+	project, err := getProject(ctx, tx, selectProjectsSQL+" WHERE id = ?", id)
+	if err != nil {
+		return Project{}, err
+	}
+	if err := fn(&project); err != nil {
+		return Project{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, updateProjectSQL, append(projectArgs(project)[1:], id)...); err != nil {
+		return Project{}, err
+	}
+	return project, tx.Commit()
+}
+
+func (s *SQLiteStore) DeleteProject(ctx context.Context, id string, cascade bool) ([]Task, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := getProject(ctx, tx, selectProjectsSQL+" WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, selectTasksSQL)
+	if err != nil {
+		return nil, err
+	}
+	deleted, outside := []Task{}, []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if task.ProjectID == id {
+			deleted = append(deleted, task)
+		} else {
+			outside = append(outside, task)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(deleted) > 0 && !cascade {
+		return nil, ErrProjectNotEmpty
+	}
+	if refersTo(outside, deleted) {
+		return nil, ErrProjectReferenced
+	}
+
+	for _, task := range deleted {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM comments WHERE task_id = ?", task.ID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM tasks WHERE id = ?", task.ID); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM projects WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return deleted, tx.Commit()
+}
+
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// migrate applies any of migrations not yet recorded in the schema_migrations
+// table, each in its own transaction. bind rewrites the "?" placeholders used
+// here into the driver's syntax.
+func migrate(db *sql.DB, migrations []string, bind func(string) string) error {
+	if _, err := db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)"); err != nil {
+		return err
+	}
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		if _, err := tx.Exec(bind("INSERT INTO schema_migrations (version) VALUES (?)"), version+1); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// queryTasks runs a query selecting taskColumns and reads every row.
+func queryTasks(ctx context.Context, q queryer, query string, args ...any) ([]Task, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// readSnapshot reads every task, project and comment in tx, which gives them
+// a consistent view of the database.
+func readSnapshot(ctx context.Context, tx *sql.Tx) (Snapshot, error) {
+	tasks, err := queryTasks(ctx, tx, selectTasksSQL)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	projects, err := queryProjects(ctx, tx, selectProjectsSQL)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	comments, err := queryComments(ctx, tx, selectCommentsSQL)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{Tasks: tasks, Projects: projects, Comments: comments}, nil
+}
+
+// getTask loads a single task by ID, returning ErrNotFound if there is none.
+func getTask(ctx context.Context, q queryer, id string) (Task, error) {
+	task, err := scanTask(q.QueryRowContext(ctx, selectTasksSQL+" WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Task{}, ErrNotFound
+	}
+	return task, err
+}
+
+// scanTask reads a row selected with taskColumns.
+func scanTask(row interface{ Scan(...any) error }) (Task, error) {
+	var task Task
+	var dueDate, deletedAt, remindAt, remindedAt, expiresAt sql.NullTime
+	var tags, dependsOn string
+	var parentID sql.NullString
+	err := row.Scan(&task.ID, &task.Name, &task.Description, &task.Status, &task.Priority,
+		&dueDate, &task.CreatedAt, &task.UpdatedAt, &deletedAt, &tags, &task.Version, &parentID, &task.Assignee, &task.Archived, &task.Recurrence, &task.Position, &remindAt, &remindedAt, &expiresAt, &dependsOn, &task.ProjectID)
+	if err != nil {
+		return Task{}, err
+	}
+	task.DueDate = timePtr(dueDate)
+	task.DeletedAt = timePtr(deletedAt)
+	task.RemindAt = timePtr(remindAt)
+	task.RemindedAt = timePtr(remindedAt)
+	task.ExpiresAt = timePtr(expiresAt)
+	task.ParentID = stringPtr(parentID)
+	if err := json.Unmarshal([]byte(tags), &task.Tags); err != nil {
+		return Task{}, fmt.Errorf("decoding tags of task %s: %w", task.ID, err)
+	}
+	if err := json.Unmarshal([]byte(dependsOn), &task.DependsOn); err != nil {
+		return Task{}, fmt.Errorf("decoding dependencies of task %s: %w", task.ID, err)
+	}
+	return task, nil
+}
+
+// taskArgs returns the task's values in taskColumns order.
+func taskArgs(task Task) []any {
+	return []any{task.ID, task.Name, task.Description, int(task.Status), task.Priority,
+		nullTime(task.DueDate), task.CreatedAt, task.UpdatedAt, nullTime(task.DeletedAt),
+		jsonText(task.Tags), task.Version, nullString(task.ParentID), task.Assignee, task.Archived, task.Recurrence, task.Position,
+		nullTime(task.RemindAt), nullTime(task.RemindedAt), nullTime(task.ExpiresAt), jsonText(task.DependsOn), task.ProjectID}
+}
+
+// queryComments runs a query selecting commentColumns and reads every row.
+func queryComments(ctx context.Context, q queryer, query string, args ...any) ([]Comment, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(&comment.ID, &comment.TaskID, &comment.Author, &comment.Body, &comment.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// commentArgs returns the comment's values in commentColumns order.
+func commentArgs(comment Comment) []any {
+	return []any{comment.ID, comment.TaskID, comment.Author, comment.Body, comment.CreatedAt}
+}
+
+// queryTemplates runs a query selecting templateColumns and reads every row.
+func queryTemplates(ctx context.Context, db *sql.DB, query string, args ...any) ([]Template, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []Template{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+	return templates, rows.Err()
+}
+
+// getTemplate runs a query selecting templateColumns of at most one template,
+// returning ErrNotFound if there is none.
+func getTemplate(ctx context.Context, q queryer, query string, args ...any) (Template, error) {
+	template, err := scanTemplate(q.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Template{}, ErrNotFound
+	}
+	return template, err
+}
+
+// scanTemplate reads one row of templateColumns.
+func scanTemplate(row interface{ Scan(...any) error }) (Template, error) {
+	var template Template
+	var tasks string
+	if err := row.Scan(&template.ID, &template.Name, &tasks, &template.CreatedAt); err != nil {
+		return Template{}, err
+	}
+	if err := json.Unmarshal([]byte(tasks), &template.Tasks); err != nil {
+		return Template{}, fmt.Errorf("decoding tasks of template %s: %w", template.ID, err)
+	}
+	return template, nil
+}
+
+// templateArgs returns the template's values in templateColumns order.
+func templateArgs(template Template) []any {
+	tasks, _ := json.Marshal(template.Tasks)
+	return []any{template.ID, template.Name, string(tasks), template.CreatedAt}
+}
+
+// jsonText encodes a string list for storage in a TEXT column. A nil list is
+// stored as an empty array.
+func jsonText(list []string) string {
+	if list == nil {
+		return "[]"
+	}
+	data, _ := json.Marshal(list)
+	return string(data)
+}
+
+// nullTime converts an optional time to its SQL representation.
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// timePtr converts a nullable SQL time to an optional time.
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// nullString converts an optional string to its SQL representation.
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+// stringPtr converts a nullable SQL string to an optional string.
+func stringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// sqliteBind returns query unchanged, as SQLite understands "?" placeholders.
+func sqliteBind(query string) string {
+	return query
+}
+
+// placeholders returns n comma-separated bind parameters.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// queryProjects runs a query selecting projectColumns and reads every row.
+func queryProjects(ctx context.Context, q queryer, query string, args ...any) ([]Project, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []Project{}
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, project)
+	}
+	return projects, rows.Err()
+}
+
+// getProject runs a query selecting projectColumns of at most one project,
+// returning ErrNotFound if there is none.
+func getProject(ctx context.Context, q queryer, query string, args ...any) (Project, error) {
+	project, err := scanProject(q.QueryRowContext(ctx, query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Project{}, ErrNotFound
+	}
+	return project, err
+}
+
+// scanProject reads one row of projectColumns.
+func scanProject(row interface{ Scan(...any) error }) (Project, error) {
+	var project Project
+	err := row.Scan(&project.ID, &project.Name, &project.Description, &project.CreatedAt)
+	return project, err
+}
+
+// projectArgs returns the project's values in projectColumns order.
+func projectArgs(project Project) []any {
+	return []any{project.ID, project.Name, project.Description, project.CreatedAt}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// Status records whether a task is done. It is stored as 0 or 1, and clients
+// may write it either that way or by name.
+type Status int
+
+const (
+	StatusIncomplete Status = 0
+	StatusCompleted  Status = 1
+)
+
+// statusNames are the names of the statuses, as accepted in requests and, with
+// STATUS_FORMAT=string, written in responses.
+var statusNames = map[Status]string{
+	StatusIncomplete: "incomplete",
+	StatusCompleted:  "completed",
+}
+
+// statusAsString makes statuses serialize by name rather than as 0 or 1. It
+// is set once at startup from Config.StatusFormat.
+var statusAsString bool
+
+// errInvalidStatus is returned when a status is neither a known name nor a
+// number.
+var errInvalidStatus = errors.New("Status must be incomplete, completed, 0 or 1")
+
+// valid reports whether s is one of the known statuses.
+func (s Status) valid() bool {
+	_, ok := statusNames[s]
+	return ok
+}
+
+func (s Status) MarshalJSON() ([]byte, error) {
+	if name, ok := statusNames[s]; ok && statusAsString {
+		return json.Marshal(name)
+	}
+	return json.Marshal(int(s))
+}
+
+// UnmarshalJSON accepts a status name or any integer. Out-of-range numbers
+// are left for validation to reject, so they are reported alongside any
+// other problems with the payload.
+func (s *Status) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		status, ok := statusByName(name)
+		if !ok {
+			return errInvalidStatus
+		}
+		*s = status
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(data, &n); err != nil {
+		return errInvalidStatus
+	}
+	*s = Status(n)
+	return nil
+}
+
+// parseStatus parses a status written by name or as 0 or 1, as in a query
+// parameter or CSV cell.
+func parseStatus(v string) (Status, error) {
+	if status, ok := statusByName(v); ok {
+		return status, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || !Status(n).valid() {
+		return 0, errInvalidStatus
+	}
+	return Status(n), nil
+}
+
+// statusByName returns the status with the given name.
+func statusByName(name string) (Status, bool) {
+	for status, n := range statusNames {
+		if n == name {
+			return status, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusJSON(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want Status
+	}{
+		{`0`, StatusIncomplete},
+		{`1`, StatusCompleted},
+		{`"incomplete"`, StatusIncomplete},
+		{`"completed"`, StatusCompleted},
+		{`2`, 2}, // left for validation to reject
+	} {
+		var got Status
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{`"done"`, `true`, `1.5`} {
+		var got Status
+		if err := json.Unmarshal([]byte(in), &got); !errors.Is(err, errInvalidStatus) {
+			t.Errorf("Unmarshal(%s) returned %v, want errInvalidStatus", in, err)
+		}
+	}
+
+	if data, _ := json.Marshal(StatusCompleted); string(data) != `1` {
+		t.Errorf("Marshal returned %s, want 1", data)
+	}
+	statusAsString = true
+	t.Cleanup(func() { statusAsString = false })
+	if data, _ := json.Marshal(StatusCompleted); string(data) != `"completed"` {
+		t.Errorf("Marshal returned %s, want \"completed\"", data)
+	}
+}
+
+func TestStatusNames(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Open"}
+	store.tasks["2"] = Task{ID: "2", Name: "Done", Status: StatusCompleted}
+
+	req, _ := http.NewRequest("PATCH", "/tasks/1", strings.NewReader(`{"status": "completed"}`))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if store.tasks["1"].Status != StatusCompleted {
+		t.Fatalf("handler did not accept the status name: %d %s", rr.Code, rr.Body)
+	}
+
+	req, _ = http.NewRequest("GET", "/tasks?status=completed", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var list TaskList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || list.Total != 2 {
+		t.Errorf("filtering by status name returned %+v, %v", list, err)
+	}
+
+	req, _ = http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "New", "status": "done"}`))
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code for an unknown status: got %v want %v", status, http.StatusBadRequest)
+	}
+	if !strings.Contains(rr.Body.String(), errInvalidStatus.Error()) {
+		t.Errorf("handler returned unexpected body: got %v", rr.Body)
+	}
+}
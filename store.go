@@ -0,0 +1,688 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNotFound is returned by a Store when no task has the requested ID.
+var ErrNotFound = errors.New("task not found")
+
+// ErrExists is returned by Store.Create when a task with the same ID is
+// already stored.
+var ErrExists = errors.New("task already exists")
+
+// ErrStale is returned by Store.Commit when a task has changed since the
+// changes were computed.
+var ErrStale = errors.New("task has changed")
+
+// ErrProjectNotEmpty is returned by Store.DeleteProject when it is not to
+// cascade and tasks are still in the project.
+var ErrProjectNotEmpty = errors.New("project has tasks")
+
+// ErrProjectReferenced is returned by Store.DeleteProject when it is to
+// cascade but a task outside the project has one of the project's tasks as
+// its parent or a dependency, which would be left dangling.
+var ErrProjectReferenced = errors.New("project's tasks are referred to from outside it")
+
+// ErrTaskLimit is returned by Store.Create and Store.Commit when storing
+// the new tasks would take the store past its task limit.
+var ErrTaskLimit = errors.New("task limit reached")
+
+// ErrNoProject is returned by the Store calls that write tasks when a task
+// would be put in a project that is not stored. The check is made in the
+// same atomic step as the write, so a project deleted concurrently cannot be
+// left referred to.
+var ErrNoProject = errors.New("project not found")
+
+// TaskChange is one change of a Store.Commit.
+type TaskChange struct {
+	Task Task // the task to store
+	// Version is the version the stored task must still have for it to be
+	// replaced, or 0 if the task is created.
+	Version int
+}
+
+// Store persists tasks. Implementations must be safe for concurrent use, and
+// should give up on a call once its context is done, so work for a client
+// that has gone away is not finished.
+type Store interface {
+	// GetAll returns every task, in no particular order.
+	GetAll(ctx context.Context) ([]Task, error)
+	// Get returns the task with the given ID, or ErrNotFound.
+	Get(ctx context.Context, id string) (Task, error)
+	// Snapshot returns every task, project and comment, read together so
+	// that they are consistent with each other. TakenAt is left for the
+	// caller to set.
+	Snapshot(ctx context.Context) (Snapshot, error)
+	// Count returns the number of stored tasks, those in the trash included.
+	Count(ctx context.Context) (int, error)
+	// SetMaxTasks limits how many tasks, those in the trash included, the
+	// store may hold; 0, the default, means no limit. It is meant to be
+	// called before the store is used.
+	SetMaxTasks(n int)
+	// Create inserts the given tasks. Either all of them are stored or, on
+	// error, none are. Returns ErrExists if any ID is already taken,
+	// ErrTaskLimit if they would not fit under the task limit, and
+	// ErrNoProject if any is in a project that is not stored.
+	Create(ctx context.Context, tasks ...Task) error
+	// Update loads the task with the given ID, applies fn to it and stores the
+	// result, all atomically. If fn returns an error the stored task is left
+	// unchanged and that error is returned. Returns ErrNotFound if the task
+	// does not exist, and ErrNoProject if fn moves it to a project that is
+	// not stored.
+	Update(ctx context.Context, id string, fn func(*Task) error) (Task, error)
+	// UpdateMatching applies fn to every task for which match returns true and
+	// stores the results, all atomically, returning the updated tasks. If fn
+	// returns an error no task is changed and that error is returned, as is
+	// ErrNoProject if fn moves a task to a project that is not stored.
+	UpdateMatching(ctx context.Context, match func(Task) bool, fn func(*Task) error) ([]Task, error)
+	// Commit applies changes computed from tasks read earlier, all
+	// atomically: on error nothing is changed. Creating a task whose ID is
+	// taken returns ErrExists, creating more than fit under the task limit
+	// returns ErrTaskLimit, replacing one that is missing or no longer at
+	// the expected version returns ErrStale, and storing one in a project
+	// that is not stored returns ErrNoProject.
+	Commit(ctx context.Context, changes []TaskChange) error
+	// Delete removes the task with the given ID along with its comments, or
+	// returns ErrNotFound.
+	Delete(ctx context.Context, id string) error
+	// DeleteMatching removes every task for which match returns true, along
+	// with its comments, all atomically, returning the removed tasks.
+	DeleteMatching(ctx context.Context, match func(Task) bool) ([]Task, error)
+	// DeleteAll removes every task and comment.
+	DeleteAll(ctx context.Context) error
+	// Replace atomically swaps every stored task, project and comment for
+	// those in snapshot, whose IDs must be distinct and whose comments must
+	// be on its tasks. TakenAt is ignored.
+	Replace(ctx context.Context, snapshot Snapshot) error
+	// Comments returns the comments on the task with the given ID, in no
+	// particular order.
+	Comments(ctx context.Context, taskID string) ([]Comment, error)
+	// AddComment stores a comment, or returns ErrNotFound if its task does
+	// not exist.
+	AddComment(ctx context.Context, comment Comment) error
+	// Templates returns every task template, in no particular order.
+	Templates(ctx context.Context) ([]Template, error)
+	// Template returns the template with the given ID, or ErrNotFound.
+	Template(ctx context.Context, id string) (Template, error)
+	// AddTemplate stores a template, or returns ErrExists if its ID is
+	// already taken. Templates are kept apart from tasks, so deleting or
+	// replacing tasks leaves them alone.
+	AddTemplate(ctx context.Context, template Template) error
+	// Projects returns every project, in no particular order.
+	Projects(ctx context.Context) ([]Project, error)
+	// Project returns the project with the given ID, or ErrNotFound.
+	Project(ctx context.Context, id string) (Project, error)
+	// AddProject stores a project, or returns ErrExists if its ID is already
+	// taken. Like templates, projects are kept apart from tasks, though
+	// Replace swaps them along with the tasks.
+	AddProject(ctx context.Context, project Project) error
+	// UpdateProject applies fn to the project with the given ID and stores
+	// the result atomically. If fn returns an error, nothing is stored.
+	UpdateProject(ctx context.Context, id string, fn func(*Project) error) (Project, error)
+	// DeleteProject removes the project with the given ID, or returns
+	// ErrNotFound. With cascade, the tasks in it, even those in the trash,
+	// are removed with it and returned, unless a task outside the project
+	// refers to one of them, when ErrProjectReferenced is returned; without,
+	// ErrProjectNotEmpty is returned while there are any.
+	DeleteProject(ctx context.Context, id string, cascade bool) ([]Task, error)
+	// Ping checks that the store can serve requests, e.g. that its database
+	// is reachable.
+	Ping(ctx context.Context) error
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// MemoryStore is an in-memory Store, optionally persisted to a JSON file. Its
+// calls never wait on anything slow, so it ignores their contexts.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	tasks     map[string]Task
+	comments  map[string][]Comment // by task ID
+	templates map[string]Template
+	projects  map[string]Project
+	path      string
+	maxTasks  int // 0 means unlimited
+}
+
+// memoryStoreFile is the layout of a MemoryStore's file. Files written before
+// comments existed hold just the map of tasks, and are still read.
+type memoryStoreFile struct {
+	Tasks     map[string]Task      `json:"tasks"`
+	Comments  map[string][]Comment `json:"comments"`
+	Templates map[string]Template  `json:"templates"`
+	Projects  map[string]Project   `json:"projects"`
+}
+
+// NewMemoryStore creates a memory store. If path is non-empty, existing tasks
+// are loaded from that file and every mutation writes them back to it.
+func NewMemoryStore(path string) (*MemoryStore, error) {
+	s := &MemoryStore{
+		tasks:     make(map[string]Task),
+		comments:  make(map[string][]Comment),
+		templates: make(map[string]Template),
+		projects:  make(map[string]Project),
+		path:      path,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file memoryStoreFile
+	if err := json.Unmarshal(data, &file); err != nil || file.Tasks == nil {
+		if err := json.Unmarshal(data, &s.tasks); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	s.tasks = file.Tasks
+	if file.Comments != nil {
+		s.comments = file.Comments
+	}
+	if file.Templates != nil {
+		s.templates = file.Templates
+	}
+	if file.Projects != nil {
+		s.projects = file.Projects
+	}
+	return s, nil
+}
+
+func (s *MemoryStore) GetAll(_ context.Context) ([]Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := make([]Task, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	task, exists := s.tasks[id]
+	if !exists {
+		return Task{}, ErrNotFound
+	}
+	return task, nil
+}
+
+func (s *MemoryStore) Snapshot(_ context.Context) (Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot := Snapshot{Tasks: make([]Task, 0, len(s.tasks)), Projects: make([]Project, 0, len(s.projects)), Comments: []Comment{}}
+	for _, task := range s.tasks {
+		snapshot.Tasks = append(snapshot.Tasks, task)
+		snapshot.Comments = append(snapshot.Comments, s.comments[task.ID]...)
+	}
+	for _, project := range s.projects {
+		snapshot.Projects = append(snapshot.Projects, project)
+	}
+	return snapshot, nil
+}
+
+func (s *MemoryStore) Count(_ context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.tasks), nil
+}
+
+func (s *MemoryStore) SetMaxTasks(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.maxTasks = n
+}
+
+func (s *MemoryStore) Create(_ context.Context, tasks ...Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxTasks != 0 && len(s.tasks)+len(tasks) > s.maxTasks {
+		return ErrTaskLimit
+	}
+	seen := make(map[string]bool, len(tasks))
+	for _, task := range tasks {
+		if _, exists := s.tasks[task.ID]; exists || seen[task.ID] {
+			return ErrExists
+		}
+		seen[task.ID] = true
+	}
+	if err := s.checkProjects(tasks...); err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		s.tasks[task.ID] = task
+	}
+	return s.saveOrUndo(func() {
+		for _, task := range tasks {
+			delete(s.tasks, task.ID)
+		}
+	})
+}
+
+func (s *MemoryStore) Update(_ context.Context, id string, fn func(*Task) error) (Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, exists := s.tasks[id]
+	if !exists {
+		return Task{}, ErrNotFound
+	}
+	task := before
+	if err := fn(&task); err != nil {
+		return Task{}, err
+	}
+	if task.ProjectID != before.ProjectID {
+		if err := s.checkProjects(task); err != nil {
+			return Task{}, err
+		}
+	}
+	s.tasks[id] = task
+	if err := s.saveOrUndo(func() { s.tasks[id] = before }); err != nil {
+		return Task{}, err
+	}
+	return task, nil
+}
+
+func (s *MemoryStore) UpdateMatching(_ context.Context, match func(Task) bool, fn func(*Task) error) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := []Task{}
+	for _, task := range s.tasks {
+		if !match(task) {
+			continue
+		}
+		project := task.ProjectID
+		if err := fn(&task); err != nil {
+			return nil, err
+		}
+		if task.ProjectID != project {
+			if err := s.checkProjects(task); err != nil {
+				return nil, err
+			}
+		}
+		updated = append(updated, task)
+	}
+	before := make([]Task, len(updated))
+	for i, task := range updated {
+		before[i] = s.tasks[task.ID]
+		s.tasks[task.ID] = task
+	}
+	if err := s.saveOrUndo(func() { s.putTasks(before) }); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (s *MemoryStore) Commit(_ context.Context, changes []TaskChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	created := 0
+	for _, change := range changes {
+		stored, exists := s.tasks[change.Task.ID]
+		switch {
+		case change.Version == 0 && exists:
+			return ErrExists
+		case change.Version != 0 && (!exists || stored.Version != change.Version):
+			return ErrStale
+		}
+		if change.Version == 0 {
+			created++
+		}
+		if err := s.checkProjects(change.Task); err != nil {
+			return err
+		}
+	}
+	if s.maxTasks != 0 && len(s.tasks)+created > s.maxTasks {
+		return ErrTaskLimit
+	}
+	var before []Task
+	for _, change := range changes {
+		if change.Version != 0 {
+			before = append(before, s.tasks[change.Task.ID])
+		}
+		s.tasks[change.Task.ID] = change.Task
+	}
+	return s.saveOrUndo(func() {
+		for _, change := range changes {
+			delete(s.tasks, change.Task.ID)
+		}
+		s.putTasks(before)
+	})
+}
+
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task, exists := s.tasks[id]
+	if !exists {
+		return ErrNotFound
+	}
+	comments := s.comments[id]
+	delete(s.tasks, id)
+	delete(s.comments, id)
+	return s.saveOrUndo(func() { s.putTasks([]Task{task}, comments) })
+}
+
+func (s *MemoryStore) DeleteMatching(_ context.Context, match func(Task) bool) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := []Task{}
+	var comments []Comment
+	for id, task := range s.tasks {
+		if !match(task) {
+			continue
+		}
+		comments = append(comments, s.comments[id]...)
+		delete(s.tasks, id)
+		delete(s.comments, id)
+		deleted = append(deleted, task)
+	}
+	if len(deleted) == 0 {
+		return deleted, nil
+	}
+	if err := s.saveOrUndo(func() { s.putTasks(deleted, comments) }); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) DeleteAll(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tasks, comments := s.tasks, s.comments
+	s.tasks = make(map[string]Task)
+	s.comments = make(map[string][]Comment)
+	return s.saveOrUndo(func() { s.tasks, s.comments = tasks, comments })
+}
+
+func (s *MemoryStore) Replace(_ context.Context, snapshot Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	oldTasks, oldComments, oldProjects := s.tasks, s.comments, s.projects
+	s.tasks = make(map[string]Task, len(snapshot.Tasks))
+	for _, task := range snapshot.Tasks {
+		s.tasks[task.ID] = task
+	}
+	s.comments = make(map[string][]Comment)
+	for _, comment := range snapshot.Comments {
+		s.comments[comment.TaskID] = append(s.comments[comment.TaskID], comment)
+	}
+	s.projects = make(map[string]Project, len(snapshot.Projects))
+	for _, project := range snapshot.Projects {
+		s.projects[project.ID] = project
+	}
+	return s.saveOrUndo(func() { s.tasks, s.comments, s.projects = oldTasks, oldComments, oldProjects })
+}
+
+func (s *MemoryStore) Comments(_ context.Context, taskID string) ([]Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Comment{}, s.comments[taskID]...), nil
+}
+
+func (s *MemoryStore) AddComment(_ context.Context, comment Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tasks[comment.TaskID]; !exists {
+		return ErrNotFound
+	}
+	before, had := s.comments[comment.TaskID]
+	s.comments[comment.TaskID] = append(before, comment)
+	return s.saveOrUndo(func() {
+		if had {
+			s.comments[comment.TaskID] = before
+		} else {
+			delete(s.comments, comment.TaskID)
+		}
+	})
+}
+
+func (s *MemoryStore) Templates(_ context.Context) ([]Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := make([]Template, 0, len(s.templates))
+	for _, template := range s.templates {
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
+
+func (s *MemoryStore) Template(_ context.Context, id string) (Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	template, ok := s.templates[id]
+	if !ok {
+		return Template{}, ErrNotFound
+	}
+	return template, nil
+}
+
+func (s *MemoryStore) AddTemplate(_ context.Context, template Template) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.templates[template.ID]; exists {
+		return ErrExists
+	}
+	s.templates[template.ID] = template
+	return s.saveOrUndo(func() { delete(s.templates, template.ID) })
+}
+
+func (s *MemoryStore) Projects(_ context.Context) ([]Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	projects := make([]Project, 0, len(s.projects))
+	for _, project := range s.projects {
+		projects = append(projects, project)
+	}
+	return projects, nil
+}
+
+func (s *MemoryStore) Project(_ context.Context, id string) (Project, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	project, ok := s.projects[id]
+	if !ok {
+		return Project{}, ErrNotFound
+	}
+	return project, nil
+}
+
+func (s *MemoryStore) AddProject(_ context.Context, project Project) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.projects[project.ID]; exists {
+		return ErrExists
+	}
+	s.projects[project.ID] = project
+	return s.saveOrUndo(func() { delete(s.projects, project.ID) })
+}
+
+func (s *MemoryStore) UpdateProject(_ context.Context, id string, fn func(*Project) error) (Project, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, exists := s.projects[id]
+	if !exists {
+		return Project{}, ErrNotFound
+	}
+	project := before
+	if err := fn(&project); err != nil {
+		return Project{}, err
+	}
+	s.projects[id] = project
+	if err := s.saveOrUndo(func() { s.projects[id] = before }); err != nil {
+		return Project{}, err
+	}
+	return project, nil
+}
+
+func (s *MemoryStore) DeleteProject(_ context.Context, id string, cascade bool) ([]Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	project, exists := s.projects[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	deleted, outside := []Task{}, []Task{}
+	for _, task := range s.tasks {
+		if task.ProjectID == id {
+			deleted = append(deleted, task)
+		} else {
+			outside = append(outside, task)
+		}
+	}
+	if len(deleted) > 0 && !cascade {
+		return nil, ErrProjectNotEmpty
+	}
+	if refersTo(outside, deleted) {
+		return nil, ErrProjectReferenced
+	}
+	var comments []Comment
+	for _, task := range deleted {
+		comments = append(comments, s.comments[task.ID]...)
+		delete(s.tasks, task.ID)
+		delete(s.comments, task.ID)
+	}
+	delete(s.projects, id)
+	if err := s.saveOrUndo(func() {
+		s.putTasks(deleted, comments)
+		s.projects[id] = project
+	}); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// refersTo reports whether any task in from has a task in targets as its
+// parent or among its dependencies.
+func refersTo(from, targets []Task) bool {
+	ids := make(map[string]bool, len(targets))
+	for _, task := range targets {
+		ids[task.ID] = true
+	}
+	for _, task := range from {
+		if task.ParentID != nil && ids[*task.ParentID] {
+			return true
+		}
+		for _, dep := range task.DependsOn {
+			if ids[dep] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Ping always succeeds: a MemoryStore has nothing to reach.
+func (s *MemoryStore) Ping(_ context.Context) error {
+	return nil
+}
+
+// Close flushes the tasks to the store's file, if it has one.
+func (s *MemoryStore) Close() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.save()
+}
+
+// saveOrUndo saves the store, calling undo to take back the change just made
+// to it if that fails, so a failed call leaves no change behind. The caller
+// must hold s.mu.
+func (s *MemoryStore) saveOrUndo(undo func()) error {
+	if err := s.save(); err != nil {
+		undo()
+		return err
+	}
+	return nil
+}
+
+// checkProjects returns ErrNoProject if any of tasks is in a project that is
+// not stored. The caller must hold s.mu.
+func (s *MemoryStore) checkProjects(tasks ...Task) error {
+	for _, task := range tasks {
+		if _, exists := s.projects[task.ProjectID]; task.ProjectID != "" && !exists {
+			return ErrNoProject
+		}
+	}
+	return nil
+}
+
+// putTasks stores tasks and appends comments to those of their tasks, for
+// undoing a change. The caller must hold s.mu.
+func (s *MemoryStore) putTasks(tasks []Task, comments ...[]Comment) {
+	for _, task := range tasks {
+		s.tasks[task.ID] = task
+	}
+	for _, list := range comments {
+		for _, comment := range list {
+			s.comments[comment.TaskID] = append(s.comments[comment.TaskID], comment)
+		}
+	}
+}
+
+// save writes all tasks, comments, templates and projects to the store's file
+// and is a no-op for a store without one. The caller must hold s.mu. The
+// tasks are written to a temporary file that is then renamed over the target,
+// so a partial write never corrupts the store.
+func (s *MemoryStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(memoryStoreFile{Tasks: s.tasks, Comments: s.comments, Templates: s.templates, Projects: s.projects}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testStore exercises the Store contract against any implementation.
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	due := now.Add(24 * time.Hour)
+	first := Task{ID: "1", Name: "First", Description: "One", Priority: 2, DueDate: &due, RemindAt: &now, RemindedAt: &due, Tags: []string{"home", "urgent"}, Recurrence: "weekly", Position: 1.5, CreatedAt: now, UpdatedAt: now, Version: 3}
+	parentID := "1"
+	second := Task{ID: "2", Name: "Second", Status: 1, ParentID: &parentID, Assignee: "alice", ProjectID: "p1", Archived: true, ExpiresAt: &due, DependsOn: []string{"1"}, CreatedAt: now, UpdatedAt: now}
+	if err := s.AddProject(ctx, Project{ID: "p1", Name: "Release"}); err != nil {
+		t.Fatalf("AddProject returned error: %v", err)
+	}
+	if err := s.Create(ctx, first, second); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+
+	if err := s.Create(ctx, Task{ID: "3", Name: "Third"}, Task{ID: "1", Name: "Duplicate"}); !errors.Is(err, ErrExists) {
+		t.Errorf("Create of duplicate ID returned %v, want ErrExists", err)
+	}
+	if _, err := s.Get(ctx, "3"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed Create stored part of the batch: got %v", err)
+	}
+
+	got, err := s.Get(ctx, "1")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if got.Name != "First" || got.Priority != 2 || got.DueDate == nil || !got.DueDate.Equal(due) ||
+		got.RemindAt == nil || !got.RemindAt.Equal(now) || got.RemindedAt == nil || !got.RemindedAt.Equal(due) ||
+		!slices.Equal(got.Tags, first.Tags) || !got.CreatedAt.Equal(now) || got.Version != 3 || got.Recurrence != "weekly" || got.Position != 1.5 {
+		t.Errorf("Get returned wrong task: got %+v", got)
+	}
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of missing task returned %v, want ErrNotFound", err)
+	}
+
+	if got, _ := s.Get(ctx, "2"); got.ParentID == nil || *got.ParentID != "1" || got.Assignee != "alice" || got.ProjectID != "p1" || !got.Archived ||
+		got.ExpiresAt == nil || !got.ExpiresAt.Equal(due) || !slices.Equal(got.DependsOn, []string{"1"}) {
+		t.Errorf("Get returned wrong parent, assignee, project, archived flag, expiry or dependencies: got %+v", got)
+	}
+
+	all, err := s.GetAll(ctx)
+	if err != nil || len(all) != 2 {
+		t.Errorf("GetAll returned %d tasks, %v; want 2", len(all), err)
+	}
+
+	updated, err := s.Update(ctx, "2", func(task *Task) error {
+		task.Name = "Renamed"
+		task.DueDate = nil
+		return nil
+	})
+	if err != nil || updated.Name != "Renamed" {
+		t.Errorf("Update returned %+v, %v", updated, err)
+	}
+	if got, _ := s.Get(ctx, "2"); got.Name != "Renamed" {
+		t.Errorf("Update was not stored: got %+v", got)
+	}
+
+	errReject := errors.New("rejected")
+	if _, err := s.Update(ctx, "2", func(task *Task) error {
+		task.Name = "Should not stick"
+		return errReject
+	}); !errors.Is(err, errReject) {
+		t.Errorf("Update returned %v, want the callback's error", err)
+	}
+	if got, _ := s.Get(ctx, "2"); got.Name != "Renamed" {
+		t.Errorf("failed Update modified the task: got %+v", got)
+	}
+	if _, err := s.Update(ctx, "missing", func(*Task) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update of missing task returned %v, want ErrNotFound", err)
+	}
+
+	matched, err := s.UpdateMatching(ctx, func(task Task) bool { return task.Status == 1 }, func(task *Task) error {
+		task.Priority = 1
+		return nil
+	})
+	if err != nil || len(matched) != 1 || matched[0].ID != "2" {
+		t.Errorf("UpdateMatching returned %+v, %v; want task 2", matched, err)
+	}
+	if got, _ := s.Get(ctx, "2"); got.Priority != 1 {
+		t.Errorf("UpdateMatching was not stored: got %+v", got)
+	}
+	if _, err := s.UpdateMatching(ctx, func(Task) bool { return true }, func(task *Task) error {
+		if task.ID == "2" {
+			return errReject
+		}
+		task.Name = "Should not stick"
+		return nil
+	}); !errors.Is(err, errReject) {
+		t.Errorf("UpdateMatching returned %v, want the callback's error", err)
+	}
+	if got, _ := s.Get(ctx, "1"); got.Name != "First" {
+		t.Errorf("failed UpdateMatching modified a task: got %+v", got)
+	}
+
+	comment := Comment{ID: "c1", TaskID: "1", Author: "alice", Body: "Looks good", CreatedAt: now}
+	if err := s.AddComment(ctx, comment); err != nil {
+		t.Errorf("AddComment returned error: %v", err)
+	}
+	if err := s.AddComment(ctx, Comment{ID: "c2", TaskID: "2", Body: "On the second", CreatedAt: now}); err != nil {
+		t.Errorf("AddComment returned error: %v", err)
+	}
+	if err := s.AddComment(ctx, Comment{ID: "c3", TaskID: "missing", Body: "Orphan", CreatedAt: now}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AddComment on a missing task returned %v, want ErrNotFound", err)
+	}
+	if got, err := s.Comments(ctx, "1"); err != nil || len(got) != 1 || !got[0].CreatedAt.Equal(now) {
+		t.Errorf("Comments returned %+v, %v", got, err)
+	} else if got[0].CreatedAt = comment.CreatedAt; got[0] != comment {
+		t.Errorf("Comments returned %+v, want %+v", got[0], comment)
+	}
+
+	if err := s.Delete(ctx, "1"); err != nil {
+		t.Errorf("Delete returned error: %v", err)
+	}
+	if err := s.Delete(ctx, "1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Delete returned %v, want ErrNotFound", err)
+	}
+	if got, err := s.Comments(ctx, "1"); err != nil || len(got) != 0 {
+		t.Errorf("Delete kept the task's comments: got %+v, %v", got, err)
+	}
+
+	if err := s.Replace(ctx, Snapshot{Tasks: []Task{{ID: "4", Name: "Restored", Version: 2}, {ID: "5", Name: "Also restored"}}}); err != nil {
+		t.Errorf("Replace returned error: %v", err)
+	}
+	if all, _ := s.GetAll(ctx); len(all) != 2 {
+		t.Errorf("Replace left %d tasks, want 2", len(all))
+	}
+	if got, err := s.Get(ctx, "4"); err != nil || got.Name != "Restored" || got.Version != 2 {
+		t.Errorf("Replace stored wrong task: got %+v, %v", got, err)
+	}
+	if _, err := s.Get(ctx, "2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Replace kept a previous task: got %v", err)
+	}
+	if got, _ := s.Comments(ctx, "2"); len(got) != 0 {
+		t.Errorf("Replace kept a previous comment: got %+v", got)
+	}
+
+	if err := s.AddComment(ctx, Comment{ID: "c4", TaskID: "5", Body: "Going away", CreatedAt: now}); err != nil {
+		t.Errorf("AddComment returned error: %v", err)
+	}
+	removed, err := s.DeleteMatching(ctx, func(task Task) bool { return task.ID == "5" })
+	if err != nil || len(removed) != 1 || removed[0].Name != "Also restored" {
+		t.Errorf("DeleteMatching returned %+v, %v; want task 5", removed, err)
+	}
+	if _, err := s.Get(ctx, "5"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteMatching kept the task: got %v", err)
+	}
+	if got, _ := s.Comments(ctx, "5"); len(got) != 0 {
+		t.Errorf("DeleteMatching kept the task's comments: got %+v", got)
+	}
+
+	created := TaskChange{Task: Task{ID: "6", Name: "Committed", Version: 1}}
+	stale := TaskChange{Task: Task{ID: "4", Name: "Changed", Version: 3}, Version: 1}
+	if err := s.Commit(ctx, []TaskChange{created, stale}); !errors.Is(err, ErrStale) {
+		t.Errorf("Commit of a stale version returned %v, want ErrStale", err)
+	}
+	if _, err := s.Get(ctx, "6"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed Commit stored a task: got %v", err)
+	}
+	stale.Version = 2
+	if err := s.Commit(ctx, []TaskChange{created, stale}); err != nil {
+		t.Errorf("Commit returned error: %v", err)
+	}
+	if got, err := s.Get(ctx, "4"); err != nil || got.Name != "Changed" || got.Version != 3 {
+		t.Errorf("Commit stored wrong task: got %+v, %v", got, err)
+	}
+	if err := s.Commit(ctx, []TaskChange{created}); !errors.Is(err, ErrExists) {
+		t.Errorf("Commit of an existing task returned %v, want ErrExists", err)
+	}
+
+	template := Template{ID: "t1", Name: "Onboarding", Tasks: []TemplateTask{{Name: "Get a laptop", Priority: 2, Tags: []string{"it"}}}, CreatedAt: now}
+	if err := s.AddTemplate(ctx, template); err != nil {
+		t.Errorf("AddTemplate returned error: %v", err)
+	}
+	if err := s.AddTemplate(ctx, template); !errors.Is(err, ErrExists) {
+		t.Errorf("second AddTemplate returned %v, want ErrExists", err)
+	}
+	if _, err := s.Template(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Template of a missing ID returned %v, want ErrNotFound", err)
+	}
+
+	project := Project{ID: "p1", Name: "Release", Description: "Spring release", CreatedAt: now}
+	if err := s.AddProject(ctx, project); err != nil {
+		t.Errorf("AddProject returned error: %v", err)
+	}
+	if err := s.AddProject(ctx, project); !errors.Is(err, ErrExists) {
+		t.Errorf("second AddProject returned %v, want ErrExists", err)
+	}
+	if _, err := s.Project(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Project of a missing ID returned %v, want ErrNotFound", err)
+	}
+
+	if err := s.DeleteAll(ctx); err != nil {
+		t.Errorf("DeleteAll returned error: %v", err)
+	}
+	if all, _ := s.GetAll(ctx); len(all) != 0 {
+		t.Errorf("DeleteAll left %d tasks", len(all))
+	}
+	if got, err := s.Template(ctx, "t1"); err != nil || got.Name != "Onboarding" || len(got.Tasks) != 1 || got.Tasks[0].Tags[0] != "it" || !got.CreatedAt.Equal(now) {
+		t.Errorf("Template returned %+v, %v after DeleteAll", got, err)
+	}
+	if all, err := s.Templates(ctx); err != nil || len(all) != 1 {
+		t.Errorf("Templates returned %+v, %v", all, err)
+	}
+	if got, err := s.Project(ctx, "p1"); err != nil || got.Name != "Release" || got.Description != "Spring release" || !got.CreatedAt.Equal(now) {
+		t.Errorf("Project returned %+v, %v after DeleteAll", got, err)
+	}
+	if all, err := s.Projects(ctx); err != nil || len(all) != 1 {
+		t.Errorf("Projects returned %+v, %v", all, err)
+	}
+
+	if got, err := s.UpdateProject(ctx, "p1", func(p *Project) error { p.Name = "Release 2"; return nil }); err != nil || got.Name != "Release 2" {
+		t.Errorf("UpdateProject returned %+v, %v", got, err)
+	}
+	if got, _ := s.Project(ctx, "p1"); got.Name != "Release 2" || got.Description != "Spring release" {
+		t.Errorf("UpdateProject stored %+v", got)
+	}
+	if _, err := s.UpdateProject(ctx, "missing", func(*Project) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("UpdateProject of a missing ID returned %v, want ErrNotFound", err)
+	}
+	if _, err := s.UpdateProject(ctx, "p1", func(p *Project) error { p.Name = "Lost"; return ErrStale }); !errors.Is(err, ErrStale) {
+		t.Errorf("UpdateProject returned %v, want the callback's error", err)
+	}
+	if got, _ := s.Project(ctx, "p1"); got.Name != "Release 2" {
+		t.Errorf("failed UpdateProject modified the project: got %+v", got)
+	}
+
+	if err := s.Create(ctx, Task{ID: "7", Name: "In the project", ProjectID: "p1"}, Task{ID: "8", Name: "Elsewhere"}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if err := s.AddComment(ctx, Comment{ID: "c5", TaskID: "7", Body: "Going away", CreatedAt: now}); err != nil {
+		t.Errorf("AddComment returned error: %v", err)
+	}
+	if _, err := s.DeleteProject(ctx, "p1", false); !errors.Is(err, ErrProjectNotEmpty) {
+		t.Errorf("DeleteProject of a project with tasks returned %v, want ErrProjectNotEmpty", err)
+	}
+	if _, err := s.Project(ctx, "p1"); err != nil {
+		t.Errorf("refused DeleteProject removed the project: %v", err)
+	}
+	for _, refer := range []func(*Task){
+		func(task *Task) { task.DependsOn = []string{"7"} },
+		func(task *Task) { parent := "7"; task.ParentID = &parent },
+	} {
+		if _, err := s.Update(ctx, "8", func(task *Task) error { refer(task); return nil }); err != nil {
+			t.Fatalf("Update returned error: %v", err)
+		}
+		if _, err := s.DeleteProject(ctx, "p1", true); !errors.Is(err, ErrProjectReferenced) {
+			t.Errorf("cascading DeleteProject of a task referred to from outside returned %v, want ErrProjectReferenced", err)
+		}
+		if _, err := s.Get(ctx, "7"); err != nil {
+			t.Errorf("refused DeleteProject removed the task: %v", err)
+		}
+		if _, err := s.Update(ctx, "8", func(task *Task) error { task.DependsOn, task.ParentID = nil, nil; return nil }); err != nil {
+			t.Fatalf("Update returned error: %v", err)
+		}
+	}
+	removed, err = s.DeleteProject(ctx, "p1", true)
+	if err != nil || len(removed) != 1 || removed[0].ID != "7" {
+		t.Errorf("cascading DeleteProject returned %+v, %v; want task 7", removed, err)
+	}
+	if _, err := s.Project(ctx, "p1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DeleteProject kept the project: got %v", err)
+	}
+	if _, err := s.Get(ctx, "7"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("cascading DeleteProject kept the task: got %v", err)
+	}
+	if got, _ := s.Comments(ctx, "7"); len(got) != 0 {
+		t.Errorf("cascading DeleteProject kept the task's comments: got %+v", got)
+	}
+	if _, err := s.Get(ctx, "8"); err != nil {
+		t.Errorf("DeleteProject removed a task outside the project: %v", err)
+	}
+	if _, err := s.DeleteProject(ctx, "p1", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second DeleteProject returned %v, want ErrNotFound", err)
+	}
+
+	if err := s.AddProject(ctx, Project{ID: "p2", Name: "Replaced"}); err != nil {
+		t.Fatalf("AddProject returned error: %v", err)
+	}
+	if err := s.Replace(ctx, Snapshot{
+		Tasks:    []Task{{ID: "9", Name: "Restored", ProjectID: "p3"}},
+		Projects: []Project{{ID: "p3", Name: "Restored", CreatedAt: now}},
+		Comments: []Comment{{ID: "c9", TaskID: "9", Body: "Restored", CreatedAt: now}},
+	}); err != nil {
+		t.Errorf("Replace returned error: %v", err)
+	}
+	if all, err := s.Projects(ctx); err != nil || len(all) != 1 || all[0].ID != "p3" || all[0].Name != "Restored" {
+		t.Errorf("Replace left projects %+v, %v; want p3", all, err)
+	}
+	if got, err := s.Get(ctx, "9"); err != nil || got.ProjectID != "p3" {
+		t.Errorf("Replace stored wrong task: got %+v, %v", got, err)
+	}
+	snapshot, err := s.Snapshot(ctx)
+	if err != nil || len(snapshot.Tasks) != 1 || snapshot.Tasks[0].ID != "9" || len(snapshot.Projects) != 1 || snapshot.Projects[0].ID != "p3" ||
+		len(snapshot.Comments) != 1 || snapshot.Comments[0].ID != "c9" {
+		t.Errorf("Snapshot returned %+v, %v", snapshot, err)
+	}
+
+	if err := s.Create(ctx, Task{ID: "10", Name: "Nowhere", ProjectID: "missing"}); !errors.Is(err, ErrNoProject) {
+		t.Errorf("Create in a missing project returned %v, want ErrNoProject", err)
+	}
+	if err := s.Commit(ctx, []TaskChange{{Task: Task{ID: "10", Name: "Nowhere", ProjectID: "missing"}}}); !errors.Is(err, ErrNoProject) {
+		t.Errorf("Commit in a missing project returned %v, want ErrNoProject", err)
+	}
+	if _, err := s.Update(ctx, "9", func(task *Task) error { task.ProjectID = "missing"; return nil }); !errors.Is(err, ErrNoProject) {
+		t.Errorf("Update into a missing project returned %v, want ErrNoProject", err)
+	}
+	if _, err := s.UpdateMatching(ctx, func(Task) bool { return true }, func(task *Task) error { task.ProjectID = "missing"; return nil }); !errors.Is(err, ErrNoProject) {
+		t.Errorf("UpdateMatching into a missing project returned %v, want ErrNoProject", err)
+	}
+	if got, err := s.Get(ctx, "9"); err != nil || got.ProjectID != "p3" {
+		t.Errorf("refused moves changed the task: got %+v, %v", got, err)
+	}
+	if _, err := s.Get(ctx, "10"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("refused creates stored the task: got %v", err)
+	}
+
+	s.SetMaxTasks(2)
+	if err := s.Create(ctx, Task{ID: "10", Name: "Over"}, Task{ID: "11", Name: "Over"}); !errors.Is(err, ErrTaskLimit) {
+		t.Errorf("Create past the task limit returned %v, want ErrTaskLimit", err)
+	}
+	if err := s.Commit(ctx, []TaskChange{{Task: Task{ID: "10", Name: "Over"}}, {Task: Task{ID: "11", Name: "Over"}}}); !errors.Is(err, ErrTaskLimit) {
+		t.Errorf("Commit past the task limit returned %v, want ErrTaskLimit", err)
+	}
+	if err := s.Create(ctx, Task{ID: "10", Name: "Fits"}); err != nil {
+		t.Errorf("Create within the task limit returned error: %v", err)
+	}
+	if n, err := s.Count(ctx); err != nil || n != 2 {
+		t.Errorf("Count returned %d, %v; want 2", n, err)
+	}
+	s.SetMaxTasks(0)
+}
+
+func TestMemoryStore(t *testing.T) {
+	store, err := NewMemoryStore("")
+	if err != nil {
+		t.Fatalf("Could not create store: %v", err)
+	}
+	testStore(t, store)
+}
+
+func TestMemoryStorePersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.json")
+
+	store, err := NewMemoryStore(path)
+	if err != nil {
+		t.Fatalf("Could not create store: %v", err)
+	}
+	if err := store.Create(ctx, Task{ID: "1", Name: "Persisted Task"}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if err := store.AddComment(ctx, Comment{ID: "c1", TaskID: "1", Body: "Persisted comment"}); err != nil {
+		t.Fatalf("AddComment returned error: %v", err)
+	}
+
+	// Re-open the store from the same file
+	reloaded, err := NewMemoryStore(path)
+	if err != nil {
+		t.Fatalf("Could not reload store: %v", err)
+	}
+	if task, err := reloaded.Get(ctx, "1"); err != nil || task.Name != "Persisted Task" {
+		t.Errorf("task was not persisted to disk: got %+v, %v", task, err)
+	}
+	if comments, err := reloaded.Comments(ctx, "1"); err != nil || len(comments) != 1 || comments[0].Body != "Persisted comment" {
+		t.Errorf("comment was not persisted to disk: got %+v, %v", comments, err)
+	}
+}
+
+func TestMemoryStoreFailedSave(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "data")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewMemoryStore(filepath.Join(dir, "tasks.json"))
+	if err != nil {
+		t.Fatalf("Could not create store: %v", err)
+	}
+	if err := store.Create(ctx, Task{ID: "1", Name: "Kept"}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	if err := store.AddComment(ctx, Comment{ID: "c1", TaskID: "1", Body: "Kept too"}); err != nil {
+		t.Fatalf("AddComment returned error: %v", err)
+	}
+	if err := store.AddProject(ctx, Project{ID: "p1", Name: "Kept"}); err != nil {
+		t.Fatalf("AddProject returned error: %v", err)
+	}
+
+	// Saving fails once the directory is gone.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(ctx, Task{ID: "2", Name: "Lost"}); err == nil {
+		t.Errorf("Create succeeded without saving")
+	}
+	if _, err := store.Update(ctx, "1", func(task *Task) error { task.Name = "Lost"; return nil }); err == nil {
+		t.Errorf("Update succeeded without saving")
+	}
+	if err := store.Commit(ctx, []TaskChange{{Task: Task{ID: "3", Name: "Lost"}}, {Task: Task{ID: "1", Name: "Lost"}}}); err == nil {
+		t.Errorf("Commit succeeded without saving")
+	}
+	if err := store.AddComment(ctx, Comment{ID: "c2", TaskID: "1", Body: "Lost"}); err == nil {
+		t.Errorf("AddComment succeeded without saving")
+	}
+	if err := store.Delete(ctx, "1"); err == nil {
+		t.Errorf("Delete succeeded without saving")
+	}
+	if _, err := store.DeleteMatching(ctx, func(Task) bool { return true }); err == nil {
+		t.Errorf("DeleteMatching succeeded without saving")
+	}
+	if err := store.Replace(ctx, Snapshot{Tasks: []Task{{ID: "4", Name: "Lost"}}, Projects: []Project{{ID: "p3", Name: "Lost"}}}); err == nil {
+		t.Errorf("Replace succeeded without saving")
+	}
+	if _, err := store.UpdateProject(ctx, "p1", func(p *Project) error { p.Name = "Lost"; return nil }); err == nil {
+		t.Errorf("UpdateProject succeeded without saving")
+	}
+	if err := store.AddProject(ctx, Project{ID: "p2", Name: "Lost"}); err == nil {
+		t.Errorf("AddProject succeeded without saving")
+	}
+
+	if all, _ := store.GetAll(ctx); len(all) != 1 || all[0].Name != "Kept" {
+		t.Errorf("failed saves changed the tasks: %+v", all)
+	}
+	if comments, _ := store.Comments(ctx, "1"); len(comments) != 1 || comments[0].ID != "c1" {
+		t.Errorf("failed saves changed the comments: %+v", comments)
+	}
+	if projects, _ := store.Projects(ctx); len(projects) != 1 || projects[0].Name != "Kept" {
+		t.Errorf("failed saves changed the projects: %+v", projects)
+	}
+}
+
+func TestMemoryStoreLegacyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	if err := os.WriteFile(path, []byte(`{"1": {"id": "1", "name": "Old Task"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewMemoryStore(path)
+	if err != nil {
+		t.Fatalf("Could not load store: %v", err)
+	}
+	if task, err := store.Get(context.Background(), "1"); err != nil || task.Name != "Old Task" {
+		t.Errorf("task was not loaded from a file without comments: got %+v, %v", task, err)
+	}
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatalf("Could not create store: %v", err)
+	}
+	defer store.Close()
+	testStore(t, store)
+}
+
+func TestSQLiteStoreReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.db")
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Could not create store: %v", err)
+	}
+	if err := store.Create(ctx, Task{ID: "1", Name: "Persisted Task"}); err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	store.Close()
+
+	// Re-opening must not re-run migrations that were already applied
+	reopened, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Could not reopen store: %v", err)
+	}
+	defer reopened.Close()
+	if task, err := reopened.Get(ctx, "1"); err != nil || task.Name != "Persisted Task" {
+		t.Errorf("task was not persisted to disk: got %+v, %v", task, err)
+	}
+}
+
+// TestPostgresStore runs against the database in TEST_DATABASE_URL, which it
+// empties first, and is skipped when that is unset.
+func TestPostgresStore(t *testing.T) {
+	ctx := context.Background()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	store, err := NewPostgresStore(url)
+	if err != nil {
+		t.Fatalf("Could not create store: %v", err)
+	}
+	defer store.Close()
+	if err := store.DeleteAll(ctx); err != nil {
+		t.Fatalf("DeleteAll returned error: %v", err)
+	}
+	testStore(t, store)
+}
+
+func TestPostgresBind(t *testing.T) {
+	got := postgresBind("UPDATE tasks SET name = ?, status = ? WHERE id = ?")
+	want := "UPDATE tasks SET name = $1, status = $2 WHERE id = $3"
+	if got != want {
+		t.Errorf("postgresBind returned %q, want %q", got, want)
+	}
+}
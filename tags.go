@@ -0,0 +1,49 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TagCount is the number of tasks carrying a tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// getTagsHandler lists every tag in use with the number of tasks carrying it,
+// most used first and then by name, so clients can offer a tag filter
+// without downloading every task. Only tasks the default list shows are
+// counted: those in the trash, archived or expired are left out.
+func (h *Handlers) getTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tasks, err := h.store.GetAll(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	now := time.Now()
+	counts := make(map[string]int)
+	for _, task := range tasks {
+		if task.DeletedAt != nil || task.Archived || task.expired(now) {
+			continue
+		}
+		for _, tag := range task.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	slices.SortFunc(tags, func(a, b TagCount) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Tag, b.Tag)
+	})
+	respondJSON(w, http.StatusOK, tags)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetTagsHandler(t *testing.T) {
+	router, store := setupRouter()
+	deletedAt := time.Now()
+	store.tasks["1"] = Task{ID: "1", Name: "A", Tags: []string{"work", "urgent"}}
+	store.tasks["2"] = Task{ID: "2", Name: "B", Tags: []string{"work"}}
+	store.tasks["3"] = Task{ID: "3", Name: "C", Tags: []string{"home", "errand"}}
+	store.tasks["4"] = Task{ID: "4", Name: "Trashed", Tags: []string{"home", "trash"}, DeletedAt: &deletedAt}
+	store.tasks["5"] = Task{ID: "5", Name: "Archived", Tags: []string{"archive"}, Archived: true}
+
+	req, _ := http.NewRequest("GET", "/tasks/tags", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var tags []TagCount
+	if err := json.Unmarshal(rr.Body.Bytes(), &tags); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	want := []TagCount{{"work", 2}, {"errand", 1}, {"home", 1}, {"urgent", 1}}
+	if !slices.Equal(tags, want) {
+		t.Errorf("handler returned %v, want %v", tags, want)
+	}
+}
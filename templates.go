@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxTemplateTasks bounds how many tasks a template may hold.
+const maxTemplateTasks = 100
+
+// Template is a named set of task definitions, such as an onboarding
+// checklist, that can be applied to create all of its tasks at once.
+type Template struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Tasks     []TemplateTask `json:"tasks"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// TemplateTask defines one task of a template. It holds the fields of a task
+// that make sense to repeat; the rest are set when the template is applied.
+type TemplateTask struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Priority    int      `json:"priority"`
+	Tags        []string `json:"tags,omitempty"`
+	Assignee    string   `json:"assignee,omitempty"`
+	Recurrence  string   `json:"recurrence,omitempty"`
+}
+
+// TemplateInput is the body of a request creating a template.
+type TemplateInput struct {
+	Name  string            `json:"name"`
+	Tasks []json.RawMessage `json:"tasks"`
+}
+
+// TemplateList is the response body listing templates.
+type TemplateList struct {
+	Templates []Template `json:"templates"`
+	Total     int        `json:"total"`
+}
+
+// templateTask returns the task a template definition describes, with the
+// configured default status, ready for prepareNewTask.
+func (h *Handlers) templateTask(def TemplateTask) Task {
+	task := h.newTask()
+	task.Name = def.Name
+	task.Description = def.Description
+	task.Priority = def.Priority
+	task.Tags = slices.Clone(def.Tags)
+	task.Assignee = def.Assignee
+	task.Recurrence = def.Recurrence
+	return task
+}
+
+// getTemplatesHandler lists the templates, sorted by name.
+func (h *Handlers) getTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	templates, err := h.store.Templates(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	slices.SortFunc(templates, func(a, b Template) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	respondJSON(w, http.StatusOK, TemplateList{Templates: templates, Total: len(templates)})
+}
+
+// getTemplateHandler returns a single template.
+func (h *Handlers) getTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, err := h.store.Template(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.templateError(r.Context(), w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, template)
+}
+
+// createTemplateHandler stores a new template. Its task definitions are
+// normalized and validated as tasks would be, so applying it cannot fail on
+// their account.
+func (h *Handlers) createTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var input TemplateInput
+	if err := decodeJSON(r, &input); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	template := Template{
+		ID:        uuid.New().String(),
+		Name:      strings.TrimSpace(h.sanitize(input.Name)),
+		Tasks:     make([]TemplateTask, len(input.Tasks)),
+		CreatedAt: time.Now().UTC(),
+	}
+	if template.Name == "" {
+		respondError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	if err := validateLength("Name", template.Name, maxNameLength); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(input.Tasks) == 0 || len(input.Tasks) > maxTemplateTasks {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Tasks must list between 1 and %d tasks", maxTemplateTasks))
+		return
+	}
+	for i, item := range input.Tasks {
+		def, err := h.decodeTemplateTask(item)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Task at index %d: %v", i, err))
+			return
+		}
+		template.Tasks[i] = def
+	}
+
+	if err := h.store.AddTemplate(r.Context(), template); err != nil {
+		h.templateError(r.Context(), w, err)
+		return
+	}
+	w.Header().Set("Location", "/templates/"+template.ID)
+	respondJSON(w, http.StatusCreated, template)
+}
+
+// decodeTemplateTask decodes, normalizes and validates one task definition of
+// a template. A definition that omits the priority gets the configured
+// default.
+func (h *Handlers) decodeTemplateTask(data json.RawMessage) (TemplateTask, error) {
+	def := TemplateTask{Priority: h.defaultPriority}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&def); err != nil {
+		return TemplateTask{}, errors.New(payloadError(err))
+	}
+	task := h.templateTask(def)
+	h.sanitizeTask(&task)
+	normalizeTask(&task)
+	if err := validateTask(task); err != nil {
+		return TemplateTask{}, err
+	}
+	return TemplateTask{
+		Name:        task.Name,
+		Description: task.Description,
+		Priority:    task.Priority,
+		Tags:        task.Tags,
+		Assignee:    task.Assignee,
+		Recurrence:  task.Recurrence,
+	}, nil
+}
+
+// applyTemplateHandler creates every task of a template, each with a fresh
+// ID, in one atomic step, placing them last in the manual order in the order
+// the template lists them.
+func (h *Handlers) applyTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	template, err := h.store.Template(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		h.templateError(r.Context(), w, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	tasks := make([]Task, len(template.Tasks))
+	for i, def := range template.Tasks {
+		tasks[i] = h.templateTask(def)
+		if err := h.prepareNewTask(&tasks[i], now); err != nil {
+			h.storeError(r.Context(), w, err)
+			return
+		}
+	}
+	if !h.checkCapacity(r.Context(), w, len(tasks)) {
+		return
+	}
+	position, err := h.nextPosition(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	for i := range tasks {
+		tasks[i].Position = position + float64(i)*positionGap
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, tasks)
+		return
+	}
+	if err := h.store.Create(r.Context(), tasks...); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	h.publish(eventCreated, tasks...)
+	respondJSON(w, http.StatusCreated, tasks)
+}
+
+// templateError is storeError for template requests, where ErrNotFound means
+// the template is missing.
+func (h *Handlers) templateError(ctx context.Context, w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		respondError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+	h.storeError(ctx, w, err)
+}
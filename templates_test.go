@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["1"] = Task{ID: "1", Name: "Existing", Position: 1}
+
+	body := `{"name": " Onboarding ", "tasks": [{"name": "Get a laptop", "tags": ["IT"]}, {"name": "Meet the team", "priority": 2, "assignee": "Alice"}]}`
+	req, _ := http.NewRequest("POST", "/templates", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusCreated, rr.Body)
+	}
+	var template Template
+	if err := json.Unmarshal(rr.Body.Bytes(), &template); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if template.Name != "Onboarding" || len(template.Tasks) != 2 || template.Tasks[0].Tags[0] != "it" || template.Tasks[1].Priority != 2 {
+		t.Errorf("handler stored wrong template: %+v", template)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/templates/"+template.ID {
+		t.Errorf("handler returned wrong Location: got %q", loc)
+	}
+
+	req, _ = http.NewRequest("GET", "/templates", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var list TemplateList
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || list.Total != 1 || list.Templates[0].ID != template.ID {
+		t.Errorf("handler listed %+v, %v", list, err)
+	}
+
+	for range 2 {
+		req, _ = http.NewRequest("POST", "/templates/"+template.ID+"/apply", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusCreated, rr.Body)
+		}
+	}
+	var tasks []Task
+	if err := json.Unmarshal(rr.Body.Bytes(), &tasks); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Name != "Get a laptop" || tasks[1].Assignee != "Alice" || tasks[1].Position <= tasks[0].Position || tasks[0].Position <= 1 {
+		t.Errorf("applying the template created wrong tasks: %+v", tasks)
+	}
+	if len(store.tasks) != 5 {
+		t.Errorf("applying the template twice left %d tasks, want 5", len(store.tasks))
+	}
+	for _, task := range tasks {
+		if stored := store.tasks[task.ID]; stored.Name != task.Name || stored.Version != 1 {
+			t.Errorf("store holds %+v for created task %+v", stored, task)
+		}
+	}
+}
+
+func TestTemplatesErrors(t *testing.T) {
+	router, store := setupRouter()
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/templates", `{"name": "", "tasks": [{"name": "A"}]}`, http.StatusBadRequest},
+		{"POST", "/templates", `{"name": "Empty", "tasks": []}`, http.StatusBadRequest},
+		{"POST", "/templates", `{"name": "Bad", "tasks": [{"name": "A"}, {"name": "B", "priority": 7}]}`, http.StatusBadRequest},
+		{"POST", "/templates", `{"name": "Bad", "tasks": [{"name": "A", "due_date": "2024-01-01T00:00:00Z"}]}`, http.StatusBadRequest},
+		{"GET", "/templates/missing", ``, http.StatusNotFound},
+		{"POST", "/templates/missing/apply", ``, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s %s returned %v, want %v: %s", tt.method, tt.path, tt.body, rr.Code, tt.want, rr.Body)
+		}
+	}
+	if len(store.templates) != 0 {
+		t.Errorf("invalid templates were stored: %+v", store.templates)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// tenantHeader names the tenant a request acts for when MULTI_TENANT is on.
+const tenantHeader = "X-Tenant-ID"
+
+// tenantIDPattern matches valid tenant IDs. They become part of file names,
+// so they are kept to characters that are safe there.
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// tenantFreePaths are served without a tenant, as they are about the server
+// rather than anyone's tasks.
+var tenantFreePaths = map[string]bool{
+	"/healthz":      true,
+	"/readyz":       true,
+	"/version":      true,
+	"/metrics":      true,
+	"/openapi.json": true,
+}
+
+// Errors returned by tenantRouter.router for tenants it will not set up.
+var (
+	errUnknownTenant  = errors.New("unknown tenant")
+	errTooManyTenants = errors.New("too many tenants")
+)
+
+// tenant is what a tenantRouter keeps for each tenant it has served. ready
+// is closed once the tenant has been set up, or has failed to be; handlers
+// and router are only set in the first case.
+type tenant struct {
+	ready    chan struct{}
+	handlers *Handlers
+	router   http.Handler
+	err      error
+}
+
+// tenantRouter isolates tenants from each other when MULTI_TENANT is on. Each
+// tenant gets its own Handlers, with its own store, event stream, activity
+// log and idempotency keys, and its own router in front of them, created on
+// the tenant's first request. Requests are passed to the router of the
+// tenant their X-Tenant-ID header names; those without one get 400, except
+// CORS preflights, which browsers send without custom headers, and
+// tenantFreePaths, which go to base. Only the tenants in allowed are served
+// if it is not nil, and no more than maxTenants are set up, so clients
+// cannot open stores without bound. Requests for tenants pass through guard,
+// which authenticates them, before a tenant is looked up or set up, so
+// unauthenticated clients can neither use up tenants nor probe which exist.
+type tenantRouter struct {
+	base       http.Handler
+	guarded    http.Handler
+	open       func(tenant string) (*Handlers, http.Handler, error)
+	logger     *slog.Logger
+	allowed    map[string]bool
+	maxTenants int
+
+	mu      sync.Mutex
+	tenants map[string]*tenant
+}
+
+// newTenantRouter returns a tenantRouter that sets up new tenants with open,
+// behind the middleware guard. It serves only the tenants listed in allowed,
+// or any if allowed is empty, up to maxTenants of them.
+func newTenantRouter(base http.Handler, open func(tenant string) (*Handlers, http.Handler, error), guard func(http.Handler) http.Handler, allowed []string, maxTenants int, logger *slog.Logger) *tenantRouter {
+	t := &tenantRouter{base: base, open: open, logger: logger, maxTenants: maxTenants, tenants: make(map[string]*tenant)}
+	t.guarded = guard(http.HandlerFunc(t.serveTenant))
+	if len(allowed) > 0 {
+		t.allowed = make(map[string]bool, len(allowed))
+		for _, id := range allowed {
+			t.allowed[id] = true
+		}
+	}
+	return t
+}
+
+func (t *tenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodOptions || tenantFreePaths[r.URL.Path] {
+		t.base.ServeHTTP(w, r)
+		return
+	}
+	t.guarded.ServeHTTP(w, r)
+}
+
+// serveTenant passes a request to the router of the tenant it names.
+func (t *tenantRouter) serveTenant(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(tenantHeader)
+	if id == "" {
+		respondError(w, http.StatusBadRequest, tenantHeader+" header is required")
+		return
+	}
+	if !tenantIDPattern.MatchString(id) {
+		respondError(w, http.StatusBadRequest, tenantHeader+" must be 1 to 64 letters, digits, hyphens or underscores")
+		return
+	}
+	router, err := t.router(id)
+	if errors.Is(err, errUnknownTenant) {
+		respondError(w, http.StatusForbidden, "Unknown tenant")
+		return
+	}
+	if errors.Is(err, errTooManyTenants) {
+		respondError(w, http.StatusInsufficientStorage, "Tenant limit reached")
+		return
+	}
+	if err != nil {
+		t.logger.ErrorContext(r.Context(), "Failed to open tenant", "tenant", id, "error", err)
+		respondError(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	router.ServeHTTP(w, r)
+}
+
+// router returns the router of the tenant with the given ID, setting the
+// tenant up if this is its first request. Setting up opens and may seed a
+// store, so it happens outside t.mu; other requests for the same tenant wait
+// for it, and those for other tenants are not held up. A tenant that fails
+// to be set up is forgotten, so the next request tries again.
+func (t *tenantRouter) router(id string) (http.Handler, error) {
+	t.mu.Lock()
+	tn, ok := t.tenants[id]
+	if !ok {
+		if t.allowed != nil && !t.allowed[id] {
+			t.mu.Unlock()
+			return nil, errUnknownTenant
+		}
+		if len(t.tenants) >= t.maxTenants {
+			t.mu.Unlock()
+			return nil, errTooManyTenants
+		}
+		tn = &tenant{ready: make(chan struct{})}
+		t.tenants[id] = tn
+	}
+	t.mu.Unlock()
+
+	if ok {
+		<-tn.ready
+		return tn.router, tn.err
+	}
+
+	h, router, err := t.open(id)
+	t.mu.Lock()
+	if err != nil {
+		tn.err = err
+		delete(t.tenants, id)
+	} else {
+		tn.handlers, tn.router = h, router
+	}
+	t.mu.Unlock()
+	close(tn.ready)
+	return router, err
+}
+
+// stores returns the store of every tenant set up so far.
+func (t *tenantRouter) stores() []Store {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stores := make([]Store, 0, len(t.tenants))
+	for _, tn := range t.tenants {
+		if tn.handlers != nil {
+			stores = append(stores, tn.handlers.store)
+		}
+	}
+	return stores
+}
+
+// close closes the store of every tenant, logging any that fail.
+func (t *tenantRouter) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, tn := range t.tenants {
+		if tn.handlers == nil {
+			continue
+		}
+		if err := tn.handlers.store.Close(); err != nil {
+			t.logger.Error("Failed to close store", "tenant", id, "error", err)
+		}
+	}
+}
+
+// openTenantStore opens the store of a tenant: the memory or SQLite store the
+// configuration selects, kept in a file of its own named after the tenant.
+func openTenantStore(cfg Config, tenant string) (Store, error) {
+	if cfg.SQLitePath != "" {
+		return NewSQLiteStore(tenantPath(cfg.SQLitePath, tenant))
+	}
+	return NewMemoryStore(tenantPath(cfg.TasksFile, tenant))
+}
+
+// tenantPath returns the file a tenant's store is kept in, given the file
+// the store would be kept in without tenants: "tasks.json" becomes
+// "tasks.acme.json" for tenant acme. Stores that are not kept in a file stay
+// that way.
+func tenantPath(path, tenant string) string {
+	if path == "" || path == ":memory:" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + tenant + ext
+}
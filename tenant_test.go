@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestTenantRouter returns a tenantRouter whose tenants keep their tasks
+// in memory.
+func newTestTenantRouter(t *testing.T) *tenantRouter {
+	t.Helper()
+	base := http.NewServeMux()
+	base.HandleFunc("GET /healthz", healthHandler)
+	base.HandleFunc("OPTIONS /", preflightHandler)
+	return newTenantRouter(base, func(tenant string) (*Handlers, http.Handler, error) {
+		store, err := openTenantStore(Config{}, tenant)
+		if err != nil {
+			return nil, nil, err
+		}
+		h := &Handlers{store: store, ids: uuidGenerator{}, tenant: tenant}
+		router := http.NewServeMux()
+		router.HandleFunc("GET /tasks", h.getTasksHandler)
+		router.HandleFunc("POST /tasks", h.createTaskHandler)
+		return h, router, nil
+	}, authMiddleware(""), nil, 10, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestTenantRouter(t *testing.T) {
+	tenants := newTestTenantRouter(t)
+
+	for _, tenant := range []string{"acme", "globex", "acme"} {
+		req, _ := http.NewRequest("POST", "/tasks", strings.NewReader(`{"name": "Task of `+tenant+`"}`))
+		req.Header.Set(tenantHeader, tenant)
+		rr := httptest.NewRecorder()
+		tenants.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("handler returned wrong status code: got %v want %v: %s", rr.Code, http.StatusCreated, rr.Body)
+		}
+	}
+
+	for tenant, want := range map[string]int{"acme": 2, "globex": 1, "initech": 0} {
+		req, _ := http.NewRequest("GET", "/tasks", nil)
+		req.Header.Set(tenantHeader, tenant)
+		rr := httptest.NewRecorder()
+		tenants.ServeHTTP(rr, req)
+		var list TaskList
+		if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+			t.Fatalf("Could not parse response body: %v", err)
+		}
+		if list.Total != want {
+			t.Errorf("tenant %s sees %d tasks, want %d", tenant, list.Total, want)
+		}
+		for _, task := range list.Tasks {
+			if task.Name != "Task of "+tenant {
+				t.Errorf("tenant %s sees %q", tenant, task.Name)
+			}
+		}
+	}
+	if n := len(tenants.stores()); n != 3 {
+		t.Errorf("router set up %d tenants, want 3", n)
+	}
+}
+
+func TestTenantRouterRequiresTenant(t *testing.T) {
+	tenants := newTestTenantRouter(t)
+
+	tests := []struct {
+		method, path, tenant string
+		want                 int
+	}{
+		{"GET", "/tasks", "", http.StatusBadRequest},
+		{"GET", "/tasks", "../etc", http.StatusBadRequest},
+		{"GET", "/tasks", strings.Repeat("a", 65), http.StatusBadRequest},
+		{"GET", "/healthz", "", http.StatusOK},
+		{"OPTIONS", "/tasks", "", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.path, nil)
+		if tt.tenant != "" {
+			req.Header.Set(tenantHeader, tt.tenant)
+		}
+		rr := httptest.NewRecorder()
+		tenants.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s %s for tenant %q returned %v, want %v", tt.method, tt.path, tt.tenant, rr.Code, tt.want)
+		}
+	}
+	if n := len(tenants.stores()); n != 0 {
+		t.Errorf("router set up %d tenants for invalid requests", n)
+	}
+}
+
+func TestTenantRouterLimits(t *testing.T) {
+	tenants := newTestTenantRouter(t)
+	tenants.maxTenants = 2
+	tenants.allowed = map[string]bool{"acme": true, "globex": true, "initech": true}
+
+	tests := []struct {
+		tenant string
+		want   int
+	}{
+		{"umbrella", http.StatusForbidden},
+		{"acme", http.StatusOK},
+		{"globex", http.StatusOK},
+		{"initech", http.StatusInsufficientStorage},
+		{"acme", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/tasks", nil)
+		req.Header.Set(tenantHeader, tt.tenant)
+		rr := httptest.NewRecorder()
+		tenants.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("request for tenant %q returned %v, want %v", tt.tenant, rr.Code, tt.want)
+		}
+	}
+	if n := len(tenants.stores()); n != 2 {
+		t.Errorf("router set up %d tenants, want 2", n)
+	}
+}
+
+func TestTenantRouterAuthenticatesFirst(t *testing.T) {
+	tenants := newTestTenantRouter(t)
+	tenants.guarded = authMiddleware("secret")(http.HandlerFunc(tenants.serveTenant))
+	tenants.allowed = map[string]bool{"acme": true}
+
+	tests := []struct {
+		tenant, token string
+		want          int
+	}{
+		{"acme", "", http.StatusUnauthorized},
+		{"umbrella", "", http.StatusUnauthorized},
+		{"acme", "wrong", http.StatusUnauthorized},
+		{"acme", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/tasks", nil)
+		req.Header.Set(tenantHeader, tt.tenant)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rr := httptest.NewRecorder()
+		tenants.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("request for tenant %q with token %q returned %v, want %v", tt.tenant, tt.token, rr.Code, tt.want)
+		}
+		if tt.want == http.StatusUnauthorized && len(tenants.tenants) != 0 {
+			t.Errorf("unauthenticated request for tenant %q set up a tenant", tt.tenant)
+		}
+	}
+}
+
+func TestTenantRouterOpensOutsideLock(t *testing.T) {
+	var opened atomic.Int32
+	release := make(chan struct{})
+	tenants := newTenantRouter(http.NotFoundHandler(), func(tenant string) (*Handlers, http.Handler, error) {
+		opened.Add(1)
+		if tenant == "slow" {
+			<-release
+		}
+		store, _ := NewMemoryStore("")
+		return &Handlers{store: store}, http.NotFoundHandler(), nil
+	}, authMiddleware(""), nil, 10, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tenants.router("slow"); err != nil {
+				t.Errorf("router returned error: %v", err)
+			}
+		}()
+	}
+
+	// Another tenant is set up while the slow one is still opening.
+	done := make(chan struct{})
+	go func() {
+		tenants.router("fast")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("setting up a tenant waited for another")
+	}
+	close(release)
+	wg.Wait()
+	if n := opened.Load(); n != 2 {
+		t.Errorf("tenants were opened %d times, want 2", n)
+	}
+}
+
+func TestTenantRouterRetriesFailedOpen(t *testing.T) {
+	fail := true
+	tenants := newTenantRouter(http.NotFoundHandler(), func(tenant string) (*Handlers, http.Handler, error) {
+		if fail {
+			return nil, nil, errors.New("disk full")
+		}
+		store, _ := NewMemoryStore("")
+		return &Handlers{store: store}, http.NotFoundHandler(), nil
+	}, authMiddleware(""), nil, 1, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if _, err := tenants.router("acme"); err == nil {
+		t.Fatal("router did not return the open error")
+	}
+	fail = false
+	if _, err := tenants.router("acme"); err != nil {
+		t.Errorf("router did not retry a failed tenant: %v", err)
+	}
+}
+
+func TestTenantPath(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"", ""},
+		{":memory:", ":memory:"},
+		{"tasks.json", "tasks.acme.json"},
+		{filepath.Join("data", "tasks.db"), filepath.Join("data", "tasks.acme.db")},
+		{"tasks", "tasks.acme"},
+	}
+	for _, tt := range tests {
+		if got := tenantPath(tt.path, "acme"); got != tt.want {
+			t.Errorf("tenantPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// httpsRedirectHandler redirects every request to the same host and path on
+// the HTTPS listener at tlsAddr. 308 is used so clients repeat the method and
+// body rather than turning a POST into a GET.
+func httpsRedirectHandler(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		switch {
+		case port != "" && port != "443":
+			host = net.JoinHostPort(host, port)
+		case strings.Contains(host, ":"): // a bare IPv6 address
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
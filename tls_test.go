@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		tlsAddr string
+		host    string
+		target  string
+		want    string
+	}{
+		{":8443", "example.com", "/tasks?limit=5", "https://example.com:8443/tasks?limit=5"},
+		{":8443", "example.com:8080", "/tasks", "https://example.com:8443/tasks"},
+		{":443", "example.com:80", "/tasks/1", "https://example.com/tasks/1"},
+		{":443", "[::1]:80", "/healthz", "https://[::1]/healthz"},
+		{":8443", "[::1]:80", "/healthz", "https://[::1]:8443/healthz"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", tt.target, nil)
+		req.Host = tt.host
+		rr := httptest.NewRecorder()
+		httpsRedirectHandler(tt.tlsAddr).ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusPermanentRedirect {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusPermanentRedirect)
+		}
+		if location := rr.Header().Get("Location"); location != tt.want {
+			t.Errorf("redirect of %s%s to %s went to %q, want %q", tt.host, tt.target, tt.tlsAddr, location, tt.want)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// TaskOperation is one step of a transaction.
+type TaskOperation struct {
+	Op   string          `json:"op"`             // "create", "update" or "delete"
+	ID   string          `json:"id,omitempty"`   // the task updated or deleted
+	Task json.RawMessage `json:"task,omitempty"` // the task created, or the patch applied
+}
+
+// OperationResult is the task as one operation of a transaction left it.
+type OperationResult struct {
+	Op   string `json:"op"`
+	ID   string `json:"id"`
+	Task Task   `json:"task"`
+}
+
+// transactionHandler applies a list of operations in order, all or nothing.
+// Each sees the changes of those before it, so a task can be created and
+// then depended on, and each is validated as its own endpoint would: create
+// like POST /tasks, update like PATCH /tasks/{id} and delete, to the trash,
+// like DELETE /tasks/{id}. The operations run against a copy of the stored
+// tasks, and only once all succeed are the changes committed, failing with
+// 409 if another request changed one of the tasks meanwhile.
+func (h *Handlers) transactionHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun, err := parseDryRun(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req struct {
+		Operations []TaskOperation `json:"operations"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		respondPayloadError(w, err)
+		return
+	}
+	if len(req.Operations) == 0 {
+		respondError(w, http.StatusBadRequest, "Operations must not be empty")
+		return
+	}
+
+	all, err := h.store.GetAll(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	projects, err := h.store.Projects(r.Context())
+	if err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	scratch, _ := NewMemoryStore("")
+	versions := make(map[string]int, len(all))
+	for _, task := range all {
+		scratch.tasks[task.ID] = task
+		versions[task.ID] = task.Version
+	}
+	// Operations only change tasks, but validating them reads projects.
+	for _, project := range projects {
+		scratch.projects[project.ID] = project
+	}
+	tx := *h
+	tx.store = scratch
+
+	now := time.Now().UTC()
+	results := make([]OperationResult, len(req.Operations))
+	var changed []string
+	for i, op := range req.Operations {
+		task, ok := tx.applyOperation(r.Context(), w, i, op, now)
+		if !ok {
+			return
+		}
+		results[i] = OperationResult{Op: op.Op, ID: task.ID, Task: task}
+		if !slices.Contains(changed, task.ID) {
+			changed = append(changed, task.ID)
+		}
+	}
+	if dryRun {
+		respondJSON(w, http.StatusOK, map[string][]OperationResult{"results": results})
+		return
+	}
+
+	changes := make([]TaskChange, len(changed))
+	for i, id := range changed {
+		changes[i] = TaskChange{Task: scratch.tasks[id], Version: versions[id]}
+	}
+	if err := h.store.Commit(r.Context(), changes); err != nil {
+		h.storeError(r.Context(), w, err)
+		return
+	}
+	for _, result := range results {
+		h.publish(operationEvents[result.Op], result.Task)
+	}
+	respondJSON(w, http.StatusOK, map[string][]OperationResult{"results": results})
+}
+
+// operationEvents maps transaction operations to the events they publish.
+var operationEvents = map[string]string{
+	"create": eventCreated,
+	"update": eventUpdated,
+	"delete": eventDeleted,
+}
+
+// applyOperation applies operation i of a transaction to h.store, returning
+// the task it changed. Otherwise it responds with the error, naming the
+// operation, and returns false.
+func (h *Handlers) applyOperation(ctx context.Context, w http.ResponseWriter, i int, op TaskOperation, now time.Time) (Task, bool) {
+	switch op.Op {
+	case "create":
+		if op.ID != "" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Operation %d: Id cannot be set on a create; put it in the task", i))
+			return Task{}, false
+		}
+		return h.createOperation(ctx, w, i, op, now)
+	case "update", "delete":
+		if op.ID == "" {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Operation %d: Id is required", i))
+			return Task{}, false
+		}
+		if op.Op == "delete" {
+			return h.deleteOperation(ctx, w, i, op, now)
+		}
+		return h.updateOperation(ctx, w, i, op, now)
+	default:
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Operation %d: Op must be create, update or delete", i))
+		return Task{}, false
+	}
+}
+
+func (h *Handlers) createOperation(ctx context.Context, w http.ResponseWriter, i int, op TaskOperation, now time.Time) (Task, bool) {
+	task := h.newTask()
+	if !decodeOperationTask(w, i, op, taskSchema, &task) {
+		return Task{}, false
+	}
+	h.sanitizeTask(&task)
+	normalizeTask(&task)
+	if err := validateTask(task); err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Operation %d: %v", i, err))
+		return Task{}, false
+	}
+	if task.ParentID != nil {
+		if err := h.validateParent(ctx, "", *task.ParentID); err != nil {
+			h.parentError(ctx, w, fmt.Errorf("Operation %d: %w", i, err))
+			return Task{}, false
+		}
+	}
+	if err := h.validateDependencies(ctx, "", task.DependsOn); err != nil {
+		h.dependencyError(ctx, w, fmt.Errorf("Operation %d: %w", i, err))
+		return Task{}, false
+	}
+	if err := h.validateProject(ctx, task.ProjectID); err != nil {
+		h.projectError(ctx, w, fmt.Errorf("Operation %d: %w", i, err))
+		return Task{}, false
+	}
+	if err := h.checkNewCompletion(ctx, task); err != nil {
+		h.storeError(ctx, w, fmt.Errorf("Operation %d: %w", i, err))
+		return Task{}, false
+	}
+	if err := h.prepareNewTask(&task, now); err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Operation %d: %v", i, err))
+		return Task{}, false
+	}
+	if !h.checkCapacity(ctx, w, 1) {
+		return Task{}, false
+	}
+	var err error
+	if task.Position, err = h.nextPosition(ctx); err != nil {
+		h.storeError(ctx, w, err)
+		return Task{}, false
+	}
+	if err := h.store.Create(ctx, task); err != nil {
+		h.storeError(ctx, w, fmt.Errorf("Operation %d: %w", i, err))
+		return Task{}, false
+	}
+	return task, true
+}
+
+func (h *Handlers) updateOperation(ctx context.Context, w http.ResponseWriter, i int, op TaskOperation, now time.Time) (Task, bool) {
+	var patch TaskPatch
+	if !decodeOperationTask(w, i, op, taskPatchSchema, &patch) {
+		return Task{}, false
+	}
+	h.sanitizePatch(&patch)
+	if err := normalizePatch(&patch); err != nil {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Operation %d: %v", i, err))
+		return Task{}, false
+	}
+	if patch.ParentID != nil && *patch.ParentID != "" {
+		if err := h.validateParent(ctx, op.ID, *patch.ParentID); err != nil {
+			h.parentError(ctx, w, fmt.Errorf("Operation %d: %w", i, err))
+			return Task{}, false
+		}
+	}
+	if patch.DependsOn != nil {
+		if err := h.validateDependencies(ctx, op.ID, *patch.DependsOn); err != nil {
+			h.dependencyError(ctx, w, fmt.Errorf("Operation %d: %w", i, err))
+			return Task{}, false
+		}
+	}
+	if patch.ProjectID != nil {
+		if err := h.validateProject(ctx, *patch.ProjectID); err != nil {
+			h.projectError(ctx, w, fmt.Errorf("Operation %d: %w", i, err))
+			return Task{}, false
+		}
+	}
+	incomplete, err := h.patchBlockingTasks(ctx, patch)
+	if err != nil {
+		h.storeError(ctx, w, err)
+		return Task{}, false
+	}
+
+	task, err := h.store.Update(ctx, op.ID, func(task *Task) error {
+		if task.DeletedAt != nil {
+			return ErrNotFound
+		}
+		was := task.Status
+		applyPatch(task, patch)
+		if err := completionBlocked(was, *task, incomplete); err != nil {
+			return err
+		}
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		h.operationError(ctx, w, i, op, err)
+		return Task{}, false
+	}
+	return task, true
+}
+
+func (h *Handlers) deleteOperation(ctx context.Context, w http.ResponseWriter, i int, op TaskOperation, now time.Time) (Task, bool) {
+	if len(op.Task) > 0 {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Operation %d: A delete takes no task", i))
+		return Task{}, false
+	}
+	if h.blockedBySubtasks(ctx, w, op.ID, false) {
+		return Task{}, false
+	}
+	task, err := h.store.Update(ctx, op.ID, func(task *Task) error {
+		if task.DeletedAt != nil {
+			return ErrNotFound
+		}
+		task.DeletedAt = &now
+		task.UpdatedAt = now
+		task.Version++
+		return nil
+	})
+	if err != nil {
+		h.operationError(ctx, w, i, op, err)
+		return Task{}, false
+	}
+	return task, true
+}
+
+// decodeOperationTask decodes the task of operation i into v, checking it
+// against schema. Otherwise it responds with the error and returns false.
+func decodeOperationTask(w http.ResponseWriter, i int, op TaskOperation, schema *jsonschema.Schema, v any) bool {
+	if len(op.Task) == 0 {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Operation %d: Task is required", i))
+		return false
+	}
+	if err := decodeValidated(op.Task, schema, v); err != nil {
+		var schemaErr *schemaError
+		if errors.As(err, &schemaErr) {
+			schemaErr.subject = fmt.Sprintf("Operation %d", i)
+			respondSchemaError(w, schemaErr)
+			return false
+		}
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Operation %d: %s", i, payloadError(err)))
+		return false
+	}
+	return true
+}
+
+// operationError writes the response for an error updating the task of
+// operation i.
+func (h *Handlers) operationError(ctx context.Context, w http.ResponseWriter, i int, op TaskOperation, err error) {
+	if errors.Is(err, ErrNotFound) {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Operation %d: Task %s not found", i, op.ID))
+		return
+	}
+	h.storeError(ctx, w, fmt.Errorf("Operation %d: %w", i, err))
+}
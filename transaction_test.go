@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransactionHandler(t *testing.T) {
+	router, store := setupRouter()
+	store.tasks["a"] = Task{ID: "a", Name: "A", Version: 1}
+	store.tasks["b"] = Task{ID: "b", Name: "B", Version: 1}
+
+	const newID = "9b2f5a3e-7c1d-4e8a-9f60-2d4b8c7e1a05"
+	body := `{"operations": [
+		{"op": "create", "task": {"id": "` + newID + `", "name": "New"}},
+		{"op": "update", "id": "a", "task": {"depends_on": ["` + newID + `"]}},
+		{"op": "update", "id": "a", "task": {"priority": 2}},
+		{"op": "delete", "id": "b"}
+	]}`
+	req, _ := http.NewRequest("POST", "/tasks/transaction", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+	var resp struct {
+		Results []OperationResult `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if len(resp.Results) != 4 || resp.Results[0].ID != newID || resp.Results[1].Task.Priority != 0 || resp.Results[3].Op != "delete" {
+		t.Fatalf("handler returned wrong results: %+v", resp.Results)
+	}
+
+	if _, ok := store.tasks[newID]; !ok {
+		t.Errorf("created task was not stored")
+	}
+	if a := store.tasks["a"]; len(a.DependsOn) != 1 || a.Priority != 2 || a.Version != 3 {
+		t.Errorf("updates were not stored: %+v", a)
+	}
+	if store.tasks["b"].DeletedAt == nil {
+		t.Errorf("deleted task was not moved to the trash")
+	}
+}
+
+func TestTransactionHandlerProject(t *testing.T) {
+	router, store := setupRouter()
+	store.projects["p1"] = Project{ID: "p1", Name: "Release"}
+	store.tasks["a"] = Task{ID: "a", Name: "A", Version: 1}
+
+	body := `{"operations": [
+		{"op": "create", "task": {"name": "New", "project_id": "p1"}},
+		{"op": "update", "id": "a", "task": {"project_id": "p1"}}
+	]}`
+	req, _ := http.NewRequest("POST", "/tasks/transaction", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v: %s", status, http.StatusOK, rr.Body)
+	}
+	if len(store.tasks) != 2 {
+		t.Fatalf("created task was not stored: %+v", store.tasks)
+	}
+	for id, task := range store.tasks {
+		if task.ProjectID != "p1" {
+			t.Errorf("task %s was not put in the project: %+v", id, task)
+		}
+	}
+}
+
+func TestTransactionHandlerRollsBack(t *testing.T) {
+	tests := []struct {
+		name string
+		op   string
+		want int
+	}{
+		{"missing task", `{"op": "update", "id": "missing", "task": {"name": "X"}}`, http.StatusNotFound},
+		{"invalid patch", `{"op": "update", "id": "a", "task": {"name": ""}}`, http.StatusBadRequest},
+		{"unknown op", `{"op": "rename", "id": "a"}`, http.StatusBadRequest},
+		{"deleted task", `{"op": "delete", "id": "a"}, {"op": "update", "id": "a", "task": {"priority": 1}}`, http.StatusNotFound},
+		{"missing project", `{"op": "update", "id": "a", "task": {"project_id": "missing"}}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, store := setupRouter()
+			store.tasks["a"] = Task{ID: "a", Name: "A", Version: 1}
+
+			body := `{"operations": [{"op": "create", "task": {"name": "New"}}, ` + tt.op + `]}`
+			req, _ := http.NewRequest("POST", "/tasks/transaction", strings.NewReader(body))
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if status := rr.Code; status != tt.want {
+				t.Errorf("handler returned wrong status code: got %v want %v: %s", status, tt.want, rr.Body)
+			}
+			if !strings.Contains(rr.Body.String(), "Operation ") {
+				t.Errorf("error does not name the operation: %s", rr.Body)
+			}
+			if len(store.tasks) != 1 || store.tasks["a"].Version != 1 {
+				t.Errorf("failed transaction changed the store: %+v", store.tasks)
+			}
+		})
+	}
+}
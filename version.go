@@ -0,0 +1,30 @@
+package main
+
+import "net/http"
+
+// Build information, set at link time with for example
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// BuildInfo identifies the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// buildInfo returns the build information linked into the binary.
+func buildInfo() BuildInfo {
+	return BuildInfo{Version: version, Commit: commit, BuildTime: buildTime}
+}
+
+// versionHandler reports which build is running, so operators can check a
+// deployment picked up the binary they expect.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, buildInfo())
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	version, commit, buildTime = "1.2.0", "abc123", "2024-05-01T12:00:00Z"
+	t.Cleanup(func() { version, commit, buildTime = "dev", "unknown", "unknown" })
+
+	router, _ := setupRouter()
+	req, _ := http.NewRequest("GET", "/version", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var info BuildInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Could not parse response body: %v", err)
+	}
+	if info != (BuildInfo{Version: "1.2.0", Commit: "abc123", BuildTime: "2024-05-01T12:00:00Z"}) {
+		t.Errorf("handler returned wrong build info: got %+v", info)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Webhook delivery limits. Events arriving while the queue is full are
+// dropped, like those for a slow event stream client.
+const (
+	webhookQueueSize   = 256
+	webhookWorkers     = 4
+	webhookMaxAttempts = 3
+)
+
+// webhookPayload is the JSON body POSTed to the webhook for each event.
+type webhookPayload struct {
+	Event  string `json:"event"`
+	Tenant string `json:"tenant,omitempty"` // set with MULTI_TENANT on
+	Task   Task   `json:"task"`
+}
+
+// webhookNotifier POSTs task events to a URL.
+type webhookNotifier struct {
+	url        string
+	client     *http.Client
+	retryDelay time.Duration // doubled after each failed attempt
+	logger     *slog.Logger
+	tenant     string // whose events these are, with MULTI_TENANT on
+}
+
+// newWebhookNotifier returns a notifier for url whose requests give up after
+// timeout.
+func newWebhookNotifier(url string, timeout time.Duration, logger *slog.Logger) *webhookNotifier {
+	return &webhookNotifier{
+		url:        url,
+		client:     &http.Client{Timeout: timeout},
+		retryDelay: time.Second,
+		logger:     logger,
+	}
+}
+
+// run delivers the events published to broker until ctx is done, using a
+// fixed pool of workers so slow deliveries never hold up requests.
+func (n *webhookNotifier) run(ctx context.Context, broker *eventBroker) {
+	ch := broker.subscribe(webhookQueueSize)
+	defer broker.unsubscribe(ch)
+
+	done := make(chan struct{})
+	for range webhookWorkers {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event := <-ch:
+					if err := n.deliver(ctx, event); err != nil {
+						n.logger.Error("Failed to deliver webhook", "event", event.Type, "task", event.Task.ID, "error", err)
+					}
+				}
+			}
+		}()
+	}
+	for range webhookWorkers {
+		<-done
+	}
+}
+
+// deliver POSTs event to the webhook, retrying network errors and 5xx and 429
+// responses with exponential backoff. Other non-2xx responses fail at once.
+func (n *webhookNotifier) deliver(ctx context.Context, event TaskEvent) error {
+	body, err := json.Marshal(webhookPayload{Event: event.Type, Tenant: n.tenant, Task: event.Task})
+	if err != nil {
+		return err
+	}
+
+	delay := n.retryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(ctx, body)
+		if !retry || attempt == webhookMaxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post makes a single delivery attempt, reporting whether a failure is worth
+// retrying.
+func (n *webhookNotifier) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook responded %s", resp.Status)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var attempts atomic.Int32
+	received := make(chan webhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first attempt to exercise the retry
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var payload webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("webhook body is not JSON: %v", err)
+		}
+		received <- payload
+	}))
+	defer server.Close()
+
+	notifier := newWebhookNotifier(server.URL, time.Second, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	notifier.retryDelay = time.Millisecond
+	broker := newEventBroker()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		notifier.run(ctx, broker)
+		close(stopped)
+	}()
+
+	// Wait for the notifier to subscribe before publishing
+	for deadline := time.Now().Add(time.Second); ; {
+		broker.mu.Lock()
+		n := len(broker.subscribers)
+		broker.mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	broker.publish(eventCreated, Task{ID: "1", Name: "Hooked"})
+
+	select {
+	case payload := <-received:
+		if payload.Event != eventCreated || payload.Task.ID != "1" || payload.Task.Name != "Hooked" {
+			t.Errorf("webhook received wrong payload: got %+v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("webhook was attempted %d times, want 2", n)
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Error("notifier did not stop when its context was cancelled")
+	}
+}